@@ -14,4 +14,22 @@ type NetworkShow struct {
 
 type NetworksList struct {
 	Networks []types.Network `json:"networks"`
+	// Usage is indexed by network ID, it is only set with ?usage=true
+	Usage map[string]types.NetworkIPAM `json:"usage,omitempty"`
+}
+
+type NetworkIPAM struct {
+	IPAM types.NetworkIPAM `json:"ipam"`
+}
+
+type NetworkAllocations struct {
+	Report types.IPAllocationsReport `json:"report"`
+}
+
+type VNIReservationCreate struct {
+	Reservation types.VNIReservation `json:"reservation"`
+}
+
+type VNIReservationsList struct {
+	Reservations []types.VNIReservation `json:"reservations"`
 }
@@ -5,5 +5,9 @@ type EndpointCreate struct {
 	Activate       bool             `json:"activate"`
 	ActivateParams EndpointActivate `json:"activate_params"`
 	IPv4Address    string           `json:"ipv4_address"`
+	IPv6Address    string           `json:"ipv6_address"`
 	MacAddress     string           `json:"mac_address"`
+	// ReservationKey identifies the caller, an endpoint created with the same
+	// key gets the same addresses until the reservation expires
+	ReservationKey string `json:"reservation_key"`
 }
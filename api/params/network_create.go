@@ -10,4 +10,27 @@ type NetworkCreate struct {
 	Type    types.NetworkType `json:"type"`
 	IPRange string            `json:"ip_range"`
 	Gateway string            `json:"gateway"`
+	// IPv6Range makes the network dual-stack, endpoints get an address in
+	// both ranges
+	IPv6Range   string `json:"ipv6_range"`
+	IPv6Gateway string `json:"ipv6_gateway"`
+	// ReservedAddresses and ReservedRanges are not allocated to endpoints
+	// unless they are requested explicitly, static VIPs for instance
+	ReservedAddresses []string `json:"reserved_addresses"`
+	ReservedRanges    []string `json:"reserved_ranges"`
+	// Infrastructure networks get their VNI in VNI_INFRASTRUCTURE_RANGES
+	Infrastructure bool `json:"infrastructure"`
+	// VxLANVNI is allocated automatically if not set, it must be in the
+	// ranges of the network and either free or reserved
+	VxLANVNI int `json:"vxlan_vni"`
+	// MTU of the interfaces of the network, derived from the MTU of the
+	// underlay interface of each node if not set
+	MTU int `json:"mtu"`
+	// VxLANPort and VxLANSourcePortRange default to VXLAN_PORT and
+	// VXLAN_SOURCE_PORT_RANGE
+	VxLANPort            int    `json:"vxlan_port"`
+	VxLANSourcePortRange string `json:"vxlan_source_port_range"`
+	// VTEPFamily defaults to the family of the PEER_IP of the node creating
+	// the network
+	VTEPFamily types.VTEPFamily `json:"vtep_family"`
 }
@@ -0,0 +1,15 @@
+package params
+
+// NetworkSubnetAdd appends a subnet to a network, the gateway defaults to the
+// first address of the range
+type NetworkSubnetAdd struct {
+	IPRange string `json:"ip_range"`
+	Gateway string `json:"gateway"`
+}
+
+// NetworkSubnetWiden replaces the IPRange subnet of a network by NewIPRange,
+// which must contain it
+type NetworkSubnetWiden struct {
+	IPRange    string `json:"ip_range"`
+	NewIPRange string `json:"new_ip_range"`
+}
@@ -0,0 +1,9 @@
+package params
+
+// NetworkUpdate modifies the fields of a network which are set, the nodes of
+// the network apply the modification to their interfaces
+type NetworkUpdate struct {
+	// MTU of the interfaces of the network, 0 to derive it from the MTU of the
+	// underlay interface of each node
+	MTU *int `json:"mtu"`
+}
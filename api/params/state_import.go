@@ -0,0 +1,6 @@
+package params
+
+type StateImport struct {
+	// DryRun only reports what would be written
+	DryRun bool
+}
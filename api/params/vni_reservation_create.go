@@ -0,0 +1,6 @@
+package params
+
+type VNIReservationCreate struct {
+	VNI         int    `json:"vni"`
+	Description string `json:"description"`
+}
@@ -23,17 +23,31 @@ type Endpoint struct {
 	TargetVethName  string    `json:"target_veth_name"`
 	TargetVethMAC   string    `json:"target_veth_mac"`
 	TargetVethIP    string    `json:"target_veth_ip"`
+	TargetVethIPv6  string    `json:"target_veth_ipv6,omitempty"`
 	Active          bool      `json:"active"`
+	// ReservationKey keeps the addresses of the endpoint for the next one
+	// created with the same key
+	ReservationKey string `json:"reservation_key,omitempty"`
 }
 
 func (e Endpoint) GetAPIHostname() string {
 	if e.APIHostname != "" {
 		return e.APIHostname
 	}
-        // Return legacy field for endpoints created before APIHostname was existing
+	// Return legacy field for endpoints created before APIHostname was existing
 	return e.Hostname
 }
 
+// TargetVethIPs returns the addresses of the target interface, the IPv6 one is
+// only set in dual-stack networks
+func (e Endpoint) TargetVethIPs() []string {
+	ips := []string{e.TargetVethIP}
+	if e.TargetVethIPv6 != "" {
+		ips = append(ips, e.TargetVethIPv6)
+	}
+	return ips
+}
+
 func (e Endpoint) String() string {
 	return fmt.Sprintf("Endpoint[%s|%s|Network(%s)|Active(%v)]", e.ID, e.TargetNetnsPath, e.NetworkID, e.Active)
 }
@@ -0,0 +1,28 @@
+package types
+
+// IPAllocationsReport compares the addresses allocated in the IP pools of a
+// network with the addresses of its endpoints
+type IPAllocationsReport struct {
+	NetworkID string `json:"network_id"`
+	// Repaired is true if the pools have been fixed to match the endpoints
+	Repaired bool `json:"repaired"`
+	// Orphaned addresses are allocated but used by no endpoint, they are leaked
+	// unless an endpoint is being created with one of them
+	Orphaned []string `json:"orphaned"`
+	// Unallocated addresses are used by an endpoint but free in the pools, they
+	// could be allocated to another endpoint
+	Unallocated []string `json:"unallocated"`
+	// Conflicts are addresses assigned to several endpoints, they are never
+	// repaired
+	Conflicts []IPAddressConflict `json:"conflicts"`
+}
+
+type IPAddressConflict struct {
+	Address     string   `json:"address"`
+	EndpointIDs []string `json:"endpoint_ids"`
+}
+
+// Consistent returns true if the pools match the endpoints
+func (r IPAllocationsReport) Consistent() bool {
+	return len(r.Orphaned) == 0 && len(r.Unallocated) == 0 && len(r.Conflicts) == 0
+}
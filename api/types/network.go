@@ -11,6 +11,18 @@ const (
 	OverlayNetworkType NetworkType = "overlay"
 	DefaultIPRange                 = "10.0.0.0/24"
 	DefaultGateway                 = "10.0.0.1/24"
+	// IPv6PoolSuffix is appended to the ID of a network to get the ID of its
+	// IPv6 IP allocation pool
+	IPv6PoolSuffix = "-ipv6"
+)
+
+// VTEPFamily is the IP version of the addresses of the VxLAN tunnel endpoints
+// of a network, all the nodes of a network use the same one
+type VTEPFamily string
+
+const (
+	VTEPFamilyIPv4 VTEPFamily = "ipv4"
+	VTEPFamilyIPv6 VTEPFamily = "ipv6"
 )
 
 type Network struct {
@@ -20,8 +32,39 @@ type Network struct {
 	Type         NetworkType `json:"type"`
 	NSHandlePath string      `json:"ns_handle_path"`
 	VxLANVNI     int         `json:"vxlan_vni"`
-	IPRange      string      `json:"ip_range"`
-	Gateway      string      `json:"gateway"`
+	// IPRange and Gateway are the ones of the first subnet
+	IPRange     string `json:"ip_range"`
+	Gateway     string `json:"gateway"`
+	IPv6Range   string `json:"ipv6_range,omitempty"`
+	IPv6Gateway string `json:"ipv6_gateway,omitempty"`
+	// Subnets is the ordered list of the IPv4 subnets of the network, empty
+	// for networks created with a single subnet
+	Subnets []Subnet `json:"subnets,omitempty"`
+	// ReservedAddresses and ReservedRanges are only allocated when they are
+	// requested explicitly
+	ReservedAddresses []string `json:"reserved_addresses,omitempty"`
+	ReservedRanges    []string `json:"reserved_ranges,omitempty"`
+	// Infrastructure networks have a VNI of VNI_INFRASTRUCTURE_RANGES
+	Infrastructure bool `json:"infrastructure,omitempty"`
+	// MTU of the VxLAN interface and of the veths of the endpoints, if it is 0
+	// each node uses the MTU of its underlay interface minus the VxLAN
+	// overhead
+	MTU int `json:"mtu,omitempty"`
+	// VxLANPort is the UDP destination port of the VxLAN interfaces, 4789 if
+	// it is 0. VxLANSourcePortRange like "49152-65535" restricts their source
+	// ports, the default range of the kernel is used if it is empty.
+	VxLANPort            int    `json:"vxlan_port,omitempty"`
+	VxLANSourcePortRange string `json:"vxlan_source_port_range,omitempty"`
+	// VTEPFamily is the family of the PEER_IP of the nodes of the network,
+	// networks created without it have IPv4 VTEPs
+	VTEPFamily VTEPFamily `json:"vtep_family,omitempty"`
+}
+
+// Subnet is an IPv4 range of a network, its gateway is set on the bridge of
+// the network on each node
+type Subnet struct {
+	IPRange string `json:"ip_range"`
+	Gateway string `json:"gateway"`
 }
 
 func (n Network) StorageKey() string {
@@ -35,6 +78,43 @@ func (n Network) EndpointsStorageKey(hostname string) string {
 	return fmt.Sprintf("%s/%s/%s", EndpointStoragePrefix, hostname, n.ID)
 }
 
+// IPv4Subnets returns the IPv4 subnets of the network, in the order they are
+// used by the IP allocator
+func (n Network) IPv4Subnets() []Subnet {
+	if len(n.Subnets) == 0 {
+		return []Subnet{{IPRange: n.IPRange, Gateway: n.Gateway}}
+	}
+	return n.Subnets
+}
+
+// Gateways returns the addresses of the bridge of the network, one per subnet,
+// the IPv6 one is only set in dual-stack networks
+func (n Network) Gateways() []string {
+	var gateways []string
+	for _, subnet := range n.IPv4Subnets() {
+		gateways = append(gateways, subnet.Gateway)
+	}
+	if n.IPv6Gateway != "" {
+		gateways = append(gateways, n.IPv6Gateway)
+	}
+	return gateways
+}
+
+// GetVTEPFamily returns the family of the VTEPs of the network, IPv4 for
+// the networks created before it was saved
+func (n Network) GetVTEPFamily() VTEPFamily {
+	if n.VTEPFamily == "" {
+		return VTEPFamilyIPv4
+	}
+	return n.VTEPFamily
+}
+
+// IPv6PoolID is the ID of the IP allocation pool of the IPv6 range, the IPv4
+// pool is using the ID of the network
+func (n Network) IPv6PoolID() string {
+	return n.ID + IPv6PoolSuffix
+}
+
 func (n Network) String() string {
 	return fmt.Sprintf("Network[%s|%s]", n.ID, n.Name)
 }
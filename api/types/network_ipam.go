@@ -0,0 +1,45 @@
+package types
+
+// NetworkIPAM describes the usage of the IP pools of a network
+type NetworkIPAM struct {
+	NetworkID string        `json:"network_id"`
+	Pools     []IPPoolUsage `json:"pools"`
+	// Addresses are the allocated addresses with the endpoint owning them,
+	// they are not listed in the usage summary of GET /networks
+	Addresses []IPAMAddress `json:"addresses,omitempty"`
+	// Warnings are set when a pool is nearly exhausted
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type IPPoolUsage struct {
+	Ranges []string `json:"ranges"`
+	Total  uint64   `json:"total"`
+	Used   uint64   `json:"used"`
+	// Reserved addresses are never allocated automatically: network,
+	// broadcast, gateway and reserved addresses
+	Reserved uint64 `json:"reserved"`
+	Free     uint64 `json:"free"`
+	// NearExhaustion is true when the share of addresses which are not free
+	// reaches IP_USAGE_WARNING_THRESHOLD
+	NearExhaustion bool `json:"near_exhaustion"`
+}
+
+type IPAMAddress struct {
+	Address string `json:"address"`
+	// EndpointID is empty if no endpoint is using the address: gateways,
+	// addresses kept for a reservation key or leaked addresses
+	EndpointID string `json:"endpoint_id,omitempty"`
+	// Reserved addresses are never released, like the gateways
+	Reserved       bool   `json:"reserved,omitempty"`
+	ReservationKey string `json:"reservation_key,omitempty"`
+}
+
+// NearExhaustion returns true if one of the pools is nearly exhausted
+func (n NetworkIPAM) NearExhaustion() bool {
+	for _, pool := range n.Pools {
+		if pool.NearExhaustion {
+			return true
+		}
+	}
+	return false
+}
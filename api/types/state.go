@@ -0,0 +1,94 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StateFormatVersion is the version of the format of the State document, it
+// is increased when the document changes in a non backward compatible way
+const StateFormatVersion = 1
+
+// State is a snapshot of the data of SAND stored in etcd, it is used to backup
+// and restore a cluster. The VNI used by the networks are part of the networks.
+type State struct {
+	FormatVersion   int                     `json:"format_version"`
+	SchemaVersion   int                     `json:"schema_version"`
+	ExportedAt      time.Time               `json:"exported_at"`
+	Networks        []Network               `json:"networks"`
+	Endpoints       []Endpoint              `json:"endpoints"`
+	IPAllocations   []IPAllocation          `json:"ip_allocations"`
+	DockerNetworks  []DockerNetworkBinding  `json:"docker_networks"`
+	DockerEndpoints []DockerEndpointBinding `json:"docker_endpoints"`
+}
+
+// IPAllocation is the state of the IP allocator of a network, with one entry
+// per subnet of the network
+type IPAllocation struct {
+	ID           string                   `json:"id"`
+	Subnets      []IPAllocationSubnet     `json:"subnets"`
+	Reservations map[string]IPReservation `json:"reservations,omitempty"`
+}
+
+// IPReservation binds a key to an address of an IP allocation, ExpiresAt is
+// nil while the address is used by an endpoint
+type IPReservation struct {
+	Address   string     `json:"address"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IPAllocationSubnet contains the allocated addresses of a range, BitSet as
+// serialized by github.com/bits-and-blooms/bitset for IPv4 ranges, Offsets for
+// IPv6 ranges. Reserved offsets are never released, Exclusions are only
+// allocated when requested explicitly.
+type IPAllocationSubnet struct {
+	AddressRange string                  `json:"address_range"`
+	AddressCount uint                    `json:"address_count"`
+	BitSet       json.RawMessage         `json:"bit_set,omitempty"`
+	Offsets      []uint64                `json:"offsets,omitempty"`
+	Reserved     []uint64                `json:"reserved,omitempty"`
+	Exclusions   []IPAllocationExclusion `json:"exclusions,omitempty"`
+	Quarantine   []IPAllocationReleased  `json:"quarantine,omitempty"`
+}
+
+// IPAllocationReleased is an address of a subnet released recently, it is not
+// allocated again before the end of its quarantine
+type IPAllocationReleased struct {
+	Offset     uint64    `json:"offset"`
+	ReleasedAt time.Time `json:"released_at"`
+}
+
+// IPAllocationExclusion is a range of offsets of a subnet, First and Last
+// included
+type IPAllocationExclusion struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
+// DockerNetworkBinding links a docker network to a SAND network, the field
+// names are the ones stored by the docker integration
+type DockerNetworkBinding struct {
+	DockerNetworkID string `json:"DockerNetworkID"`
+	SandNetworkID   string `json:"SandNetworkID"`
+}
+
+// DockerEndpointBinding links a docker endpoint to a SAND endpoint
+type DockerEndpointBinding struct {
+	DockerNetworkBinding
+	DockerEndpointID string `json:"DockerEndpointID"`
+	SandEndpointID   string `json:"SandEndpointID"`
+}
+
+// StateImportReport describes what an import did or would do in dry run. If
+// there is any conflict, nothing is written.
+type StateImportReport struct {
+	DryRun    bool            `json:"dry_run"`
+	Created   []string        `json:"created"`
+	Unchanged []string        `json:"unchanged"`
+	Conflicts []StateConflict `json:"conflicts"`
+}
+
+type StateConflict struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
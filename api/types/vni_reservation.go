@@ -0,0 +1,23 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	VNIReservationStoragePrefix = "/vni-reservations"
+)
+
+// VNIReservation keeps a VNI out of the allocation without creating a
+// network, for a VXLAN segment managed outside of SAND for instance. A network
+// created with this VNI takes it over.
+type VNIReservation struct {
+	VNI         int       `json:"vni"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (r VNIReservation) StorageKey() string {
+	return fmt.Sprintf("%s/%d", VNIReservationStoragePrefix, r.VNI)
+}
@@ -18,13 +18,25 @@ import (
 type Client interface {
 	Version(context.Context) (string, error)
 	NetworksList(context.Context) ([]types.Network, error)
+	NetworksUsage(context.Context) (map[string]types.NetworkIPAM, error)
 	NetworkCreate(context.Context, params.NetworkCreate) (types.Network, error)
 	NetworkShow(context.Context, string) (types.Network, error)
 	NetworkConnect(context.Context, string, params.NetworkConnect) (net.Conn, error)
+	NetworkUpdate(context.Context, string, params.NetworkUpdate) (types.Network, error)
 	NetworkDelete(context.Context, string) error
+	NetworkSubnetAdd(context.Context, string, params.NetworkSubnetAdd) (types.Network, error)
+	NetworkSubnetWiden(context.Context, string, params.NetworkSubnetWiden) (types.Network, error)
+	NetworkAllocations(context.Context, string, bool) (types.IPAllocationsReport, error)
+	NetworkIPAM(context.Context, string) (types.NetworkIPAM, error)
+	NetworkReservationRelease(context.Context, string, string) error
+	VNIReservationCreate(context.Context, params.VNIReservationCreate) (types.VNIReservation, error)
+	VNIReservationsList(context.Context) ([]types.VNIReservation, error)
+	VNIReservationDelete(context.Context, int) error
 	EndpointCreate(context.Context, params.EndpointCreate) (types.Endpoint, error)
 	EndpointsList(context.Context, params.EndpointsList) ([]types.Endpoint, error)
 	EndpointDelete(context.Context, string) error
+	StateExport(context.Context) (types.State, error)
+	StateImport(context.Context, types.State, params.StateImport) (types.StateImportReport, error)
 	NewHTTPRoundTripper(ctx context.Context, id string, opts HTTPRoundTripperOpts) http.RoundTripper
 }
 
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/Scalingo/sand/api/httpresp"
 	"github.com/Scalingo/sand/api/params"
@@ -114,3 +115,79 @@ func (c *client) NetworkDelete(ctx context.Context, networkID string) error {
 
 	return nil
 }
+
+func (c *client) NetworkReservationRelease(ctx context.Context, networkID, key string) error {
+	path := fmt.Sprintf("/networks/%s/reservations/%s", networkID, url.PathEscape(key))
+	req, err := http.NewRequest("DELETE", c.url+path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "fail to create HTTP request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "fail to execute DELETE %s", path)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent {
+		var reserr httpresp.Error
+		err := json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+
+		return reserr
+	}
+
+	return nil
+}
+
+func (c *client) NetworkUpdate(ctx context.Context, id string, params params.NetworkUpdate) (types.Network, error) {
+	return c.networkRequest(ctx, "PATCH", fmt.Sprintf("/networks/%s", id), params)
+}
+
+func (c *client) NetworkSubnetAdd(ctx context.Context, id string, params params.NetworkSubnetAdd) (types.Network, error) {
+	return c.networkRequest(ctx, "POST", fmt.Sprintf("/networks/%s/subnets", id), params)
+}
+
+func (c *client) NetworkSubnetWiden(ctx context.Context, id string, params params.NetworkSubnetWiden) (types.Network, error) {
+	return c.networkRequest(ctx, "POST", fmt.Sprintf("/networks/%s/subnets/widen", id), params)
+}
+
+// networkRequest sends params to path and returns the network in the response
+func (c *client) networkRequest(ctx context.Context, method, path string, params interface{}) (types.Network, error) {
+	var (
+		network types.Network
+		buffer  = new(bytes.Buffer)
+	)
+	err := json.NewEncoder(buffer).Encode(params)
+	if err != nil {
+		return network, errors.Wrapf(err, "fail to serialize JSON")
+	}
+	req, err := http.NewRequest(method, c.url+path, buffer)
+	if err != nil {
+		return network, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return network, errors.Wrapf(err, "fail to execute %s %s", method, path)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		var reserr httpresp.Error
+		err := json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return network, errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return network, reserr
+	}
+
+	var r httpresp.NetworkShow
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if err != nil {
+		return network, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return r.Network, nil
+}
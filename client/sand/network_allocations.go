@@ -0,0 +1,47 @@
+package sand
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/pkg/errors"
+)
+
+// NetworkAllocations reports the differences between the IP pools of the
+// network and its endpoints, the pools are fixed if repair is true
+func (c *client) NetworkAllocations(ctx context.Context, id string, repair bool) (types.IPAllocationsReport, error) {
+	method, path := "GET", fmt.Sprintf("/networks/%s/allocations", id)
+	if repair {
+		method, path = "POST", path+"/repair"
+	}
+	req, err := http.NewRequest(method, c.url+path, nil)
+	if err != nil {
+		return types.IPAllocationsReport{}, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return types.IPAllocationsReport{}, errors.Wrapf(err, "fail to execute %s %s", method, path)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		var reserr httpresp.Error
+		err := json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return types.IPAllocationsReport{}, errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return types.IPAllocationsReport{}, reserr
+	}
+
+	var r httpresp.NetworkAllocations
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if err != nil {
+		return types.IPAllocationsReport{}, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return r.Report, nil
+}
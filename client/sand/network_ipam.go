@@ -0,0 +1,65 @@
+package sand
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/pkg/errors"
+)
+
+// NetworkIPAM returns the usage of the IP pools of the network and its
+// allocated addresses
+func (c *client) NetworkIPAM(ctx context.Context, id string) (types.NetworkIPAM, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/networks/%s/ipam", c.url, id), nil)
+	if err != nil {
+		return types.NetworkIPAM{}, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return types.NetworkIPAM{}, errors.Wrapf(err, "fail to execute GET /networks/%s/ipam", id)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		var reserr httpresp.Error
+		err := json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return types.NetworkIPAM{}, errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return types.NetworkIPAM{}, reserr
+	}
+
+	var r httpresp.NetworkIPAM
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if err != nil {
+		return types.NetworkIPAM{}, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return r.IPAM, nil
+}
+
+// NetworksUsage returns the usage summary of the IP pools of all the networks,
+// indexed by network ID
+func (c *client) NetworksUsage(ctx context.Context) (map[string]types.NetworkIPAM, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/networks?usage=true", c.url), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to execute GET /networks?usage=true")
+	}
+	defer res.Body.Close()
+
+	var r httpresp.NetworksList
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return r.Usage, nil
+}
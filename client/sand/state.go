@@ -0,0 +1,86 @@
+package sand
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/pkg/errors"
+)
+
+// ErrStateConflict is returned by StateImport when the state conflicts with
+// the data of the cluster, the conflicts are listed in the report
+var ErrStateConflict = errors.New("state conflicts with the cluster")
+
+func (c *client) StateExport(ctx context.Context) (types.State, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/state/export", c.url), nil)
+	if err != nil {
+		return types.State{}, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return types.State{}, errors.Wrapf(err, "fail to execute GET /state/export")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var reserr httpresp.Error
+		err = json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return types.State{}, errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return types.State{}, reserr
+	}
+
+	var state types.State
+	err = json.NewDecoder(res.Body).Decode(&state)
+	if err != nil {
+		return types.State{}, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return state, nil
+}
+
+func (c *client) StateImport(ctx context.Context, state types.State, params params.StateImport) (types.StateImportReport, error) {
+	var (
+		report types.StateImportReport
+		buffer = new(bytes.Buffer)
+	)
+	err := json.NewEncoder(buffer).Encode(&state)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to serialize JSON")
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/state/import?dry_run=%v", c.url, params.DryRun), buffer)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to execute POST /state/import")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusConflict {
+		var reserr httpresp.Error
+		err = json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return report, errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return report, reserr
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&report)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	if res.StatusCode == http.StatusConflict {
+		return report, ErrStateConflict
+	}
+	return report, nil
+}
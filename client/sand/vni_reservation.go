@@ -0,0 +1,95 @@
+package sand
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/pkg/errors"
+)
+
+func (c *client) VNIReservationCreate(ctx context.Context, params params.VNIReservationCreate) (types.VNIReservation, error) {
+	var (
+		reservation types.VNIReservation
+		buffer      = new(bytes.Buffer)
+	)
+	err := json.NewEncoder(buffer).Encode(&params)
+	if err != nil {
+		return reservation, errors.Wrapf(err, "fail to serialize JSON")
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/vni-reservations", c.url), buffer)
+	if err != nil {
+		return reservation, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return reservation, errors.Wrapf(err, "fail to execute POST /vni-reservations")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 201 {
+		var reserr httpresp.Error
+		err = json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return reservation, errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return reservation, reserr
+	}
+
+	var r httpresp.VNIReservationCreate
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if err != nil {
+		return reservation, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return r.Reservation, nil
+}
+
+func (c *client) VNIReservationsList(ctx context.Context) ([]types.VNIReservation, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/vni-reservations", c.url), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create http request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to execute GET /vni-reservations")
+	}
+	defer res.Body.Close()
+
+	var r httpresp.VNIReservationsList
+	err = json.NewDecoder(res.Body).Decode(&r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to unserialize JSON")
+	}
+	return r.Reservations, nil
+}
+
+func (c *client) VNIReservationDelete(ctx context.Context, vni int) error {
+	path := fmt.Sprintf("/vni-reservations/%d", vni)
+	req, err := http.NewRequest("DELETE", c.url+path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "fail to create HTTP request")
+	}
+	req = req.WithContext(ctx)
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "fail to execute DELETE %s", path)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent {
+		var reserr httpresp.Error
+		err := json.NewDecoder(res.Body).Decode(&reserr)
+		if err != nil {
+			return errors.Wrapf(err, "fail to decode JSON in errors response: %s", res.Status)
+		}
+		return reserr
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/Scalingo/sand/api/params"
 	"github.com/Scalingo/sand/api/types"
@@ -13,9 +14,13 @@ type CliEndpoint types.Endpoint
 
 func (e CliEndpoint) String() string {
 	if e.Active {
-		return fmt.Sprintf("* [ACTIVE]  ID=%s networkID=%s hostname=%s IP=%s NS=%s", e.ID, e.NetworkID, e.Hostname, e.TargetVethIP, e.TargetNetnsPath)
+		return fmt.Sprintf("* [ACTIVE]  ID=%s networkID=%s hostname=%s IP=%s NS=%s", e.ID, e.NetworkID, e.Hostname, e.ips(), e.TargetNetnsPath)
 	}
-	return fmt.Sprintf("* [PASSIVE] ID=%s networkID=%s hostname=%s IP=%s", e.ID, e.NetworkID, e.Hostname, e.TargetVethIP)
+	return fmt.Sprintf("* [PASSIVE] ID=%s networkID=%s hostname=%s IP=%s", e.ID, e.NetworkID, e.Hostname, e.ips())
+}
+
+func (e CliEndpoint) ips() string {
+	return strings.Join(types.Endpoint(e).TargetVethIPs(), ",")
 }
 
 func (a *App) EndpointCreate(c *cli.Context) error {
@@ -24,9 +29,10 @@ func (a *App) EndpointCreate(c *cli.Context) error {
 		return err
 	}
 	endpoint, err := client.EndpointCreate(context.Background(), params.EndpointCreate{
-		NetworkID:   c.String("network"),
-		IPv4Address: c.String("ip"),
-		Activate:    true,
+		NetworkID:      c.String("network"),
+		IPv4Address:    c.String("ip"),
+		ReservationKey: c.String("reservation-key"),
+		Activate:       true,
 		ActivateParams: params.EndpointActivate{
 			NSHandlePath: c.String("ns"),
 		},
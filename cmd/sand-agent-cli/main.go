@@ -63,6 +63,22 @@ func main() {
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "name", Usage: "name of the network to create"},
 				cli.StringFlag{Name: "ip-range", Usage: "IP Range from which endpoint IP will be allocated from"},
+				cli.StringFlag{Name: "ipv6-range", Usage: "IPv6 Range from which endpoint IPv6 will be allocated from, makes the network dual-stack"},
+				cli.StringSliceFlag{Name: "reserved-address", Usage: "Address only allocated when requested explicitly, can be repeated"},
+				cli.StringSliceFlag{Name: "reserved-range", Usage: "Range only allocated when requested explicitly, can be repeated"},
+				cli.BoolFlag{Name: "infrastructure", Usage: "Allocate the VNI in the ranges of the infrastructure networks"},
+				cli.IntFlag{Name: "vni", Usage: "VNI of the network, allocated automatically if not set"},
+				cli.IntFlag{Name: "mtu", Usage: "MTU of the interfaces of the network, derived from the underlay interface if not set"},
+				cli.IntFlag{Name: "vxlan-port", Usage: "UDP destination port of the VxLAN interfaces, VXLAN_PORT of the agent if not set"},
+				cli.StringFlag{Name: "vtep-family", Usage: "Family of the VTEP addresses of the nodes, ipv4 or ipv6, the one of the PEER_IP of the agent if not set"},
+				cli.StringFlag{Name: "vxlan-source-ports", Usage: "UDP source port range of the VxLAN interfaces like 49152-65535, VXLAN_SOURCE_PORT_RANGE of the agent if not set"},
+			},
+		}, {
+			Name:   "network-update",
+			Action: app.NetworkUpdate,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "network,n", Usage: "ID of the network to update"},
+				cli.IntFlag{Name: "mtu", Usage: "MTU of the interfaces of the network, 0 to derive it from the underlay interface"},
 			},
 		}, {
 			Name:   "network-show",
@@ -73,6 +89,9 @@ func main() {
 		}, {
 			Name:   "network-list",
 			Action: app.NetworksList,
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "usage", Usage: "Show the usage of the IP pools"},
+			},
 		}, {
 			Name:   "network-delete",
 			Action: app.NetworkDelete,
@@ -80,6 +99,59 @@ func main() {
 				cli.StringFlag{Name: "network,n", Usage: "ID of the network to delete"},
 				cli.BoolFlag{Name: "recursive,r", Usage: "Also delete the endpoints"},
 			},
+		}, {
+			Name:   "network-subnet-add",
+			Action: app.NetworkSubnetAdd,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "network,n", Usage: "ID of the network to extend"},
+				cli.StringFlag{Name: "ip-range", Usage: "IP Range of the subnet to add, must not overlap the other subnets"},
+				cli.StringFlag{Name: "gateway", Usage: "Gateway of the subnet, default is the first address of the range"},
+			},
+		}, {
+			Name:   "network-subnet-widen",
+			Action: app.NetworkSubnetWiden,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "network,n", Usage: "ID of the network to extend"},
+				cli.StringFlag{Name: "ip-range", Usage: "IP Range of the subnet to widen"},
+				cli.StringFlag{Name: "new-ip-range", Usage: "New IP Range of the subnet, must contain the current one"},
+			},
+		}, {
+			Name:   "network-allocations",
+			Action: app.NetworkAllocations,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "network,n", Usage: "ID of the network to check"},
+				cli.BoolFlag{Name: "repair", Usage: "Release the orphaned addresses and allocate the unallocated ones"},
+			},
+		}, {
+			Name:   "network-ipam",
+			Action: app.NetworkIPAM,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "network,n", Usage: "ID of the network"},
+				cli.BoolFlag{Name: "addresses", Usage: "List the allocated addresses and their endpoint"},
+			},
+		}, {
+			Name:   "network-reservation-release",
+			Action: app.NetworkReservationRelease,
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "network,n", Usage: "ID of the network of the reservation"},
+				cli.StringFlag{Name: "key", Usage: "Reservation key to release"},
+			},
+		}, {
+			Name:   "vni-reservation-list",
+			Action: app.VNIReservationsList,
+		}, {
+			Name:   "vni-reservation-create",
+			Action: app.VNIReservationCreate,
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "vni", Usage: "VNI to keep out of the allocation"},
+				cli.StringFlag{Name: "description", Usage: "What the VNI is used for"},
+			},
+		}, {
+			Name:   "vni-reservation-delete",
+			Action: app.VNIReservationDelete,
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "vni", Usage: "Reserved VNI to release"},
+			},
 		}, {
 			Name:   "network-connect",
 			Action: app.NetworkConnect,
@@ -111,6 +183,7 @@ func main() {
 				cli.StringFlag{Name: "network,n", Usage: "network id to use"},
 				cli.StringFlag{Name: "ns", Usage: "path to the namespace file handle"},
 				cli.StringFlag{Name: "ip", Usage: "use a precise IP instead of a generated one (optional)"},
+				cli.StringFlag{Name: "reservation-key", Usage: "get back the IP of the last endpoint created with this key (optional)"},
 			},
 		}, {
 			Name:   "endpoint-delete",
@@ -118,6 +191,25 @@ func main() {
 			Flags: []cli.Flag{
 				cli.StringFlag{Name: "endpoint,e", Usage: "ID of the endpoint to delete"},
 			},
+		}, {
+			Name:  "state",
+			Usage: "backup and restore the state of the cluster",
+			Subcommands: cli.Commands{
+				{
+					Name:   "export",
+					Action: app.StateExport,
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "output,o", Usage: "file where the state is written, default is stdout"},
+					},
+				}, {
+					Name:   "import",
+					Action: app.StateImport,
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "input,i", Usage: "file of the state to import"},
+						cli.BoolFlag{Name: "dry-run", Usage: "only report what would be written"},
+					},
+				},
+			},
 		},
 	}
 	err := app.cli.Run(os.Args)
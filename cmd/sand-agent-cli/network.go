@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
 	"github.com/urfave/cli"
 )
 
@@ -14,14 +15,53 @@ func (a *App) NetworkCreate(c *cli.Context) error {
 		return err
 	}
 	network, err := client.NetworkCreate(context.Background(), params.NetworkCreate{
-		Name:    c.String("name"),
-		IPRange: c.String("ip-range"),
+		Name:                 c.String("name"),
+		IPRange:              c.String("ip-range"),
+		IPv6Range:            c.String("ipv6-range"),
+		ReservedAddresses:    c.StringSlice("reserved-address"),
+		ReservedRanges:       c.StringSlice("reserved-range"),
+		Infrastructure:       c.Bool("infrastructure"),
+		VxLANVNI:             c.Int("vni"),
+		MTU:                  c.Int("mtu"),
+		VxLANPort:            c.Int("vxlan-port"),
+		VxLANSourcePortRange: c.String("vxlan-source-ports"),
+		VTEPFamily:           types.VTEPFamily(c.String("vtep-family")),
 	})
 	if err != nil {
 		return err
 	}
 	fmt.Println("New network created:")
 	fmt.Printf("* id=%s name=%s type=%s ip-range=%s, vni=%d\n", network.ID, network.Name, network.Type, network.IPRange, network.VxLANVNI)
+	if network.IPv6Range != "" {
+		fmt.Printf("  ipv6-range=%s\n", network.IPv6Range)
+	}
+	fmt.Printf("  vtep-family=%s vxlan-port=%d", network.GetVTEPFamily(), network.VxLANPort)
+	if network.VxLANSourcePortRange != "" {
+		fmt.Printf(" vxlan-source-ports=%s", network.VxLANSourcePortRange)
+	}
+	fmt.Println()
+	return nil
+}
+
+func (a *App) NetworkUpdate(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	var nup params.NetworkUpdate
+	if c.IsSet("mtu") {
+		mtu := c.Int("mtu")
+		nup.MTU = &mtu
+	}
+	network, err := client.NetworkUpdate(context.Background(), c.String("network"), nup)
+	if err != nil {
+		return err
+	}
+	mtu := "auto"
+	if network.MTU != 0 {
+		mtu = fmt.Sprint(network.MTU)
+	}
+	fmt.Printf("Network %s updated: mtu=%s\n", network.ID, mtu)
 	return nil
 }
 
@@ -53,9 +93,19 @@ func (a *App) NetworksList(c *cli.Context) error {
 		fmt.Println("No existing network")
 		return nil
 	}
+	var usage map[string]types.NetworkIPAM
+	if c.Bool("usage") {
+		usage, err = client.NetworksUsage(context.Background())
+		if err != nil {
+			return err
+		}
+	}
 	fmt.Println("List of networks:")
 	for _, network := range networks {
 		fmt.Printf("* [%s] %s (%s VNI: %d)\n", network.ID, network.Name, network.Type, network.VxLANVNI)
+		for _, pool := range usage[network.ID].Pools {
+			fmt.Printf("  - %s\n", formatIPPoolUsage(pool))
+		}
 	}
 	return nil
 }
@@ -91,3 +141,18 @@ func (a *App) NetworkDelete(c *cli.Context) error {
 	fmt.Printf("Network %s has been deleted\n", c.String("network"))
 	return nil
 }
+
+func (a *App) NetworkReservationRelease(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+
+	err = client.NetworkReservationRelease(context.Background(), c.String("network"), c.String("key"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reservation %s of network %s has been released\n", c.String("key"), c.String("network"))
+	return nil
+}
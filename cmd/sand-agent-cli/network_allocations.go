@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+func (a *App) NetworkAllocations(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	report, err := client.NetworkAllocations(context.Background(), c.String("network"), c.Bool("repair"))
+	if err != nil {
+		return err
+	}
+
+	if report.Consistent() {
+		fmt.Printf("IP allocations of network %s match its endpoints\n", report.NetworkID)
+		return nil
+	}
+	verb := "found"
+	if report.Repaired {
+		verb = "repaired"
+	}
+	for _, address := range report.Orphaned {
+		fmt.Printf("* orphaned %s: allocated without endpoint, %s\n", address, verb)
+	}
+	for _, address := range report.Unallocated {
+		fmt.Printf("* unallocated %s: used by an endpoint but free, %s\n", address, verb)
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("* conflict %s: assigned to endpoints %s\n", conflict.Address, strings.Join(conflict.EndpointIDs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/Scalingo/sand/api/types"
+)
+
+func (a *App) NetworkIPAM(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	ipam, err := client.NetworkIPAM(context.Background(), c.String("network"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("IP pools of network %s:\n", ipam.NetworkID)
+	for _, pool := range ipam.Pools {
+		fmt.Printf("* %s\n", formatIPPoolUsage(pool))
+	}
+	if c.Bool("addresses") {
+		fmt.Println("Allocated addresses:")
+		for _, address := range ipam.Addresses {
+			owner := address.EndpointID
+			if address.Reserved {
+				owner = "reserved"
+			} else if owner == "" && address.ReservationKey != "" {
+				owner = "kept for " + address.ReservationKey
+			} else if owner == "" {
+				owner = "no endpoint"
+			}
+			fmt.Printf("* %s: %s\n", address.Address, owner)
+		}
+	}
+	for _, warning := range ipam.Warnings {
+		fmt.Printf("WARNING: %s\n", warning)
+	}
+	return nil
+}
+
+func formatIPPoolUsage(pool types.IPPoolUsage) string {
+	usage := fmt.Sprintf("%s: %d used, %d reserved, %d free out of %d",
+		strings.Join(pool.Ranges, ", "), pool.Used, pool.Reserved, pool.Free, pool.Total,
+	)
+	if pool.NearExhaustion {
+		usage += " (nearly exhausted)"
+	}
+	return usage
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/urfave/cli"
+)
+
+func (a *App) NetworkSubnetAdd(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	network, err := client.NetworkSubnetAdd(context.Background(), c.String("network"), params.NetworkSubnetAdd{
+		IPRange: c.String("ip-range"),
+		Gateway: c.String("gateway"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Subnet %s added to network %s\n", c.String("ip-range"), network.ID)
+	printNetworkSubnets(network)
+	return nil
+}
+
+func (a *App) NetworkSubnetWiden(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	network, err := client.NetworkSubnetWiden(context.Background(), c.String("network"), params.NetworkSubnetWiden{
+		IPRange:    c.String("ip-range"),
+		NewIPRange: c.String("new-ip-range"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Subnet %s of network %s widened to %s\n", c.String("ip-range"), network.ID, c.String("new-ip-range"))
+	printNetworkSubnets(network)
+	return nil
+}
+
+func printNetworkSubnets(network types.Network) {
+	for _, subnet := range network.IPv4Subnets() {
+		fmt.Printf("* ip-range=%s gateway=%s\n", subnet.IPRange, subnet.Gateway)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/client/sand"
+)
+
+func (a *App) StateExport(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	state, err := client.StateExport(context.Background())
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if c.String("output") != "" {
+		fd, err := os.OpenFile(c.String("output"), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "fail to open %v", c.String("output"))
+		}
+		defer fd.Close()
+		out = fd
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(&state)
+	if err != nil {
+		return errors.Wrapf(err, "fail to write state")
+	}
+	if c.String("output") != "" {
+		fmt.Printf("State exported to %s: %d networks, %d endpoints\n", c.String("output"), len(state.Networks), len(state.Endpoints))
+	}
+	return nil
+}
+
+func (a *App) StateImport(c *cli.Context) error {
+	if c.String("input") == "" {
+		return errors.New("--input is required")
+	}
+	fd, err := os.Open(c.String("input"))
+	if err != nil {
+		return errors.Wrapf(err, "fail to open %v", c.String("input"))
+	}
+	defer fd.Close()
+
+	var state types.State
+	err = json.NewDecoder(fd).Decode(&state)
+	if err != nil {
+		return errors.Wrapf(err, "fail to read state")
+	}
+
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	report, err := client.StateImport(context.Background(), state, params.StateImport{
+		DryRun: c.Bool("dry-run"),
+	})
+	if err != nil && err != sand.ErrStateConflict {
+		return err
+	}
+
+	for _, key := range report.Created {
+		fmt.Printf("+ %s\n", key)
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("! %s: %s\n", conflict.Key, conflict.Reason)
+	}
+	fmt.Printf("%d keys to create, %d unchanged, %d conflicts\n", len(report.Created), len(report.Unchanged), len(report.Conflicts))
+	if err != nil {
+		return errors.New("state not imported")
+	}
+	if report.DryRun {
+		fmt.Println("Dry run, nothing has been written")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Scalingo/sand/api/params"
+	"github.com/urfave/cli"
+)
+
+func (a *App) VNIReservationCreate(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	reservation, err := client.VNIReservationCreate(context.Background(), params.VNIReservationCreate{
+		VNI:         c.Int("vni"),
+		Description: c.String("description"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("VNI %d reserved\n", reservation.VNI)
+	return nil
+}
+
+func (a *App) VNIReservationsList(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	reservations, err := client.VNIReservationsList(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(reservations) == 0 {
+		fmt.Println("No VNI reservation")
+		return nil
+	}
+	fmt.Println("List of VNI reservations:")
+	for _, reservation := range reservations {
+		fmt.Printf("* %d %s (%s)\n", reservation.VNI, reservation.Description, reservation.CreatedAt)
+	}
+	return nil
+}
+
+func (a *App) VNIReservationDelete(c *cli.Context) error {
+	client, err := a.sandClient(c)
+	if err != nil {
+		return err
+	}
+	err = client.VNIReservationDelete(context.Background(), c.Int("vni"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reservation of VNI %d released\n", c.Int("vni"))
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/endpoint"
+	"github.com/Scalingo/sand/gc"
+	"github.com/Scalingo/sand/network"
+	"github.com/Scalingo/sand/network/netmanager"
+)
+
+// collectGarbage removes the namespaces and interfaces of the node which have
+// no network or endpoint in the store and prints them
+func collectGarbage(ctx context.Context, c *config.Config, dryRun bool, gracePeriod time.Duration) error {
+	backend, err := newStoreBackend(c)
+	if err != nil {
+		return errors.Wrapf(err, "fail to initialize store")
+	}
+	defer backend.Close()
+
+	managers := netmanager.NewManagerMap()
+	collector := gc.NewCollector(c,
+		network.NewRepository(c, backend.store, managers),
+		endpoint.NewRepository(c, backend.store, managers),
+		gracePeriod,
+	)
+	orphans, err := collector.Run(ctx, dryRun)
+	printOrphans(orphans, dryRun)
+	if err != nil {
+		return errors.Wrapf(err, "fail to collect garbage")
+	}
+	return nil
+}
+
+func printOrphans(orphans []gc.Orphan, dryRun bool) {
+	if len(orphans) == 0 {
+		fmt.Println("No orphan")
+		return
+	}
+	verb := "removed"
+	if dryRun {
+		verb = "would be removed"
+	}
+	for _, orphan := range orphans {
+		namespace := "root namespace"
+		if orphan.Namespace != "" {
+			namespace = orphan.Namespace
+		}
+		if orphan.Kind == gc.OrphanNamespace {
+			fmt.Printf("Orphan namespace %s %s\n", orphan.Name, verb)
+			continue
+		}
+		fmt.Printf("Orphan %s %s in %s %s\n", orphan.Kind, orphan.Name, namespace, verb)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/migrations"
+)
+
+// migrate applies the migrations of the store schema which have not been run
+// yet and prints what has been changed
+func migrate(ctx context.Context, c *config.Config, dryRun bool) error {
+	backend, err := newStoreBackend(c)
+	if err != nil {
+		return errors.Wrapf(err, "fail to initialize store")
+	}
+	defer backend.Close()
+
+	results, err := migrations.New(backend.store, backend.locker).Run(ctx, dryRun)
+	printMigrationResults(results, dryRun)
+	if err != nil {
+		return errors.Wrapf(err, "fail to migrate store")
+	}
+	return nil
+}
+
+func printMigrationResults(results []migrations.Result, dryRun bool) {
+	if len(results) == 0 {
+		fmt.Println("Store schema is up to date")
+		return
+	}
+	verb := "applied"
+	if dryRun {
+		verb = "would be applied"
+	}
+	for _, result := range results {
+		fmt.Printf("Migration %d %s: %s (%d changes)\n", result.Version, verb, result.Description, len(result.Changes))
+		for _, change := range result.Changes {
+			fmt.Printf("  %s: %s\n", change.Key, change.Description)
+		}
+	}
+}
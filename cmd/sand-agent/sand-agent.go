@@ -3,15 +3,17 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"expvar"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/moby/moby/pkg/reexec"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
 
-	"github.com/Scalingo/go-etcd-lock/v5/lock"
 	"github.com/Scalingo/go-handlers"
 	dockeripam "github.com/Scalingo/go-plugins-helpers/ipam"
 	dockernetwork "github.com/Scalingo/go-plugins-helpers/network"
@@ -23,12 +25,15 @@ import (
 	"github.com/Scalingo/sand/api/types"
 	"github.com/Scalingo/sand/config"
 	"github.com/Scalingo/sand/endpoint"
-	"github.com/Scalingo/sand/etcd"
+	"github.com/Scalingo/sand/gc"
 	"github.com/Scalingo/sand/integrations/docker"
 	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/migrations"
 	"github.com/Scalingo/sand/network"
 	"github.com/Scalingo/sand/network/netmanager"
 	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/reconciler"
+	"github.com/Scalingo/sand/state"
 	"github.com/Scalingo/sand/store"
 	apptls "github.com/Scalingo/sand/utils/tls"
 	"github.com/Scalingo/sand/web"
@@ -61,49 +66,160 @@ func main() {
 		os.Exit(-1)
 	}
 
-	dataStore := store.New(c)
-	endpointsWatcher, err := store.NewWatcher(ctx, c, store.WithPrefix(types.NetworkEndpointStoragePrefix))
+	app := cli.NewApp()
+	app.Name = "sand-agent"
+	app.Usage = "SAND agent, manages the overlay networks of the node"
+	app.Version = c.Version
+	app.Action = func(*cli.Context) error {
+		runAgent(ctx, c)
+		return nil
+	}
+	app.Commands = cli.Commands{
+		{
+			Name:  "migrate",
+			Usage: "apply the migrations of the store schema, they are also applied when the agent starts",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "dry-run", Usage: "only report what would change"},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				return migrate(ctx, c, cliCtx.Bool("dry-run"))
+			},
+		}, {
+			Name:  "gc",
+			Usage: "remove the namespaces and interfaces left by failed operations on the node, the agent only lists them when it starts",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "dry-run", Usage: "only list the orphans"},
+				cli.DurationFlag{Name: "grace-period", Value: 30 * time.Second, Usage: "only collect the orphans still found after this period"},
+			},
+			Action: func(cliCtx *cli.Context) error {
+				return collectGarbage(ctx, c, cliCtx.Bool("dry-run"), cliCtx.Duration("grace-period"))
+			},
+		},
+	}
+	err = app.Run(os.Args)
 	if err != nil {
-		log.WithError(err).Error("fail to initialize store watcher")
+		log.WithError(err).Error("fail to run sand-agent")
+		os.Exit(-1)
 	}
-	peerListener := overlay.NewNetworkEndpointListener(ctx, c, endpointsWatcher, dataStore)
+}
 
-	managers := netmanager.NewManagerMap()
-	managers.Set(types.OverlayNetworkType, overlay.NewManager(c, peerListener))
+func runAgent(ctx context.Context, c *config.Config) {
+	log := logger.Get(ctx)
+
+	_, err := overlay.VNIRanges(c, false)
+	if err != nil {
+		log.WithError(err).Error("invalid VNI ranges")
+		os.Exit(-1)
+	}
+	if c.VxLANPort == 0 {
+		log.Error("invalid VXLAN_PORT")
+		os.Exit(-1)
+	}
+	err = overlay.CheckVxLANPorts(c.VxLANPort, c.VxLANSourcePortRange)
+	if err != nil {
+		log.WithError(err).Error("invalid VxLAN ports")
+		os.Exit(-1)
+	}
+	if c.NeighborResolution != config.NeighborResolutionEager && c.NeighborResolution != config.NeighborResolutionOnDemand {
+		log.Errorf("invalid NEIGHBOR_RESOLUTION '%v', must be %s or %s", c.NeighborResolution, config.NeighborResolutionEager, config.NeighborResolutionOnDemand)
+		os.Exit(-1)
+	}
 
-	etcdClient, err := etcd.NewClient()
+	backend, err := newStoreBackend(c)
 	if err != nil {
-		log.WithError(err).Error("fail to initialize etcd client")
+		log.WithError(err).Error("fail to initialize store")
 		os.Exit(-1)
 	}
+	dataStore, locker := backend.store, backend.locker
 
-	locker := lock.NewEtcdLocker(etcdClient)
-	ipAllocator := ipallocator.New(c, dataStore, locker)
+	_, err = migrations.New(dataStore, locker).Run(ctx, false)
+	if err != nil {
+		log.WithError(err).Error("fail to migrate store schema")
+		os.Exit(-1)
+	}
+
+	// The prefix covers the networks (/network/<id>) and their endpoints
+	// (/network-endpoints/<id>/)
+	watcherOpts := []store.WatcherOpt{store.WithPrefix("/network")}
+	if builder, ok := dataStore.(store.EtcdWatcherBuilder); ok {
+		watcherOpts = append(watcherOpts, store.WithEtcdWatcherBuilder(builder))
+	}
+	endpointsWatcher, err := store.NewWatcher(ctx, c, watcherOpts...)
+	if err != nil {
+		log.WithError(err).Error("fail to initialize store watcher")
+		os.Exit(-1)
+	}
+	expvar.Publish("watcher", expvar.Func(func() interface{} {
+		return endpointsWatcher.Metrics()
+	}))
+	peerListener := overlay.NewNetworkEndpointListener(ctx, c, endpointsWatcher, dataStore)
+
+	managers := netmanager.NewManagerMap()
+	managers.Set(types.OverlayNetworkType, overlay.NewManager(c, peerListener))
+
+	ipAllocator := ipallocator.New(c, dataStore)
 
 	endpointRepository := endpoint.NewRepository(c, dataStore, managers)
 	networkRepository := network.NewRepository(c, dataStore, managers)
 
+	// Nothing is being created yet, the interfaces which are not in the store
+	// are orphans. They are only reported: with an empty or wrong store, the
+	// interfaces of all the networks of the node would be removed.
+	orphans, err := gc.NewCollector(c, networkRepository, endpointRepository, 0).Run(ctx, true)
+	if err != nil {
+		log.WithError(err).Error("fail to list orphaned namespaces and interfaces")
+	}
+	for _, orphan := range orphans {
+		log.WithFields(logrus.Fields{
+			"orphan_kind":      orphan.Kind,
+			"orphan_name":      orphan.Name,
+			"orphan_namespace": orphan.Namespace,
+		}).Warn("orphan found, `sand-agent gc` removes it")
+	}
+
 	err = ensureNetworks(ctx, c, networkRepository, endpointRepository)
 	if err != nil {
 		log.WithError(err).Error("fail to ensure existing networks")
 		os.Exit(-1)
 	}
 
+	driftReconciler := reconciler.New(c, networkRepository, endpointRepository, managers)
+	expvar.Publish("reconciler", expvar.Func(func() interface{} {
+		return driftReconciler.Metrics()
+	}))
+	reconcilerCtx, stopReconciler := context.WithCancel(ctx)
+	go driftReconciler.Run(reconcilerCtx)
+
 	vctrl := web.NewVersionController(c)
+	mctrl := web.NewMetricsController()
+	sctrl := web.NewStateController(c, state.NewRepository(c, dataStore))
 	nctrl := web.NewNetworksController(c, networkRepository, endpointRepository, ipAllocator)
 	ectrl := web.NewEndpointsController(c, networkRepository, endpointRepository, ipAllocator)
 
 	sandRouter := handlers.NewRouter(log)
 	sandRouter.Use(handlers.ErrorMiddleware)
 	sandRouter.HandleFunc("/version", vctrl.Show).Methods("GET")
+	sandRouter.HandleFunc("/debug/vars", mctrl.Show).Methods("GET")
 	sandRouter.HandleFunc("/networks", nctrl.List).Methods("GET")
 	sandRouter.HandleFunc("/networks", nctrl.Create).Methods("POST")
 	sandRouter.HandleFunc("/networks/{id}", nctrl.Show).Methods("GET")
+	sandRouter.HandleFunc("/networks/{id}", nctrl.Update).Methods("PATCH")
 	sandRouter.HandleFunc("/networks/{id}", nctrl.Destroy).Methods("DELETE")
 	sandRouter.HandleFunc("/networks/{id}", nctrl.Connect).Methods("CONNECT")
+	sandRouter.HandleFunc("/networks/{id}/subnets", nctrl.AddSubnet).Methods("POST")
+	sandRouter.HandleFunc("/networks/{id}/subnets/widen", nctrl.WidenSubnet).Methods("POST")
+	sandRouter.HandleFunc("/networks/{id}/allocations", nctrl.Allocations).Methods("GET")
+	sandRouter.HandleFunc("/networks/{id}/allocations/repair", nctrl.RepairAllocations).Methods("POST")
+	sandRouter.HandleFunc("/networks/{id}/ipam", nctrl.IPAM).Methods("GET")
+	sandRouter.HandleFunc("/networks/{id}/reservations/{key}", nctrl.ReleaseReservation).Methods("DELETE")
+	sandRouter.HandleFunc("/vni-reservations", nctrl.VNIReservations).Methods("GET")
+	sandRouter.HandleFunc("/vni-reservations", nctrl.ReserveVNI).Methods("POST")
+	sandRouter.HandleFunc("/vni-reservations/{vni}", nctrl.ReleaseVNIReservation).Methods("DELETE")
 	sandRouter.HandleFunc("/endpoints", ectrl.Create).Methods("POST")
 	sandRouter.HandleFunc("/endpoints", ectrl.List).Methods("GET")
 	sandRouter.HandleFunc("/endpoints/{id}", ectrl.Destroy).Methods("DELETE")
+	sandRouter.HandleFunc("/state/export", sctrl.Export).Methods("GET")
+	sandRouter.HandleFunc("/state/import", sctrl.Import).Methods("POST")
 
 	log.WithField("port", c.HTTPPort).Info("Listening")
 	serviceEndpoint := fmt.Sprintf(":%d", c.HTTPPort)
@@ -170,8 +286,14 @@ func main() {
 		os.Exit(-1)
 	}
 	log.Info("HTTP API stopped")
+	stopReconciler()
 	log.Info("Stop watching etcd changes")
 	endpointsWatcher.Close()
+	log.Info("Close store")
+	err = backend.Close()
+	if err != nil {
+		log.WithError(err).Error("fail to close store")
+	}
 	log.Info("All APIs stopped, shutting down..")
 }
 
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/Scalingo/go-etcd-lock/v5/lock"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/etcd"
+	"github.com/Scalingo/sand/store"
+)
+
+// storeBackend gathers the store selected in the configuration and the
+// resources it relies on. A single etcd client is shared by the store, the
+// watcher and the lockers.
+type storeBackend struct {
+	store      store.Store
+	locker     lock.Locker
+	etcdClient *clientv3.Client
+}
+
+func newStoreBackend(c *config.Config) (storeBackend, error) {
+	var b storeBackend
+	switch c.StoreBackend {
+	case "", store.EtcdBackend:
+		etcdClient, err := etcd.NewClient()
+		if err != nil {
+			return b, errors.Wrapf(err, "fail to initialize etcd client")
+		}
+		b.etcdClient = etcdClient
+		b.locker = lock.NewEtcdLocker(etcdClient)
+	default:
+		b.locker = store.NewMemoryLocker()
+	}
+
+	s, err := store.NewBackend(c, b.etcdClient)
+	if err != nil {
+		b.Close()
+		return b, errors.Wrapf(err, "fail to initialize store")
+	}
+	b.store = s
+	return b, nil
+}
+
+// Close releases the etcd client and the store file, it is called once the
+// agent has gracefully stopped
+func (b storeBackend) Close() error {
+	if b.etcdClient != nil {
+		err := b.etcdClient.Close()
+		if err != nil {
+			return errors.Wrapf(err, "fail to close etcd client")
+		}
+	}
+	if closer, ok := b.store.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			return errors.Wrapf(err, "fail to close store")
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	etcdutils "github.com/Scalingo/go-utils/etcd"
 
@@ -11,6 +12,11 @@ import (
 
 var Version = "v1.1.4"
 
+const (
+	NeighborResolutionEager    = "eager"
+	NeighborResolutionOnDemand = "on-demand"
+)
+
 type Config struct {
 	RollbarToken string
 	GoEnv        string `default:"development"`
@@ -36,11 +42,20 @@ type Config struct {
 	// to communicate with its API
 	APIHostname string `envconfig:"API_HOSTNAME"`
 
-	EtcdPrefix    string `default:"/sc-net"`
-	EtcdHosts     string `envconfig:"ETCD_HOSTS" default:"http://127.0.0.1:2379"`
-	EtcdTLSCACert string `envconfig:"ETCD_CACERT"`
-	EtcdTLSKey    string `envconfig:"ETCD_TLS_KEY"`
-	EtcdTLSCert   string `envconfig:"ETCD_TLS_CERT"`
+	// StoreBackend is where the state of SAND is stored: "etcd", "memory" or
+	// "file". The last two are only suited for single-node deployments or tests.
+	StoreBackend  string `envconfig:"STORE_BACKEND" default:"etcd"`
+	StoreFilePath string `envconfig:"STORE_FILE_PATH" default:"/var/lib/sand/store.json"`
+
+	// WatcherQueueSize is the number of store events queued for each network
+	// listener. When a listener is too slow and its queue is full, its events
+	// are dropped and the network is resynchronized from the store.
+	WatcherQueueSize int    `envconfig:"WATCHER_QUEUE_SIZE" default:"1000"`
+	EtcdPrefix       string `default:"/sc-net"`
+	EtcdHosts        string `envconfig:"ETCD_HOSTS" default:"http://127.0.0.1:2379"`
+	EtcdTLSCACert    string `envconfig:"ETCD_CACERT"`
+	EtcdTLSKey       string `envconfig:"ETCD_TLS_KEY"`
+	EtcdTLSCert      string `envconfig:"ETCD_TLS_CERT"`
 
 	HTTPTLSCert string `envconfig:"HTTP_TLS_CERT"`
 	HTTPTLSKey  string `envconfig:"HTTP_TLS_KEY"`
@@ -50,6 +65,43 @@ type Config struct {
 	DockerPluginHttpPort int  `default:"9998"`
 
 	MaxVNI int `envconfig:"MAX_VNI" default:"999_999"`
+	// VNIRanges are the ranges of VNIs allocated to the networks, like
+	// "1-4999,6000-9999". Default to all the VNIs up to MaxVNI which are not
+	// in VNIInfrastructureRanges.
+	VNIRanges string `envconfig:"VNI_RANGES"`
+	// VNIInfrastructureRanges are only allocated to the networks created with
+	// infrastructure set
+	VNIInfrastructureRanges string `envconfig:"VNI_INFRASTRUCTURE_RANGES"`
+
+	// VxLANPort is the UDP destination port of the VxLAN interfaces of the
+	// networks created without a port. VxLANSourcePortRange like
+	// "49152-65535" restricts their source ports, the kernel default range is
+	// used if it is empty. Both are saved with the network so that all the
+	// nodes agree on them.
+	VxLANPort            int    `envconfig:"VXLAN_PORT" default:"4789"`
+	VxLANSourcePortRange string `envconfig:"VXLAN_SOURCE_PORT_RANGE"`
+
+	// NeighborResolution is how the ARP/NDP and FDB entries of the remote
+	// endpoints are installed: "eager" installs the entries of all the
+	// endpoints of a network on every node, "on-demand" only installs them
+	// when the kernel misses them.
+	NeighborResolution string `envconfig:"NEIGHBOR_RESOLUTION" default:"eager"`
+
+	// ReconcileInterval is the period at which the kernel state of the
+	// networks and endpoints of the node is compared with the store and
+	// repaired, 0 disables the reconciler
+	ReconcileInterval time.Duration `envconfig:"RECONCILE_INTERVAL" default:"5m"`
+
+	// IPReservationTTL is how long the address of an endpoint created with a
+	// reservation key is kept for this key once the endpoint is deleted
+	IPReservationTTL time.Duration `envconfig:"IP_RESERVATION_TTL" default:"24h"`
+	// IPQuarantine is how long a released address is not allocated again, so
+	// that the neighbor tables of the peers and the connections of the
+	// clients forget it. It is only reused earlier when a pool is exhausted.
+	IPQuarantine time.Duration `envconfig:"IP_QUARANTINE" default:"5m"`
+	// IPUsageWarningThreshold is the percentage of the addresses of a pool
+	// which are not free from which the pool is reported as nearly exhausted
+	IPUsageWarningThreshold float64 `envconfig:"IP_USAGE_WARNING_THRESHOLD" default:"90"`
 }
 
 func Build() (*Config, error) {
@@ -98,6 +150,12 @@ func (c *Config) GetPeerHostname() string {
 	return c.PeerHostname
 }
 
+// OnDemandNeighbors returns true if the neighbors of the remote endpoints are
+// installed when the kernel misses them
+func (c *Config) OnDemandNeighbors() bool {
+	return c.NeighborResolution == NeighborResolutionOnDemand
+}
+
 func (c *Config) GetPeerIP() string {
 	if c.PeerIP == "" {
 		return c.PublicIP
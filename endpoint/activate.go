@@ -11,6 +11,12 @@ import (
 )
 
 func (r *repository) Activate(ctx context.Context, n types.Network, endpoint types.Endpoint, params params.EndpointActivate) (types.Endpoint, error) {
+	unlock := r.locks.lock(endpoint.ID)
+	defer unlock()
+	return r.activate(ctx, n, endpoint, params)
+}
+
+func (r *repository) activate(ctx context.Context, n types.Network, endpoint types.Endpoint, params params.EndpointActivate) (types.Endpoint, error) {
 	log := logger.Get(ctx)
 	log.Info("Activate endpoint")
 
@@ -29,16 +35,11 @@ func (r *repository) Activate(ctx context.Context, n types.Network, endpoint typ
 
 	endpoint.Active = true
 
-	err = r.store.Set(ctx, endpoint.StorageKey(), &endpoint)
+	err = r.save(ctx, endpoint)
 	if err != nil {
 		return endpoint, errors.Wrapf(err, "fail to save endpoint %s in store", endpoint)
 	}
 
-	err = r.store.Set(ctx, endpoint.NetworkStorageKey(), &endpoint)
-	if err != nil {
-		return endpoint, errors.Wrapf(err, "fail to save endpoint %s in store network", endpoint)
-	}
-
 	log.Info("Endpoint activated")
 	return endpoint, nil
 }
@@ -12,6 +12,14 @@ import (
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/api/params"
 	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/store"
+)
+
+var (
+	// ErrNotActivated is returned by Create when the activation of the stored
+	// endpoint failed and it couldn't be removed from the store, its addresses
+	// are still held by the stored endpoint
+	ErrNotActivated = errors.New("endpoint stored but not activated")
 )
 
 func (r *repository) Create(ctx context.Context, n types.Network, params params.EndpointCreate) (types.Endpoint, error) {
@@ -29,33 +37,40 @@ func (r *repository) Create(ctx context.Context, n types.Network, params params.
 	}
 
 	endpoint = types.Endpoint{
-		ID:            uuid.Must(uuid.NewV4()).String(),
-		Hostname:      r.config.GetPeerHostname(),
-		HostIP:        r.config.GetPeerIP(),
-		APIHostname:   r.config.APIHostname,
-		NetworkID:     n.ID,
-		CreatedAt:     time.Now(),
-		TargetVethIP:  params.IPv4Address,
-		TargetVethMAC: macAddress,
+		ID:             uuid.Must(uuid.NewV4()).String(),
+		Hostname:       r.config.GetPeerHostname(),
+		HostIP:         r.config.GetPeerIP(),
+		APIHostname:    r.config.APIHostname,
+		NetworkID:      n.ID,
+		CreatedAt:      time.Now(),
+		TargetVethIP:   params.IPv4Address,
+		TargetVethIPv6: params.IPv6Address,
+		TargetVethMAC:  macAddress,
+		ReservationKey: params.ReservationKey,
 	}
 	log = log.WithField("endpoint_id", endpoint.ID)
 	ctx = logger.ToCtx(ctx, log)
 
-	err = r.store.Set(ctx, endpoint.StorageKey(), &endpoint)
+	err = r.save(ctx, endpoint)
 	if err != nil {
 		return endpoint, errors.Wrapf(err, "fail to save endpoint %s in store", endpoint)
 	}
 
-	err = r.store.Set(ctx, endpoint.NetworkStorageKey(), &endpoint)
-	if err != nil {
-		return endpoint, errors.Wrapf(err, "fail to save endpoint %s in store network", endpoint)
-	}
-
 	if params.Activate {
-		endpoint, err = r.Activate(ctx, n, endpoint, params.ActivateParams)
-		if err != nil {
-			return endpoint, errors.Wrapf(err, "fail to ensure endpoint")
+		activated, activateErr := r.Activate(ctx, n, endpoint, params.ActivateParams)
+		if activateErr != nil {
+			// The endpoint is removed so that nothing holds its addresses anymore
+			err = r.store.Txn(ctx, nil,
+				store.OpDelete(endpoint.StorageKey()),
+				store.OpDelete(endpoint.NetworkStorageKey()),
+			)
+			if err != nil {
+				log.WithError(err).Error("fail to delete endpoint which can't be activated")
+				return endpoint, errors.Wrapf(ErrNotActivated, "fail to ensure endpoint: %v", activateErr)
+			}
+			return endpoint, errors.Wrapf(activateErr, "fail to ensure endpoint")
 		}
+		endpoint = activated
 	}
 
 	log.Info("Endpoint created")
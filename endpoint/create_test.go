@@ -0,0 +1,85 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/network/netmanager"
+	"github.com/Scalingo/sand/store"
+	"github.com/Scalingo/sand/store/storemock"
+	"github.com/Scalingo/sand/test/mocks/network/netmanagermock"
+)
+
+func TestRepository_Create(t *testing.T) {
+	network := types.Network{ID: "net-1", Type: types.OverlayNetworkType}
+	createParams := params.EndpointCreate{
+		NetworkID:      network.ID,
+		IPv4Address:    "10.0.0.2/24",
+		Activate:       true,
+		ActivateParams: params.EndpointActivate{NSHandlePath: "/var/run/netns/ep-1"},
+	}
+
+	cases := []struct {
+		Name        string
+		ExpectStore func(s *storemock.MockStore)
+		Error       error
+	}{
+		{
+			Name: "it should delete the stored endpoint if its activation fails",
+			ExpectStore: func(s *storemock.MockStore) {
+				gomock.InOrder(
+					s.EXPECT().Txn(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Any()).Return(nil),
+					s.EXPECT().Txn(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Any()).DoAndReturn(
+						func(_ context.Context, _ []store.Compare, ops ...store.Op) error {
+							for _, op := range ops {
+								assert.Equal(t, store.OpTypeDelete, op.Type)
+							}
+							return nil
+						},
+					),
+				)
+			},
+		}, {
+			Name: "it should report the stored endpoint if it can't be deleted",
+			ExpectStore: func(s *storemock.MockStore) {
+				gomock.InOrder(
+					s.EXPECT().Txn(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Any()).Return(nil),
+					s.EXPECT().Txn(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Any()).Return(errors.New("etcd error")),
+				)
+			},
+			Error: ErrNotActivated,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			m := netmanagermock.NewMockNetManager(ctrl)
+			managers := netmanager.NewManagerMap()
+			managers.Set(types.OverlayNetworkType, m)
+			s := storemock.NewMockStore(ctrl)
+
+			m.EXPECT().EnsureEndpoint(gomock.Any(), network, gomock.Any(), createParams.ActivateParams).Return(types.Endpoint{}, errors.New("netlink error"))
+			c.ExpectStore(s)
+
+			r := NewRepository(&config.Config{PeerHostname: "node-1"}, s, managers)
+			_, err := r.Create(context.Background(), network, createParams)
+			require.Error(t, err)
+			if c.Error != nil {
+				assert.Equal(t, c.Error, errors.Cause(err))
+			} else {
+				assert.Contains(t, err.Error(), "netlink error")
+			}
+		})
+	}
+}
@@ -11,6 +11,12 @@ import (
 )
 
 func (r *repository) Deactivate(ctx context.Context, n types.Network, e types.Endpoint) (types.Endpoint, error) {
+	unlock := r.locks.lock(e.ID)
+	defer unlock()
+	return r.deactivate(ctx, n, e)
+}
+
+func (r *repository) deactivate(ctx context.Context, n types.Network, e types.Endpoint) (types.Endpoint, error) {
 	log := logger.Get(ctx)
 	log.Info("Deactivate endpoint")
 
@@ -27,16 +33,11 @@ func (r *repository) Deactivate(ctx context.Context, n types.Network, e types.En
 	e.Active = false
 	e.TargetNetnsPath = ""
 
-	err = r.store.Set(ctx, e.StorageKey(), &e)
+	err = r.save(ctx, e)
 	if err != nil {
 		return e, errors.Wrapf(err, "fail to save endpoint %s in store", e)
 	}
 
-	err = r.store.Set(ctx, e.NetworkStorageKey(), &e)
-	if err != nil {
-		return e, errors.Wrapf(err, "fail to save endpoint %s in store network", e)
-	}
-
 	log.Info("Endpoint deactivated")
 	return e, nil
 }
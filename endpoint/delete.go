@@ -7,6 +7,8 @@ import (
 
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/store"
 )
 
 var (
@@ -15,16 +17,22 @@ var (
 
 type DeleteOpts struct {
 	ForceDeactivation bool
+	// IPAllocator releases the addresses of the deleted endpoint if set, the
+	// docker integration releases them through its IPAM driver instead
+	IPAllocator ipallocator.IPAllocator
 }
 
 func (r *repository) Delete(ctx context.Context, n types.Network, e types.Endpoint, opts DeleteOpts) error {
 	log := logger.Get(ctx)
 	log.Info("Delete endpoint")
 
+	unlock := r.locks.lock(e.ID)
+	defer unlock()
+
 	var err error
 
 	if opts.ForceDeactivation {
-		e, err = r.Deactivate(ctx, n, e)
+		e, err = r.deactivate(ctx, n, e)
 		if err != nil {
 			return errors.Wrapf(err, "fail to deactivate endpoint")
 		}
@@ -34,16 +42,39 @@ func (r *repository) Delete(ctx context.Context, n types.Network, e types.Endpoi
 		return ErrActivated
 	}
 
-	err = r.store.Delete(ctx, e.StorageKey())
+	// Both indexes of the endpoint are removed together
+	err = r.store.Txn(ctx, nil,
+		store.OpDelete(e.StorageKey()),
+		store.OpDelete(e.NetworkStorageKey()),
+	)
 	if err != nil {
-		return errors.Wrapf(err, "fail to delete endpoint storage key")
+		return errors.Wrapf(err, "fail to delete endpoint storage keys")
 	}
 
-	err = r.store.Delete(ctx, e.NetworkStorageKey())
-	if err != nil {
-		return errors.Wrapf(err, "fail to delete endpoint storage key")
+	if opts.IPAllocator != nil {
+		ReleaseIPs(ctx, opts.IPAllocator, n, e)
 	}
 
 	log.Info("Endpoint deleted")
 	return nil
 }
+
+// ReleaseIPs releases the addresses of the endpoint in the IP pools of the
+// network. A failure only leaks the address, it is logged and reported by the
+// reconciliation of the allocations.
+func ReleaseIPs(ctx context.Context, allocator ipallocator.IPAllocator, n types.Network, e types.Endpoint) {
+	log := logger.Get(ctx)
+	pools := map[string]string{n.ID: e.TargetVethIP}
+	if e.TargetVethIPv6 != "" {
+		pools[n.IPv6PoolID()] = e.TargetVethIPv6
+	}
+	for id, address := range pools {
+		if address == "" {
+			continue
+		}
+		err := allocator.ReleaseIP(ctx, id, address)
+		if err != nil {
+			log.WithError(err).Errorf("fail to release IP %v of endpoint %v", address, e.ID)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package endpoint
+
+import "sync"
+
+// endpointLocks serializes the operations done on the same endpoint by the
+// API and the reconciler of the node
+type endpointLocks struct {
+	mutex sync.Mutex
+	locks map[string]*endpointLock
+}
+
+type endpointLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newEndpointLocks() *endpointLocks {
+	return &endpointLocks{locks: map[string]*endpointLock{}}
+}
+
+// lock waits for the lock of the endpoint and returns the function releasing
+// it, the lock is dropped once nobody holds or waits for it
+func (l *endpointLocks) lock(id string) func() {
+	l.mutex.Lock()
+	el, ok := l.locks[id]
+	if !ok {
+		el = &endpointLock{}
+		l.locks[id] = el
+	}
+	el.refs++
+	l.mutex.Unlock()
+
+	el.Lock()
+	return func() {
+		el.Unlock()
+		l.mutex.Lock()
+		el.refs--
+		if el.refs == 0 {
+			delete(l.locks, id)
+		}
+		l.mutex.Unlock()
+	}
+}
@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+)
+
+// Repair recreates the interfaces of an active endpoint of the node, it is
+// deactivated if its target namespace doesn't exist anymore. The endpoint is
+// read again under its lock, so an endpoint deactivated or deleted through the
+// API in the meantime is left untouched.
+func (r *repository) Repair(ctx context.Context, n types.Network, id string) error {
+	unlock := r.locks.lock(id)
+	defer unlock()
+
+	e, ok, err := r.Exists(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get endpoint")
+	}
+	if !ok || !e.Active {
+		logger.Get(ctx).Info("Endpoint is not active anymore, skip repair")
+		return nil
+	}
+
+	_, err = r.activate(ctx, n, e, params.EndpointActivate{
+		NSHandlePath: e.TargetNetnsPath,
+		SetAddr:      true,
+		MoveVeth:     true,
+	})
+	if os.IsNotExist(errors.Cause(err)) {
+		_, err = r.deactivate(ctx, n, e)
+		if err != nil {
+			return errors.Wrapf(err, "fail to deactivate endpoint without target namespace")
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to activate endpoint")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package endpoint
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/network/netmanager"
+	"github.com/Scalingo/sand/store"
+	"github.com/Scalingo/sand/store/storemock"
+	"github.com/Scalingo/sand/test/mocks/network/netmanagermock"
+)
+
+func TestRepository_Repair(t *testing.T) {
+	network := types.Network{ID: "net-1", Type: types.OverlayNetworkType}
+	endpoint := types.Endpoint{ID: "ep-1", NetworkID: "net-1", Hostname: "node-1", Active: true, TargetNetnsPath: "/var/run/netns/ep-1"}
+	activateParams := params.EndpointActivate{NSHandlePath: endpoint.TargetNetnsPath, SetAddr: true, MoveVeth: true}
+
+	cases := []struct {
+		Name             string
+		Stored           *types.Endpoint
+		ExpectNetManager func(m *netmanagermock.MockNetManager)
+		ExpectSaved      *types.Endpoint
+		Error            string
+	}{
+		{
+			Name:   "it should not repair a deleted endpoint",
+			Stored: nil,
+		}, {
+			Name:   "it should not repair an endpoint deactivated in the meantime",
+			Stored: &types.Endpoint{ID: "ep-1", NetworkID: "net-1", Hostname: "node-1"},
+		}, {
+			Name:   "it should activate again an active endpoint",
+			Stored: &endpoint,
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().EnsureEndpoint(gomock.Any(), network, endpoint, activateParams).Return(endpoint, nil)
+			},
+			ExpectSaved: &endpoint,
+		}, {
+			Name:   "it should deactivate an endpoint whose target namespace is gone",
+			Stored: &endpoint,
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().EnsureEndpoint(gomock.Any(), network, endpoint, activateParams).Return(endpoint, errors.Wrap(os.ErrNotExist, "fail to get target namespace"))
+				m.EXPECT().DeleteEndpoint(gomock.Any(), network, endpoint).Return(nil)
+			},
+			ExpectSaved: &types.Endpoint{ID: "ep-1", NetworkID: "net-1", Hostname: "node-1"},
+		}, {
+			Name:   "it should return the errors of the activation",
+			Stored: &endpoint,
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().EnsureEndpoint(gomock.Any(), network, endpoint, activateParams).Return(endpoint, errors.New("netlink error"))
+			},
+			Error: "fail to activate endpoint",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			m := netmanagermock.NewMockNetManager(ctrl)
+			managers := netmanager.NewManagerMap()
+			managers.Set(types.OverlayNetworkType, m)
+			s := storemock.NewMockStore(ctrl)
+
+			s.EXPECT().Get(gomock.Any(), endpoint.StorageKey(), false, gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, _ bool, data interface{}) error {
+					if c.Stored == nil {
+						return store.ErrNotFound
+					}
+					*data.(*types.Endpoint) = *c.Stored
+					return nil
+				},
+			)
+			if c.ExpectNetManager != nil {
+				c.ExpectNetManager(m)
+			}
+			if c.ExpectSaved != nil {
+				s.EXPECT().Txn(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ []store.Compare, ops ...store.Op) error {
+						for _, op := range ops {
+							assert.Equal(t, c.ExpectSaved, op.Data)
+						}
+						return nil
+					},
+				)
+			}
+
+			r := NewRepository(&config.Config{PeerHostname: "node-1"}, s, managers)
+			err := r.Repair(context.Background(), network, "ep-1")
+			if c.Error != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), c.Error)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -20,6 +20,8 @@ type Repository interface {
 	Activate(context.Context, types.Network, types.Endpoint, params.EndpointActivate) (types.Endpoint, error)
 	Delete(context.Context, types.Network, types.Endpoint, DeleteOpts) error
 	Deactivate(context.Context, types.Network, types.Endpoint) (types.Endpoint, error)
+	// Repair recreates the interfaces of an active endpoint of the node
+	Repair(context.Context, types.Network, string) error
 
 	// If the endpoint has already been attach to the network in the kv store
 	Exists(context.Context, string) (types.Endpoint, bool, error)
@@ -29,8 +31,18 @@ type repository struct {
 	config   *config.Config
 	store    store.Store
 	managers netmanager.ManagerMap
+	locks    *endpointLocks
 }
 
 func NewRepository(config *config.Config, store store.Store, managers netmanager.ManagerMap) Repository {
-	return &repository{config: config, store: store, managers: managers}
+	return &repository{config: config, store: store, managers: managers, locks: newEndpointLocks()}
+}
+
+// save writes the endpoint in both its node and network indexes in a single
+// transaction, so they can't diverge
+func (r *repository) save(ctx context.Context, e types.Endpoint) error {
+	return r.store.Txn(ctx, nil,
+		store.OpSet(e.StorageKey(), &e),
+		store.OpSet(e.NetworkStorageKey(), &e),
+	)
 }
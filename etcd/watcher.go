@@ -8,43 +8,45 @@ import (
 )
 
 type Watcher struct {
-	client    *clientv3.Client
-	watcher   clientv3.Watcher
-	watchChan clientv3.WatchChan
+	watcher clientv3.Watcher
+	prefix  string
+	cancel  context.CancelFunc
 }
 
-func NewWatcher(prefix string) (Watcher, error) {
-	client, err := NewClient()
-	if err != nil {
-		return Watcher{}, errors.Wrapf(err, "fail to create etcd client")
+// NewWatcher watches the keys with the given prefix. The client is owned by
+// the caller and is not closed with the watcher.
+func NewWatcher(client *clientv3.Client, prefix string) *Watcher {
+	return &Watcher{
+		watcher: clientv3.NewWatcher(client),
+		prefix:  prefix,
 	}
-	wc := clientv3.NewWatcher(client)
+}
 
+// Watch starts watching the prefix from revision rev, or from the current
+// revision if rev is 0. The channel returned by a previous call is closed.
+func (w *Watcher) Watch(rev int64) clientv3.WatchChan {
+	if w.cancel != nil {
+		w.cancel()
+	}
 	// Use context.Background() to avoid the resulting chan to be closed at the end of a HTTP request
 	// https://godoc.org/go.etcd.io/etcd/v3/clientv3#Watcher
-	wchan := wc.Watch(context.Background(), prefix, clientv3.WithPrefix())
-
-	return Watcher{
-		client:    client,
-		watcher:   wc,
-		watchChan: wchan,
-	}, nil
-}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
 
-func (w Watcher) WatchChan() clientv3.WatchChan {
-	return w.watchChan
+	// The creation notification gives the revision the watch started from
+	opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithCreatedNotify()}
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+	// If the etcd member gets partitioned from the cluster, the watch is
+	// canceled instead of hanging, so it can be resumed on another member.
+	return w.watcher.Watch(clientv3.WithRequireLeader(ctx), w.prefix, opts...)
 }
 
-func (w Watcher) Close() error {
+func (w *Watcher) Close() error {
 	err := w.watcher.Close()
 	if err != nil {
 		return errors.Wrapf(err, "fail to close etcd watcher")
 	}
-
-	err = w.client.Close()
-	if err != nil {
-		return errors.Wrapf(err, "fail to close etcd client")
-	}
-
 	return nil
 }
@@ -0,0 +1,286 @@
+// Package gc removes the namespaces and interfaces left on the node by
+// failed operations: VxLAN interfaces never moved to the namespace of their
+// network, namespace handles of deleted networks and veths of deleted
+// endpoints
+package gc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/endpoint"
+	"github.com/Scalingo/sand/netnsbuilder"
+	"github.com/Scalingo/sand/netutils"
+	"github.com/Scalingo/sand/network"
+	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
+)
+
+// VethPrefix is the prefix of the names of the veths of the endpoints
+const VethPrefix = "sand"
+
+// vxlanInHostName matches the names given by the overlay manager to the VxLAN
+// interfaces it creates in the root namespace, the other interfaces named
+// vxlan-* aren't managed by SAND
+var vxlanInHostName = regexp.MustCompile(`^` + regexp.QuoteMeta(overlay.VxLANInHostPrefix) + `[0-9]{5}$`)
+
+type OrphanKind string
+
+const (
+	OrphanNamespace OrphanKind = "namespace"
+	OrphanVxLAN     OrphanKind = "vxlan"
+	OrphanVeth      OrphanKind = "veth"
+)
+
+// Orphan is a namespace handle or an interface without network or endpoint
+// in the store. Name is the path of a namespace handle or the name of an
+// interface, Namespace is the namespace handle of the interface, empty for
+// the root namespace.
+type Orphan struct {
+	Kind      OrphanKind
+	Name      string
+	Namespace string
+}
+
+// nodeState are the namespace handles of the networks and the interfaces
+// which may be orphans
+type nodeState struct {
+	Namespaces []string
+	RootLinks  []string
+	// NamespaceLinks are the links of the namespaces of the networks of the
+	// store, by namespace handle
+	NamespaceLinks map[string][]string
+}
+
+type Collector struct {
+	config      *config.Config
+	networks    network.Repository
+	endpoints   endpoint.Repository
+	gracePeriod time.Duration
+}
+
+// NewCollector returns a collector of the orphans found by two listings
+// gracePeriod apart. A running agent creates interfaces before saving them in
+// the store, they are listed once but are gone or saved in the second
+// listing.
+func NewCollector(c *config.Config, networks network.Repository, endpoints endpoint.Repository, gracePeriod time.Duration) Collector {
+	return Collector{config: c, networks: networks, endpoints: endpoints, gracePeriod: gracePeriod}
+}
+
+// Run lists the orphans of the node and removes them unless dryRun is set.
+// The removal of an orphan doesn't stop if another one fails.
+func (c Collector) Run(ctx context.Context, dryRun bool) ([]Orphan, error) {
+	log := logger.Get(ctx)
+
+	orphans, err := c.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.gracePeriod > 0 && len(orphans) > 0 {
+		log.WithField("grace_period", c.gracePeriod).Info("orphans found, wait before listing them again")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.gracePeriod):
+		}
+		again, err := c.list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		orphans = stillOrphans(orphans, again)
+	}
+	if dryRun {
+		return orphans, nil
+	}
+
+	failures := 0
+	for _, orphan := range orphans {
+		log := log.WithFields(logrus.Fields{
+			"orphan_kind":      orphan.Kind,
+			"orphan_name":      orphan.Name,
+			"orphan_namespace": orphan.Namespace,
+		})
+		err := remove(ctx, orphan)
+		if err != nil {
+			failures++
+			log.WithError(err).Error("fail to remove orphan")
+			continue
+		}
+		log.Info("orphan removed")
+	}
+	if failures > 0 {
+		return orphans, errors.Errorf("fail to remove %d of %d orphans", failures, len(orphans))
+	}
+	return orphans, nil
+}
+
+// list compares the namespaces and interfaces of the node with the store
+func (c Collector) list(ctx context.Context) ([]Orphan, error) {
+	networks, err := c.networks.List(ctx)
+	if err != nil && errors.Cause(err) != store.ErrNotFound {
+		return nil, errors.Wrapf(err, "fail to list networks")
+	}
+	endpoints, err := c.endpoints.List(ctx, map[string]string{"hostname": c.config.GetPeerHostname()})
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list endpoints of %v", c.config.GetPeerHostname())
+	}
+
+	state, err := c.nodeState(networks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get namespaces and interfaces of the node")
+	}
+	return findOrphans(state, networks, endpoints), nil
+}
+
+// stillOrphans returns the orphans of the second listing which were already
+// in the first one
+func stillOrphans(first, second []Orphan) []Orphan {
+	found := map[Orphan]bool{}
+	for _, orphan := range first {
+		found[orphan] = true
+	}
+	var orphans []Orphan
+	for _, orphan := range second {
+		if found[orphan] {
+			orphans = append(orphans, orphan)
+		}
+	}
+	return orphans
+}
+
+func (c Collector) nodeState(networks []types.Network) (nodeState, error) {
+	state := nodeState{NamespaceLinks: map[string][]string{}}
+
+	files, err := os.ReadDir(c.config.NetnsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return state, errors.Wrapf(err, "fail to list %v", c.config.NetnsPath)
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), c.config.NetnsPrefix) {
+			state.Namespaces = append(state.Namespaces, filepath.Join(c.config.NetnsPath, file.Name()))
+		}
+	}
+
+	links, err := netlink.LinkList()
+	if err != nil {
+		return state, errors.Wrapf(err, "fail to list links of the root namespace")
+	}
+	for _, link := range links {
+		state.RootLinks = append(state.RootLinks, link.Attrs().Name)
+	}
+
+	for _, network := range networks {
+		nsfd, err := netns.GetFromPath(network.NSHandlePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return state, errors.Wrapf(err, "fail to get namespace handler of %s", network)
+		}
+		links, err := namespaceLinks(nsfd)
+		nsfd.Close()
+		if err != nil {
+			return state, errors.Wrapf(err, "fail to list links of %s", network)
+		}
+		state.NamespaceLinks[network.NSHandlePath] = links
+	}
+	return state, nil
+}
+
+func namespaceLinks(nsfd netns.NsHandle) ([]string, error) {
+	nlh, err := netlink.NewHandleAt(nsfd, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get netlink handler of netns")
+	}
+	defer nlh.Delete()
+
+	links, err := nlh.LinkList()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list links")
+	}
+	var names []string
+	for _, link := range links {
+		names = append(names, link.Attrs().Name)
+	}
+	return names, nil
+}
+
+// findOrphans compares the state of the node with the networks and the
+// endpoints of the node in the store
+func findOrphans(state nodeState, networks []types.Network, endpoints []types.Endpoint) []Orphan {
+	var orphans []Orphan
+
+	namespaces := map[string]bool{}
+	for _, network := range networks {
+		namespaces[network.NSHandlePath] = true
+	}
+	for _, path := range state.Namespaces {
+		if !namespaces[path] {
+			orphans = append(orphans, Orphan{Kind: OrphanNamespace, Name: path})
+		}
+	}
+
+	// The target veths of the endpoints activated without moving them stay in
+	// the root namespace
+	targetVeths := map[string]bool{}
+	overlayVeths := map[string]map[string]bool{}
+	for _, endpoint := range endpoints {
+		targetVeths[endpoint.TargetVethName] = true
+		if overlayVeths[endpoint.NetworkID] == nil {
+			overlayVeths[endpoint.NetworkID] = map[string]bool{}
+		}
+		overlayVeths[endpoint.NetworkID][endpoint.OverlayVethName] = true
+	}
+	for _, name := range state.RootLinks {
+		switch {
+		case vxlanInHostName.MatchString(name):
+			// VxLAN interfaces are moved to the namespace of their network right
+			// after their creation
+			orphans = append(orphans, Orphan{Kind: OrphanVxLAN, Name: name})
+		case strings.HasPrefix(name, VethPrefix) && !targetVeths[name]:
+			orphans = append(orphans, Orphan{Kind: OrphanVeth, Name: name})
+		}
+	}
+
+	for _, network := range networks {
+		for _, name := range state.NamespaceLinks[network.NSHandlePath] {
+			if strings.HasPrefix(name, VethPrefix) && !overlayVeths[network.ID][name] {
+				orphans = append(orphans, Orphan{Kind: OrphanVeth, Name: name, Namespace: network.NSHandlePath})
+			}
+		}
+	}
+	return orphans
+}
+
+func remove(ctx context.Context, orphan Orphan) error {
+	if orphan.Kind == OrphanNamespace {
+		return netnsbuilder.UnmountNetworkNamespace(ctx, orphan.Name)
+	}
+
+	var nsfd netns.NsHandle
+	var err error
+	if orphan.Namespace == "" {
+		nsfd, err = netns.Get()
+	} else {
+		nsfd, err = netns.GetFromPath(orphan.Namespace)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to get namespace handler")
+	}
+	defer nsfd.Close()
+
+	return netutils.DeleteInterfaceIfExists(ctx, nsfd, orphan.Name)
+}
@@ -0,0 +1,86 @@
+package gc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Scalingo/sand/api/types"
+)
+
+func TestFindOrphans(t *testing.T) {
+	networks := []types.Network{
+		{ID: "net-1", NSHandlePath: "/var/run/netns/sc-ns-net-1"},
+		{ID: "net-2", NSHandlePath: "/var/run/netns/sc-ns-net-2"},
+	}
+	endpoints := []types.Endpoint{
+		{ID: "ep-1", NetworkID: "net-1", OverlayVethName: "sand0001", TargetVethName: "sand0002"},
+		{ID: "ep-2", NetworkID: "net-2", OverlayVethName: "sand0003", TargetVethName: "sand0004"},
+	}
+
+	cases := []struct {
+		Name    string
+		State   nodeState
+		Orphans []Orphan
+	}{
+		{
+			Name: "the namespaces and interfaces of the store are not orphans",
+			State: nodeState{
+				Namespaces: []string{"/var/run/netns/sc-ns-net-1", "/var/run/netns/sc-ns-net-2"},
+				RootLinks:  []string{"lo", "eth0", "sand0004"},
+				NamespaceLinks: map[string][]string{
+					"/var/run/netns/sc-ns-net-1": {"lo", "br0", "vxlan0", "sand0001"},
+					"/var/run/netns/sc-ns-net-2": {"lo", "br0", "vxlan0", "sand0003"},
+				},
+			},
+		}, {
+			Name: "the namespace handle of a deleted network is an orphan",
+			State: nodeState{
+				Namespaces: []string{"/var/run/netns/sc-ns-net-1", "/var/run/netns/sc-ns-net-3"},
+			},
+			Orphans: []Orphan{{Kind: OrphanNamespace, Name: "/var/run/netns/sc-ns-net-3"}},
+		}, {
+			Name: "VxLAN interfaces and unknown veths of the root namespace are orphans",
+			State: nodeState{
+				RootLinks: []string{"eth0", "vxlan-04217", "sand0002", "sand0005"},
+			},
+			Orphans: []Orphan{
+				{Kind: OrphanVxLAN, Name: "vxlan-04217"},
+				{Kind: OrphanVeth, Name: "sand0005"},
+			},
+		}, {
+			Name: "interfaces of the root namespace not named like the VxLAN interfaces of SAND are not orphans",
+			State: nodeState{
+				RootLinks: []string{"vxlan-foo", "vxlan-421", "vxlan-042170"},
+			},
+		}, {
+			Name: "veths of a network namespace without endpoint of this network are orphans",
+			State: nodeState{
+				NamespaceLinks: map[string][]string{
+					"/var/run/netns/sc-ns-net-1": {"br0", "vxlan0", "sand0001", "sand0003", "sand0006"},
+				},
+			},
+			Orphans: []Orphan{
+				{Kind: OrphanVeth, Name: "sand0003", Namespace: "/var/run/netns/sc-ns-net-1"},
+				{Kind: OrphanVeth, Name: "sand0006", Namespace: "/var/run/netns/sc-ns-net-1"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			orphans := findOrphans(tc.State, networks, endpoints)
+			assert.Equal(t, tc.Orphans, orphans)
+		})
+	}
+}
+
+func TestStillOrphans(t *testing.T) {
+	vxlan := Orphan{Kind: OrphanVxLAN, Name: "vxlan-04217"}
+	created := Orphan{Kind: OrphanVxLAN, Name: "vxlan-01234"}
+	veth := Orphan{Kind: OrphanVeth, Name: "sand0003", Namespace: "/var/run/netns/sc-ns-net-1"}
+	saved := Orphan{Kind: OrphanVeth, Name: "sand0005"}
+
+	orphans := stillOrphans([]Orphan{vxlan, saved, veth}, []Orphan{vxlan, veth, created})
+	assert.Equal(t, []Orphan{vxlan, veth}, orphans, "the interfaces created or saved in the meantime should not be orphans")
+}
@@ -3,96 +3,185 @@ package idmanager
 import (
 	"context"
 	"fmt"
-	"io"
 
+	"github.com/bits-and-blooms/bitset"
 	"github.com/pkg/errors"
 
-	etcdlock "github.com/Scalingo/go-etcd-lock/v5/lock"
-	"github.com/Scalingo/sand/etcd"
 	"github.com/Scalingo/sand/store"
 )
 
-var ErrNoIDAvailable = errors.New("no new ID available")
+const IDManagerPrefix = "/idmanager"
+
+var (
+	ErrNoIDAvailable = errors.New("no new ID available")
+	ErrIDUnavailable = errors.New("ID already allocated")
+)
 
 type Manager interface {
-	Lock(context.Context) (Unlocker, error)
-	Generate(context.Context) (int, error)
+	// Generate allocates the first free ID of ranges. The operations returned
+	// by ops for this ID are applied in the same transaction.
+	Generate(ctx context.Context, ranges []Range, ops func(id int) []store.Op) (int, error)
+	// Reserve allocates id in the same transaction as ops, ErrIDUnavailable is
+	// returned if it is already allocated
+	Reserve(ctx context.Context, id int, ops ...store.Op) error
+	// ReserveTxn returns the comparison and the operation which allocate ids
+	// in a transaction of the caller, it fails if the IDs are modified in the
+	// meantime. ErrIDUnavailable is returned if one of them is already
+	// allocated.
+	ReserveTxn(ctx context.Context, ids ...int) (store.Compare, store.Op, error)
+	// Release frees id in the same transaction as ops
+	Release(ctx context.Context, id int, ops ...store.Op) error
+	// Update calls fn with the current state of id, and sets it to the state
+	// returned by fn in the same transaction as the operations it returns.
+	// fn is called again if the IDs are modified concurrently, the keys it
+	// reads are then read again.
+	Update(ctx context.Context, id int, fn func(allocated bool) (bool, []store.Op, error)) error
+}
+
+// IDs is the bitmap of the allocated IDs as saved in the store
+type IDs struct {
+	BitSet *bitset.BitSet `json:"bit_set"`
 }
 
-type Unlocker interface {
-	Unlock(ctx context.Context) error
+// StorageKey is the key of the IDs of the manager name
+func StorageKey(name string) string {
+	return fmt.Sprintf("%s/%s", IDManagerPrefix, name)
 }
 
 type manager struct {
 	store      store.Store
 	maxIDValue int
-	field      string
 	name       string
-	prefix     string
 }
 
-type lock struct {
-	resourceLock   etcdlock.Lock
-	lockingBackend io.Closer
+func New(maxIDValue int, s store.Store, name string) Manager {
+	return &manager{maxIDValue: maxIDValue, store: s, name: name}
 }
 
-func New(maxIDValue int, s store.Store, name string, field string, prefix string) Manager {
-	return &manager{maxIDValue: maxIDValue, store: s, field: field, name: name, prefix: prefix}
+func (m *manager) Generate(ctx context.Context, ranges []Range, ops func(id int) []store.Op) (int, error) {
+	id := -1
+	err := m.update(ctx, func(ids *bitset.BitSet) ([]store.Op, error) {
+		var ok bool
+		id, ok = m.nextFree(ids, ranges)
+		if !ok {
+			return nil, ErrNoIDAvailable
+		}
+		ids.Set(uint(id))
+		return ops(id), nil
+	})
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to generate %s ID", m.name)
+	}
+	return id, nil
 }
 
-func (m *manager) Lock(ctx context.Context) (Unlocker, error) {
-	client, err := etcd.NewClient()
-	if err != nil {
-		return nil, errors.Wrapf(err, "fail to get etcd client")
+func (m *manager) Reserve(ctx context.Context, id int, ops ...store.Op) error {
+	if id < 1 || id > m.maxIDValue {
+		return errors.Errorf("invalid %s ID %d, it must be between 1 and %d", m.name, id, m.maxIDValue)
 	}
-	resourceLock, err := etcdlock.NewEtcdLocker(client).WaitAcquire(fmt.Sprintf("/%s-idgen", m.name), 300)
+	err := m.Update(ctx, id, func(allocated bool) (bool, []store.Op, error) {
+		if allocated {
+			return true, nil, ErrIDUnavailable
+		}
+		return true, ops, nil
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "fail to get etcd lock")
+		return errors.Wrapf(err, "fail to reserve %s ID %d", m.name, id)
 	}
-	return lock{
-		resourceLock:   resourceLock,
-		lockingBackend: client,
-	}, nil
+	return nil
 }
 
-func (l lock) Unlock(ctx context.Context) error {
-	if l.resourceLock == nil {
-		return errors.New("not locked")
+func (m *manager) ReserveTxn(ctx context.Context, ids ...int) (store.Compare, store.Op, error) {
+	key := StorageKey(m.name)
+	var allocated IDs
+	rev, err := m.store.GetModRevision(ctx, key, &allocated)
+	if err == store.ErrNotFound {
+		rev = 0
+	} else if err != nil {
+		return store.Compare{}, store.Op{}, errors.Wrapf(err, "fail to get IDs from storage")
 	}
-	lockErr := l.resourceLock.Release()
-	backendErr := l.lockingBackend.Close()
-	if lockErr != nil {
-		return errors.Wrapf(lockErr, "fail to release etcd lock, backendErr: %v", backendErr)
+	if allocated.BitSet == nil {
+		allocated.BitSet = bitset.New(0)
 	}
-	if backendErr != nil {
-		return errors.Wrapf(backendErr, "fail to close etcd client")
+	for _, id := range ids {
+		if id < 1 || id > m.maxIDValue {
+			return store.Compare{}, store.Op{}, errors.Errorf("invalid %s ID %d, it must be between 1 and %d", m.name, id, m.maxIDValue)
+		}
+		if allocated.BitSet.Test(uint(id)) {
+			return store.Compare{}, store.Op{}, errors.Wrapf(ErrIDUnavailable, "fail to reserve %s ID %d", m.name, id)
+		}
+		allocated.BitSet.Set(uint(id))
 	}
-	return nil
+	return store.CompareModRevision(key, rev), store.OpSet(key, &allocated), nil
 }
 
-func (m *manager) Generate(ctx context.Context) (int, error) {
-	var items []map[string]interface{}
-
-	// Retrieving the list of networks as a map of etcd keys to network objects
-	err := m.store.Get(ctx, m.prefix, true, &items)
-	if err == store.ErrNotFound {
-		return 1, nil
-	}
+func (m *manager) Release(ctx context.Context, id int, ops ...store.Op) error {
+	err := m.Update(ctx, id, func(bool) (bool, []store.Op, error) {
+		return false, ops, nil
+	})
 	if err != nil {
-		return -1, errors.Wrapf(err, "fail to get list of items with prefix %s from store", m.prefix)
+		return errors.Wrapf(err, "fail to release %s ID %d", m.name, id)
 	}
+	return nil
+}
 
-	// Generating a "set" of existing IDs
-	ids := map[int]bool{}
-	for _, item := range items {
-		ids[int(item[m.field].(float64))] = true
+func (m *manager) Update(ctx context.Context, id int, fn func(allocated bool) (bool, []store.Op, error)) error {
+	if id < 0 {
+		return errors.Errorf("invalid %s ID %d", m.name, id)
 	}
+	return m.update(ctx, func(ids *bitset.BitSet) ([]store.Op, error) {
+		allocated, ops, err := fn(ids.Test(uint(id)))
+		if err != nil {
+			return nil, err
+		}
+		if allocated {
+			ids.Set(uint(id))
+		} else {
+			ids.Clear(uint(id))
+		}
+		return ops, nil
+	})
+}
 
-	// Searching for the first available ID until the maximum
-	for i := 1; i <= m.maxIDValue; i++ {
-		if !ids[i] {
-			return i, nil
+// nextFree returns the first ID of ranges which is not allocated, ranges are
+// capped to the maximal ID value
+func (m *manager) nextFree(ids *bitset.BitSet, ranges []Range) (int, bool) {
+	for _, r := range ranges {
+		last := r.Last
+		if last > m.maxIDValue {
+			last = m.maxIDValue
+		}
+		if r.First < 1 || r.First > last {
+			continue
+		}
+		i, ok := ids.NextClear(uint(r.First))
+		if ok && int(i) <= last {
+			return int(i), true
 		}
 	}
-	return -1, ErrNoIDAvailable
+	return 0, false
+}
+
+// update reads the IDs, applies fn and saves the result with the operations
+// it returns if the IDs have not been modified in the meantime, in which case
+// fn is applied again on their new version
+func (m *manager) update(ctx context.Context, fn func(ids *bitset.BitSet) ([]store.Op, error)) error {
+	key := StorageKey(m.name)
+	var ids IDs
+	return store.Update(ctx, m.store, key, &ids, func(bool) ([]store.Op, error) {
+		if ids.BitSet == nil {
+			ids.BitSet = bitset.New(0)
+		}
+		// The bitmap covers all the IDs, NextClear does not look past its
+		// length
+		if ids.BitSet.Len() <= uint(m.maxIDValue) {
+			ids.BitSet.Set(uint(m.maxIDValue)).Clear(uint(m.maxIDValue))
+		}
+
+		ops, err := fn(ids.BitSet)
+		if err != nil {
+			return nil, err
+		}
+		return append([]store.Op{store.OpSet(key, &ids)}, ops...), nil
+	})
 }
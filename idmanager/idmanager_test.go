@@ -2,170 +2,151 @@ package idmanager
 
 import (
 	"context"
+	"sync"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/mock/gomock"
 
-	"github.com/Scalingo/sand/store/storemock"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
 )
 
 func TestManager_Generate(t *testing.T) {
-	t.Run("it should return the next available ID", func(t *testing.T) {
-		// Given
-		ctx := context.Background()
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-		existedIDs := []int{1, 2}
-		expectedID := 3
-
-		store := storemock.NewMockStore(ctrl)
-		manager := &manager{
-			field:      "value",
-			prefix:     "/test-id",
-			store:      store,
-			maxIDValue: 5,
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	noOps := func(int) []store.Op { return nil }
+
+	t.Run("it should return the first available ID of the ranges", func(t *testing.T) {
+		m := New(5, store.NewMemory(config), "test")
+		ranges := []Range{{First: 3, Last: 4}, {First: 1, Last: 1}}
+		for _, expected := range []int{3, 4, 1} {
+			id, err := m.Generate(ctx, ranges, noOps)
+			require.NoError(t, err)
+			assert.Equal(t, expected, id)
 		}
 
-		store.EXPECT().Get(gomock.Any(), manager.prefix, true, gomock.Any()).Do(
-			func(_ context.Context, _ string, _ bool, rawPtrItems interface{}) {
-				ptrItems, ok := rawPtrItems.(*[]map[string]interface{})
-				require.True(t, ok)
-				for _, id := range existedIDs {
-					*ptrItems = append(*ptrItems, map[string]interface{}{manager.field: float64(id)})
-				}
-			},
-		).Return(nil)
+		_, err := m.Generate(ctx, ranges, noOps)
+		assert.Equal(t, ErrNoIDAvailable, errors.Cause(err))
+	})
+
+	t.Run("maxIDValue should be allocable but not exceeded", func(t *testing.T) {
+		m := New(5, store.NewMemory(config), "test")
+		id, err := m.Generate(ctx, []Range{{First: 5, Last: 10}}, noOps)
+		require.NoError(t, err)
+		assert.Equal(t, 5, id)
 
-		// When
-		newID, err := manager.Generate(ctx)
+		_, err = m.Generate(ctx, []Range{{First: 5, Last: 10}}, noOps)
+		assert.Equal(t, ErrNoIDAvailable, errors.Cause(err))
+	})
 
-		// Then
+	t.Run("it should apply the operations in the same transaction", func(t *testing.T) {
+		s := store.NewMemory(config)
+		m := New(5, s, "test")
+		network := types.Network{ID: "net-1"}
+		id, err := m.Generate(ctx, []Range{{First: 1, Last: 5}}, func(id int) []store.Op {
+			network.VxLANVNI = id
+			return []store.Op{store.OpSet(network.StorageKey(), &network)}
+		})
 		require.NoError(t, err)
-		assert.Equal(t, expectedID, newID)
+
+		var stored types.Network
+		require.NoError(t, s.Get(ctx, network.StorageKey(), false, &stored))
+		assert.Equal(t, id, stored.VxLANVNI)
 	})
-	t.Run("it should return the next available ID even if there is an anomaly", func(t *testing.T) {
-		// Given
-		ctx := context.Background()
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-		existedIDs := []int{1, 1}
-		expectedID := 2
-
-		store := storemock.NewMockStore(ctrl)
-		manager := &manager{
-			field:      "value",
-			prefix:     "/test-id",
-			store:      store,
-			maxIDValue: 5,
+
+	t.Run("it should give a different ID to concurrent calls", func(t *testing.T) {
+		m := New(100, store.NewMemory(config), "test")
+		var (
+			wg  sync.WaitGroup
+			mu  sync.Mutex
+			ids = map[int]bool{}
+		)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				id, err := m.Generate(ctx, []Range{{First: 1, Last: 100}}, noOps)
+				assert.NoError(t, err)
+				mu.Lock()
+				defer mu.Unlock()
+				assert.False(t, ids[id], "%d should be generated once", id)
+				ids[id] = true
+			}()
 		}
+		wg.Wait()
+		assert.Len(t, ids, 50)
+	})
+}
 
-		store.EXPECT().Get(gomock.Any(), manager.prefix, true, gomock.Any()).Do(
-			func(_ context.Context, _ string, _ bool, rawPtrItems interface{}) {
-				ptrItems, ok := rawPtrItems.(*[]map[string]interface{})
-				require.True(t, ok)
-				for _, id := range existedIDs {
-					*ptrItems = append(*ptrItems, map[string]interface{}{manager.field: float64(id)})
-				}
-			},
-		).Return(nil)
+func TestManager_Release(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
 
-		// When
-		newID, err := manager.Generate(ctx)
+	s := store.NewMemory(config)
+	m := New(5, s, "test")
+	require.NoError(t, s.Set(ctx, "/network/net-1", types.Network{ID: "net-1"}))
+	require.NoError(t, m.Reserve(ctx, 2))
 
-		// Then
-		require.NoError(t, err)
-		assert.Equal(t, expectedID, newID)
-	})
-	t.Run("it should return an error if the store fails to list the items", func(t *testing.T) {
-		// Given
-		ctx := context.Background()
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-
-		store := storemock.NewMockStore(ctrl)
-		manager := &manager{
-			field:      "value",
-			prefix:     "/test-id",
-			store:      store,
-			maxIDValue: 5,
-		}
+	err = m.Reserve(ctx, 2)
+	assert.Equal(t, ErrIDUnavailable, errors.Cause(err))
+
+	require.NoError(t, m.Release(ctx, 2, store.OpDelete("/network/net-1")))
+	err = s.Get(ctx, "/network/net-1", false, &types.Network{})
+	assert.Equal(t, store.ErrNotFound, err)
 
-		store.EXPECT().Get(gomock.Any(), manager.prefix, true, gomock.Any()).Return(assert.AnError)
+	id, err := m.Generate(ctx, []Range{{First: 2, Last: 5}}, func(int) []store.Op { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, 2, id)
+}
 
-		// When
-		newID, err := manager.Generate(ctx)
+func TestManager_ReserveTxn(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
 
-		// Then
-		require.Equal(t, -1, newID)
-		require.Error(t, err)
-		require.ErrorContains(t, err, "fail to get list of items")
-	})
-	t.Run("maxVNI should be allocable", func(t *testing.T) {
-		// Given
-		ctx := context.Background()
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-		existedIDs := []int{1, 2, 3, 4}
-		expectedID := 5
-
-		store := storemock.NewMockStore(ctrl)
-		manager := &manager{
-			field:      "value",
-			prefix:     "/test-id",
-			store:      store,
-			maxIDValue: 5,
-		}
+	s := store.NewMemory(config)
+	m := New(5, s, "test")
+	require.NoError(t, m.Reserve(ctx, 2))
 
-		store.EXPECT().Get(gomock.Any(), manager.prefix, true, gomock.Any()).Do(
-			func(_ context.Context, _ string, _ bool, rawPtrItems interface{}) {
-				ptrItems, ok := rawPtrItems.(*[]map[string]interface{})
-				require.True(t, ok)
-				for _, id := range existedIDs {
-					*ptrItems = append(*ptrItems, map[string]interface{}{manager.field: float64(id)})
-				}
-			},
-		).Return(nil)
+	_, _, err = m.ReserveTxn(ctx, 1, 2)
+	assert.Equal(t, ErrIDUnavailable, errors.Cause(err))
 
-		// When
-		newID, err := manager.Generate(ctx)
+	cmp, op, err := m.ReserveTxn(ctx, 1, 3)
+	require.NoError(t, err)
+	network := types.Network{ID: "net-1"}
+	require.NoError(t, s.Txn(ctx, []store.Compare{cmp}, op, store.OpSet(network.StorageKey(), &network)))
 
-		// Then
-		require.NoError(t, err)
-		assert.Equal(t, expectedID, newID)
-	})
-	t.Run("it should return an error if there are no more available IDs", func(t *testing.T) {
-		// Given
-		ctx := context.Background()
-		ctrl := gomock.NewController(t)
-		defer ctrl.Finish()
-		existedIDs := []int{1, 2, 3, 4, 5}
-
-		store := storemock.NewMockStore(ctrl)
-		manager := &manager{
-			field:      "value",
-			prefix:     "/test-id",
-			store:      store,
-			maxIDValue: 5,
-		}
+	id, err := m.Generate(ctx, []Range{{First: 1, Last: 5}}, func(int) []store.Op { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, 4, id)
 
-		store.EXPECT().Get(gomock.Any(), manager.prefix, true, gomock.Any()).Do(
-			func(_ context.Context, _ string, _ bool, rawPtrItems interface{}) {
-				ptrItems, ok := rawPtrItems.(*[]map[string]interface{})
-				require.True(t, ok)
-				for _, id := range existedIDs {
-					*ptrItems = append(*ptrItems, map[string]interface{}{manager.field: float64(id)})
-				}
-			},
-		).Return(nil)
-
-		// When
-		newID, err := manager.Generate(ctx)
-
-		// Then
-		require.Equal(t, -1, newID)
-		require.Error(t, err)
-		require.ErrorIs(t, err, ErrNoIDAvailable)
-	})
+	// The IDs have been modified since the operation has been built
+	cmp, op, err = m.ReserveTxn(ctx, 5)
+	require.NoError(t, err)
+	require.NoError(t, m.Release(ctx, 4))
+	assert.Equal(t, store.ErrTxnConflict, s.Txn(ctx, []store.Compare{cmp}, op))
+}
+
+func TestParseRanges(t *testing.T) {
+	ranges, err := ParseRanges("1-99, 200,300-399")
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{First: 1, Last: 99}, {First: 200, Last: 200}, {First: 300, Last: 399}}, ranges)
+
+	for _, invalid := range []string{"0-10", "10-1", "a-b", "1-"} {
+		_, err := ParseRanges(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	ranges := Subtract([]Range{{First: 1, Last: 100}}, []Range{{First: 10, Last: 19}, {First: 90, Last: 200}})
+	assert.Equal(t, []Range{{First: 1, Last: 9}, {First: 20, Last: 89}}, ranges)
+	assert.True(t, Overlap([]Range{{First: 1, Last: 10}}, []Range{{First: 10, Last: 20}}))
+	assert.False(t, Overlap([]Range{{First: 1, Last: 9}}, []Range{{First: 10, Last: 20}}))
 }
@@ -0,0 +1,85 @@
+package idmanager
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Range of IDs, First and Last included
+type Range struct {
+	First int
+	Last  int
+}
+
+func (r Range) Contains(id int) bool {
+	return id >= r.First && id <= r.Last
+}
+
+// ParseRanges parses a comma-separated list of ranges like "1-99,200-299" or
+// single IDs like "1,2"
+func ParseRanges(s string) ([]Range, error) {
+	var ranges []Range
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid range '%v'", part)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid range '%v'", part)
+			}
+		}
+		if first < 1 || last < first {
+			return nil, errors.Errorf("invalid range '%v'", part)
+		}
+		ranges = append(ranges, Range{First: first, Last: last})
+	}
+	return ranges, nil
+}
+
+// Subtract returns the IDs of ranges which are not in excluded, sorted
+func Subtract(ranges []Range, excluded []Range) []Range {
+	result := append([]Range{}, ranges...)
+	for _, e := range excluded {
+		var next []Range
+		for _, r := range result {
+			if e.Last < r.First || e.First > r.Last {
+				next = append(next, r)
+				continue
+			}
+			if r.First < e.First {
+				next = append(next, Range{First: r.First, Last: e.First - 1})
+			}
+			if r.Last > e.Last {
+				next = append(next, Range{First: e.Last + 1, Last: r.Last})
+			}
+		}
+		result = next
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].First < result[j].First
+	})
+	return result
+}
+
+// Overlap returns true if an ID is in both a and b
+func Overlap(a []Range, b []Range) bool {
+	for _, ra := range a {
+		for _, rb := range b {
+			if ra.First <= rb.Last && rb.First <= ra.Last {
+				return true
+			}
+		}
+	}
+	return false
+}
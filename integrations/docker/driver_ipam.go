@@ -2,7 +2,7 @@ package docker
 
 import (
 	"context"
-	"net"
+	"strings"
 
 	"github.com/Scalingo/go-plugins-helpers/ipam"
 	"github.com/Scalingo/go-utils/logger"
@@ -46,15 +46,38 @@ func (p *dockerIPAMPlugin) RequestPool(ctx context.Context, req *ipam.RequestPoo
 		return nil, errors.Errorf("SAND network %v does not exist", id)
 	}
 
-	log.Info("pool initialized")
 	res := ipam.RequestPoolResponse{
 		PoolID: id,
 		Pool:   network.IPRange,
 		Data:   map[string]string{},
 	}
+	if req.V6 {
+		if network.IPv6Range == "" {
+			return nil, errors.Errorf("SAND network %v has no IPv6 range", id)
+		}
+		res.PoolID = network.IPv6PoolID()
+		res.Pool = network.IPv6Range
+	}
+	log.WithField("pool_id", res.PoolID).Info("pool initialized")
 	return &res, nil
 }
 
+// poolNetwork returns the network of an IP pool and its gateway in the pool
+func (p *dockerIPAMPlugin) poolNetwork(ctx context.Context, poolID string) (types.Network, string, error) {
+	id := strings.TrimSuffix(poolID, types.IPv6PoolSuffix)
+	network, ok, err := p.networkRepository.Exists(ctx, id)
+	if err != nil {
+		return network, "", errors.Wrapf(err, "fail to get network %v", id)
+	}
+	if !ok {
+		return network, "", errors.Errorf("SAND network %v does not exist", id)
+	}
+	if poolID == network.IPv6PoolID() {
+		return network, network.IPv6Gateway, nil
+	}
+	return network, network.Gateway, nil
+}
+
 func (p *dockerIPAMPlugin) ReleasePool(ctx context.Context, req *ipam.ReleasePoolRequest) error {
 	// Always deleted through SAND API
 	return nil
@@ -65,17 +88,13 @@ func (p *dockerIPAMPlugin) RequestAddress(ctx context.Context, req *ipam.Request
 	log = log.WithField("pool_id", req.PoolID)
 
 	if req.Options["RequestAddressType"] == "com.docker.network.gateway" {
-		id := req.PoolID
-		network, ok, err := p.networkRepository.Exists(ctx, id)
+		_, gateway, err := p.poolNetwork(ctx, req.PoolID)
 		if err != nil {
-			return nil, errors.Wrapf(err, "fail to get network %v", id)
-		}
-		if !ok {
-			return nil, errors.Errorf("SAND network %v does not exist", id)
+			return nil, errors.Wrapf(err, "fail to get network of pool %v", req.PoolID)
 		}
 
 		return &ipam.RequestAddressResponse{
-			Address: network.Gateway,
+			Address: gateway,
 		}, nil
 	}
 
@@ -96,25 +115,8 @@ func (p *dockerIPAMPlugin) ReleaseAddress(ctx context.Context, req *ipam.Release
 	id := req.PoolID
 	log = log.WithField("pool_id", id)
 
-	network, ok, err := p.networkRepository.Exists(ctx, id)
-	if err != nil {
-		return errors.Wrapf(err, "fail to get network %v", id)
-	}
-	if !ok {
-		return errors.Errorf("SAND network %v does not exist", id)
-	}
-
-	ip, _, err := net.ParseCIDR(network.Gateway)
-	if err != nil {
-		return errors.Errorf("SAND network %v gateway is not a valid CIDR", id)
-	}
-
-	if req.Address == ip.String() {
-		log.Info("docker releasing gateway, skipping")
-		return nil
-	}
-
-	err = p.allocator.ReleaseIP(ctx, id, req.Address)
+	// The gateway released by docker is reserved, the allocator keeps it
+	err := p.allocator.ReleaseIP(ctx, id, req.Address)
 	if err != nil {
 		return errors.Wrapf(err, "fail to release address in pool %v - %v", id, req.Address)
 	}
@@ -129,6 +129,7 @@ func (p *dockerNetworkPlugin) CreateEndpoint(ctx context.Context, req *network.C
 
 	if req.Interface.Address != "" {
 		params.IPv4Address = req.Interface.Address
+		params.IPv6Address = req.Interface.AddressIPv6
 		params.MacAddress = req.Interface.MacAddress
 	}
 
@@ -151,6 +152,7 @@ func (p *dockerNetworkPlugin) CreateEndpoint(ctx context.Context, req *network.C
 	res := &network.CreateEndpointResponse{Interface: &network.EndpointInterface{}}
 	if params.IPv4Address == "" {
 		res.Interface.Address = e.TargetVethIP
+		res.Interface.AddressIPv6 = e.TargetVethIPv6
 		res.Interface.MacAddress = e.TargetVethMAC
 	}
 
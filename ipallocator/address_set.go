@@ -0,0 +1,56 @@
+package ipallocator
+
+import (
+	"sort"
+)
+
+// addressSet is a sorted and sparse set of address offsets. IPv6 ranges are
+// far too large to be represented by a bit set, only the allocated addresses
+// are stored.
+type addressSet []uint64
+
+func (s addressSet) index(offset uint64) int {
+	return sort.Search(len(s), func(i int) bool { return s[i] >= offset })
+}
+
+func (s addressSet) test(offset uint64) bool {
+	i := s.index(offset)
+	return i < len(s) && s[i] == offset
+}
+
+func (s *addressSet) set(offset uint64) {
+	i := s.index(offset)
+	if i < len(*s) && (*s)[i] == offset {
+		return
+	}
+	*s = append(*s, 0)
+	copy((*s)[i+1:], (*s)[i:])
+	(*s)[i] = offset
+}
+
+func (s *addressSet) clear(offset uint64) {
+	i := s.index(offset)
+	if i == len(*s) || (*s)[i] != offset {
+		return
+	}
+	*s = append((*s)[:i], (*s)[i+1:]...)
+}
+
+// nextFree returns the lowest offset between from and max (included) which is
+// not in the set
+func (s addressSet) nextFree(from, max uint64) (uint64, bool) {
+	if from > max {
+		return 0, false
+	}
+	candidate := from
+	for _, offset := range s[s.index(from):] {
+		if offset != candidate {
+			break
+		}
+		if candidate == max {
+			return 0, false
+		}
+		candidate++
+	}
+	return candidate, true
+}
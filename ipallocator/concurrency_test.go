@@ -0,0 +1,43 @@
+package ipallocator
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
+)
+
+func TestAllocator_ConcurrentAllocations(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	a := New(config, store.NewMemory(config))
+	opts := AllocateIPOpts{AddressRange: "10.0.0.0/16"}
+
+	var wg sync.WaitGroup
+	ips := make(chan string, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ip, err := a.AllocateIP(ctx, "net-1", opts)
+			assert.NoError(t, err)
+			ips <- ip
+		}()
+	}
+	wg.Wait()
+	close(ips)
+
+	seen := map[string]bool{}
+	for ip := range ips {
+		assert.False(t, seen[ip], "%v should be allocated once", ip)
+		seen[ip] = true
+	}
+	assert.Len(t, seen, 200)
+}
@@ -3,31 +3,29 @@ package ipallocator
 import (
 	"context"
 	"fmt"
-	"math"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/Scalingo/go-etcd-lock/v5/lock"
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/config"
 	"github.com/Scalingo/sand/netutils"
 	"github.com/Scalingo/sand/store"
-	"github.com/bits-and-blooms/bitset"
 	"github.com/pkg/errors"
 )
 
 const (
-	lockDuration          = 20
-	IPAllocatorPrefix     = "/ipalloc"
-	IPAllocatorLockPrefix = "/ipalloc-lock"
+	IPAllocatorPrefix = "/ipalloc"
 )
 
 type allocation struct {
-	ID           string         `json:"id"`
-	AddressRange string         `json:"address_range"`
-	AddressCount uint           `json:"address_count"`
-	BitSet       *bitset.BitSet `json:"bit_set"`
+	ID string `json:"id"`
+	// Subnets are used in order, addresses are allocated in a subnet when the
+	// previous ones are full
+	Subnets []subnetAllocation `json:"subnets"`
+	// Reservations are indexed by the key given by the caller when allocating
+	Reservations map[string]reservation `json:"reservations,omitempty"`
 }
 
 func (a allocation) storageKey() string {
@@ -38,6 +36,15 @@ type AllocateIPOpts struct {
 	AddressRange string
 	// If set, will try to allocate this precise IP, error if already taken
 	Address string
+	// Reserve the predefined Address, it is never released. Used for gateways,
+	// reserving an address already reserved succeeds.
+	Reserve bool
+	// Exclusions are addresses or CIDR ranges of AddressRange which are only
+	// allocated when requested explicitly, used when the allocation is created
+	Exclusions []string
+	// ReservationKey identifies the caller, the allocated address is given
+	// back to the same key after being released until the reservation expires
+	ReservationKey string
 }
 
 type RangeAddresser interface {
@@ -48,249 +55,403 @@ type IPAllocator interface {
 	AllocateIP(ctx context.Context, id string, opts AllocateIPOpts) (string, error)
 	ReleaseIP(ctx context.Context, id string, address string) error
 	ReleasePool(ctx context.Context, id string) error
+	// AddRange appends a range to an existing pool, adding a range already in
+	// the pool does nothing
+	AddRange(ctx context.Context, id string, addressRange string) error
+	// WidenRange replaces a range of a pool by a larger one containing it,
+	// allocated addresses are kept. Nothing is done if the range has already
+	// been widened.
+	WidenRange(ctx context.Context, id string, addressRange string, newAddressRange string) error
+	// ReleaseReservation removes the reservation of key, its address is
+	// released unless it is in use
+	ReleaseReservation(ctx context.Context, id string, key string) error
+	// Reconcile compares the pool with the addresses in use, if repair is
+	// true the pool is fixed to match them
+	Reconcile(ctx context.Context, id string, addresses []string, repair bool) (Reconciliation, error)
+	// Usage counts the free and allocated addresses of the pool
+	Usage(ctx context.Context, id string) (Usage, error)
 }
 
 type allocator struct {
 	config      *config.Config
 	store       store.Store
-	locker      lock.Locker
 	m           *sync.Mutex
 	allocations map[string]allocation
+	// reservationTTL is how long a released address stays bound to its
+	// reservation key
+	reservationTTL time.Duration
+	// quarantine is how long a released address is not allocated again,
+	// unless the pool is exhausted
+	quarantine time.Duration
+	now        func() time.Time
 }
 
-func New(config *config.Config, store store.Store, locker lock.Locker) *allocator {
+func New(config *config.Config, store store.Store) *allocator {
 	return &allocator{
 		config: config, store: store,
-		locker:      locker,
-		m:           &sync.Mutex{},
-		allocations: make(map[string]allocation),
+		m:              &sync.Mutex{},
+		allocations:    make(map[string]allocation),
+		reservationTTL: config.IPReservationTTL,
+		quarantine:     config.IPQuarantine,
+		now:            time.Now,
 	}
 }
 
 func (a *allocation) GetAddressRange() string {
-	return a.AddressRange
-}
-
-func (a *allocator) lockStorageKey(id string) string {
-	return fmt.Sprintf("%s/%s", IPAllocatorLockPrefix, id)
+	if len(a.Subnets) == 0 {
+		return ""
+	}
+	return a.Subnets[0].AddressRange
 }
 
-func (a *allocator) AllocateIP(ctx context.Context, id string, opts AllocateIPOpts) (allocatedAddress string, err error) {
-	lock, err := a.locker.WaitAcquire(a.lockStorageKey(id), lockDuration)
-	if err != nil {
-		return "", errors.Wrapf(err, "fail to lock IP allocation")
-	}
-	defer func() {
-		derr := lock.Release()
-		if derr != nil {
-			err = errors.Wrapf(derr, "fail to release lock (err is %v)", err)
+func (a *allocator) AllocateIP(ctx context.Context, id string, opts AllocateIPOpts) (string, error) {
+	var allocatedAddress string
+	err := a.update(ctx, id, func(allocation *allocation, found bool) error {
+		if !found {
+			err := allocation.init(ctx, opts)
+			if err != nil {
+				return errors.Wrapf(err, "fail to create allocation")
+			}
 		}
-	}()
 
-	allocation, err := a.findOrCreateAllocation(ctx, id, opts)
-	if err != nil {
-		return "", errors.Wrapf(err, "fail to find or create allocation")
-	}
+		err := allocation.expireReservations(ctx, a.now())
+		if err != nil {
+			return errors.Wrapf(err, "fail to expire reservations")
+		}
+		allocation.expireQuarantine(a.now().Add(-a.quarantine))
 
-	allocatedAddress = opts.Address
-	if allocatedAddress != "" {
-		if !strings.Contains(allocatedAddress, "/") {
-			_, addressNet, err := net.ParseCIDR(allocation.AddressRange)
+		reserved := false
+		if opts.ReservationKey != "" {
+			allocatedAddress, reserved, err = allocation.allocateReservedIP(ctx, opts.ReservationKey, opts.Address)
 			if err != nil {
-				return "", errors.Wrapf(err, "invalid iprange %v", allocation.AddressRange)
+				return errors.Wrapf(err, "fail to allocate reserved IP")
 			}
-			ones, _ := addressNet.Mask.Size()
-			allocatedAddress = fmt.Sprintf("%s/%d", allocatedAddress, ones)
 		}
-		err = allocation.allocatePredefinedIP(ctx, allocatedAddress)
-	} else {
-		allocatedAddress, err = allocation.allocateNextAvailableIP(ctx)
-	}
-	if err != nil {
-		return "", errors.Wrapf(err, "fail to allocate IP")
-	}
+		if reserved {
+			return nil
+		}
 
-	err = a.store.Set(ctx, allocation.storageKey(), &allocation)
+		if opts.Address != "" {
+			allocatedAddress, err = allocation.allocatePredefinedIP(ctx, opts.Address, opts.Reserve)
+		} else {
+			allocatedAddress, err = allocation.allocateNextAvailableIP(ctx)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to allocate IP")
+		}
+		if opts.ReservationKey != "" {
+			allocation.reserve(opts.ReservationKey, allocatedAddress)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", errors.Wrapf(err, "fail to save updated allocation %v", allocation)
+		return "", err
 	}
-
-	return allocatedAddress, err
+	return allocatedAddress, nil
 }
 
-func (a *allocator) findOrCreateAllocation(ctx context.Context, id string, opts AllocateIPOpts) (allocation, error) {
-	var (
-		err   error
-		alloc = allocation{
-			ID: id,
-		}
-	)
-
-	log := logger.Get(ctx).WithField("allocation_id", id)
-	log.Info("find or create allocation")
+// init creates the first subnet of a new allocation
+func (a *allocation) init(ctx context.Context, opts AllocateIPOpts) error {
+	logger.Get(ctx).WithField("allocation_id", a.ID).Info("create allocation")
 
-	err = a.store.Get(ctx, alloc.storageKey(), false, &alloc)
-	if err == store.ErrNotFound {
-		_, addressNet, err := net.ParseCIDR(opts.AddressRange)
+	subnet, err := newSubnetAllocation(opts.AddressRange)
+	if err != nil {
+		return err
+	}
+	for _, exclusion := range opts.Exclusions {
+		err := subnet.exclude(exclusion)
 		if err != nil {
-			return alloc, errors.Wrapf(err, "invalid iprange %v", opts.AddressRange)
-		}
-		mask, bits := addressNet.Mask.Size()
-		// 0.0.0.0/24 -> mask = 24, bits = 32
-		// 2^8 -> 256 addresses
-		addressCount := uint(math.Pow(2.0, float64(bits-mask)))
-
-		alloc.AddressRange = opts.AddressRange
-		alloc.AddressCount = addressCount
-		// Network and Broadcast addresses are reserved
-		alloc.BitSet = bitset.New(alloc.AddressCount).Set(0).Set(addressCount - 1)
-	} else if err != nil {
-		return alloc, errors.Wrapf(err, "fail to get allocation from storage")
+			return err
+		}
 	}
-
-	return alloc, nil
+	a.Subnets = []subnetAllocation{subnet}
+	return nil
 }
 
-func (a allocation) allocatePredefinedIP(ctx context.Context, address string) error {
+// allocatePredefinedIP allocates address in the subnet containing it, its
+// prefix length if any should be the one of the subnet
+func (a *allocation) allocatePredefinedIP(ctx context.Context, address string, reserve bool) (string, error) {
 	log := logger.Get(ctx)
 
-	addrIP, addressIpnet, err := net.ParseCIDR(address)
+	ip, ipnet, err := parseAddress(address)
 	if err != nil {
-		return errors.Wrapf(err, "fail to parse predefined address ip range '%v'", address)
+		return "", errors.Wrapf(err, "fail to parse predefined address '%v'", address)
 	}
-	log.WithField("ip", addrIP).WithField("ip-range", a.AddressRange).Info("allocation of predefined IP")
+	log.WithField("ip", ip).Info("allocation of predefined IP")
 
-	if addressIpnet.String() != a.AddressRange {
-		return errors.Errorf("predefined address is not in the same ip range: %v != %v", addressIpnet.Network(), a.AddressRange)
+	i, subnetIPNet, err := a.subnetOf(ip)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid predefined address")
 	}
-
-	ordinal := ordinalFromIP4(addrIP, addressIpnet.Mask)
-	if a.BitSet.Test(ordinal) {
-		return errors.New("ip is already allocated")
+	if ipnet != nil && ipnet.String() != subnetIPNet.String() {
+		return "", errors.Errorf("predefined address is not in the same ip range: %v != %v", ipnet, subnetIPNet)
 	}
-	a.BitSet.Set(ordinal)
+	return a.Subnets[i].allocatePredefinedIP(ctx, ip, reserve)
+}
 
-	log.WithField("ip", addrIP).WithField("ip-range", a.AddressRange).Infof("allocated predefined IP (bitset %d)", ordinal)
-	return nil
+// allocateNextAvailableIP allocates the first free address of the first subnet
+// which is not full. The addresses in quarantine are only used when there is
+// no other one, the one released first is used.
+func (a *allocation) allocateNextAvailableIP(ctx context.Context) (string, error) {
+	for i := range a.Subnets {
+		address, ok, err := a.Subnets[i].allocateNextAvailableIP(ctx)
+		if err != nil {
+			return "", errors.Wrapf(err, "fail to allocate IP in %v", a.Subnets[i].AddressRange)
+		}
+		if ok {
+			return address, nil
+		}
+	}
+	i, offset, ok := a.oldestQuarantined()
+	if ok {
+		logger.Get(ctx).Info("allocation exhausted, allocating an IP in quarantine")
+		return a.Subnets[i].allocateOffset(ctx, offset)
+	}
+	return "", errors.Errorf("no IP available in allocation %v", a.ID)
 }
 
-func (a allocation) allocateNextAvailableIP(ctx context.Context) (string, error) {
-	log := logger.Get(ctx)
+// subnetOf returns the index of the subnet containing ip
+func (a *allocation) subnetOf(ip net.IP) (int, *net.IPNet, error) {
+	for i, subnet := range a.Subnets {
+		ipnet, err := subnet.ipnet()
+		if err != nil {
+			return -1, nil, err
+		}
+		if ipnet.Contains(ip) {
+			return i, ipnet, nil
+		}
+	}
+	return -1, nil, errors.Errorf("%v is not in the ranges of allocation %v", ip, a.ID)
+}
 
-	i := uint(0)
-	for ; i < a.AddressCount; i++ {
-		if !a.BitSet.Test(i) {
-			a.BitSet.Set(i)
-			break
+// overlaps returns an error if ipnet overlaps one of the subnets, except the
+// one at index skip
+func (a *allocation) overlaps(ipnet *net.IPNet, skip int) error {
+	for i, subnet := range a.Subnets {
+		if i == skip {
+			continue
+		}
+		subnetIPNet, err := subnet.ipnet()
+		if err != nil {
+			return err
+		}
+		if subnetIPNet.Contains(ipnet.IP) || ipnet.Contains(subnetIPNet.IP) {
+			return errors.Errorf("%v overlaps %v", ipnet, subnetIPNet)
 		}
 	}
+	return nil
+}
 
-	ip, ipnet, err := net.ParseCIDR(a.AddressRange)
+// parseAddress parses an IP with or without prefix length, ipnet is nil
+// without prefix length
+func parseAddress(address string) (net.IP, *net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		return net.ParseCIDR(address)
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, nil, errors.Errorf("invalid IP %v", address)
+	}
+	return ip, nil, nil
+}
+
+func (a *allocator) ReleaseIP(ctx context.Context, id string, ipcidr string) error {
+	ip, _, err := parseAddress(ipcidr)
 	if err != nil {
-		return "", errors.Wrapf(err, "fail to parse allocation address range %v", a.AddressRange)
+		return errors.Wrapf(err, "fail to parse IP CIDR %v", ipcidr)
 	}
-	ip = netutils.AddIntToIP(ip, uint64(i))
 
-	log.WithField("ip", ip).WithField("ip-range", a.AddressRange).Infof("allocated IP (bitset %d)", i)
+	return a.update(ctx, id, func(alloc *allocation, found bool) error {
+		log := logger.Get(ctx)
+		if !found {
+			return errors.Wrapf(store.ErrNotFound, "fail to get ip range from store")
+		}
 
-	ones, _ := ipnet.Mask.Size()
-	return fmt.Sprintf("%s/%d", ip.String(), ones), nil
-}
+		subnetIndex, network, err := alloc.subnetOf(ip)
+		if err != nil {
+			return errors.Wrapf(err, "invalid IP to release")
+		}
 
-func (a *allocator) ReleaseIP(ctx context.Context, id string, ipcidr string) (err error) {
-	log := logger.Get(ctx)
+		log = log.WithField("ip", ip).WithField("ip-range", network)
+		i, err := netutils.IPOffset(network, ip)
+		if err != nil {
+			return errors.Wrapf(err, "invalid IP to release %v", ip)
+		}
+		log.WithField("ordinal", i).Debug("IP ordinal")
+		if alloc.Subnets[subnetIndex].reserved(i) {
+			log.Info("reserved IP, not released")
+			return errNotModified
+		}
 
-	lock, err := a.locker.WaitAcquire(a.lockStorageKey(id), lockDuration)
-	if err != nil {
-		return errors.Wrapf(err, "fail to lock IP release")
-	}
-	defer func() {
-		derr := lock.Release()
-		if derr != nil {
-			err = errors.Wrapf(err, "fail to release lock when releasing IP (err is %v)", err)
+		err = alloc.expireReservations(ctx, a.now())
+		if err != nil {
+			return errors.Wrapf(err, "fail to expire reservations")
 		}
-	}()
+		alloc.expireQuarantine(a.now().Add(-a.quarantine))
+		key, _ := alloc.reservationOf(ip)
+		kept := alloc.release(subnetIndex, i, key, a.reservationExpiration(), a.quarantineStart())
+		if kept {
+			log.WithField("reservation_key", key).Info("IP kept for its reservation")
+			return nil
+		}
+		log.Infof("release IP (offset %d)", i)
+		return nil
+	})
+}
+
+func (a *allocator) ReleasePool(ctx context.Context, id string) error {
+	log := logger.Get(ctx).WithField("allocation_id", id)
+	log.Infof("Releasing allocation")
 
 	alloc := allocation{ID: id}
-	err = a.store.Get(ctx, alloc.storageKey(), false, &alloc)
-	if err != nil {
-		return errors.Wrapf(err, "fail to get ip range from store")
+	err := a.store.Delete(ctx, alloc.storageKey())
+	if err == store.ErrNotFound {
+		log.Infof("allocation not found %v", alloc)
+		return nil
 	}
-
-	_, network, err := net.ParseCIDR(alloc.AddressRange)
 	if err != nil {
-		return errors.Wrapf(err, "fail to parse iprange of allocation %v", alloc.AddressRange)
-	}
-	if !strings.Contains(ipcidr, "/") {
-		ones, _ := network.Mask.Size()
-		ipcidr = fmt.Sprintf("%s/%d", ipcidr, ones)
+		return errors.Wrapf(err, "fail to delete ip range reference")
 	}
 
-	ip, _, err := net.ParseCIDR(ipcidr)
+	log.Info("Allocation deleted")
+
+	return nil
+}
+
+func (a *allocator) AddRange(ctx context.Context, id string, addressRange string) error {
+	log := logger.Get(ctx).WithField("allocation_id", id).WithField("ip-range", addressRange)
+
+	err := a.update(ctx, id, func(alloc *allocation, found bool) error {
+		if !found {
+			return errors.Wrapf(store.ErrNotFound, "fail to get allocation from storage")
+		}
+
+		subnet, err := newSubnetAllocation(addressRange)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create range allocation")
+		}
+		ipnet, err := subnet.ipnet()
+		if err != nil {
+			return err
+		}
+		// The range may have been added by a former attempt
+		for _, existing := range alloc.Subnets {
+			if existing.AddressRange == subnet.AddressRange {
+				return errNotModified
+			}
+		}
+		err = alloc.overlaps(ipnet, -1)
+		if err != nil {
+			return errors.Wrapf(err, "invalid range")
+		}
+		alloc.Subnets = append(alloc.Subnets, subnet)
+		return nil
+	})
 	if err != nil {
-		return errors.Wrapf(err, "fail to parse IP CIDR %v", ipcidr)
+		return err
 	}
+	log.Info("range added to allocation")
+	return nil
+}
 
-	log = log.WithField("ip", ip).WithField("ip-range", alloc.AddressRange)
-	i := ordinalFromIP4(ip, network.Mask)
-	log.WithField("ordinal", i).Debug("IP ordinal")
-	alloc.BitSet.Clear(i)
-	log.Infof("release IP (bitset %d)", i)
+func (a *allocator) WidenRange(ctx context.Context, id string, addressRange string, newAddressRange string) error {
+	log := logger.Get(ctx).WithField("allocation_id", id).WithField("ip-range", addressRange)
 
-	err = a.store.Set(ctx, alloc.storageKey(), &alloc)
+	err := a.update(ctx, id, func(alloc *allocation, found bool) error {
+		if !found {
+			return errors.Wrapf(store.ErrNotFound, "fail to get allocation from storage")
+		}
+		return alloc.widenRange(addressRange, newAddressRange)
+	})
 	if err != nil {
-		return errors.Wrapf(err, "fail to store ip range in store")
+		return err
 	}
+	log.WithField("new-ip-range", newAddressRange).Info("range of allocation widened")
 	return nil
 }
 
-func (a *allocator) ReleasePool(ctx context.Context, id string) (err error) {
-	log := logger.Get(ctx).WithField("allocation_id", id)
-	lock, err := a.locker.WaitAcquire(a.lockStorageKey(id), lockDuration)
+// widenRange replaces the subnet addressRange by newAddressRange, it returns
+// errNotModified if addressRange has already been replaced
+func (a *allocation) widenRange(addressRange string, newAddressRange string) error {
+	_, oldIPNet, err := net.ParseCIDR(addressRange)
 	if err != nil {
-		return errors.Wrapf(err, "fail to lock IP release pool")
+		return errors.Wrapf(err, "invalid iprange %v", addressRange)
 	}
-	defer func() {
-		derr := lock.Release()
-		if derr != nil {
-			err = errors.Wrapf(err, "fail to release lock when releasing pool (err is %v)", err)
+	_, newIPNet, err := net.ParseCIDR(newAddressRange)
+	if err != nil {
+		return errors.Wrapf(err, "invalid iprange %v", newAddressRange)
+	}
+	index := -1
+	applied := false
+	for i, subnet := range a.Subnets {
+		if subnet.AddressRange == oldIPNet.String() {
+			index = i
+		}
+		if subnet.AddressRange == newIPNet.String() && newIPNet.Contains(oldIPNet.IP) {
+			applied = true
 		}
-	}()
+	}
+	if index == -1 && applied {
+		return errNotModified
+	}
+	if index == -1 {
+		return errors.Errorf("%v is not a range of allocation %v", addressRange, a.ID)
+	}
 
-	alloc := allocation{ID: id}
-	log.Infof("Releasing allocation")
-	err = a.store.Get(ctx, alloc.storageKey(), false, &alloc)
+	widened, err := newSubnetAllocation(newAddressRange)
 	if err != nil {
-		return errors.Wrapf(err, "fail to get ip range from store")
+		return errors.Wrapf(err, "fail to create range allocation")
 	}
-	if err == store.ErrNotFound {
-		log.Infof("allocation not found %v", alloc)
-		return nil
+	oldOnes, _ := oldIPNet.Mask.Size()
+	newOnes, _ := newIPNet.Mask.Size()
+	if !newIPNet.Contains(oldIPNet.IP) || newOnes >= oldOnes {
+		return errors.Errorf("%v is not larger than %v", newIPNet, oldIPNet)
 	}
-
-	err = a.store.Delete(ctx, alloc.storageKey())
+	err = a.overlaps(newIPNet, index)
 	if err != nil {
-		return errors.Wrapf(err, "fail to delete ip range reference")
+		return errors.Wrapf(err, "invalid range")
 	}
 
-	log.Info("Allocation deleted")
-
-	return nil
-}
-
-func ordinalFromIP4(ip net.IP, mask net.IPMask) uint {
-	var (
-		ordinal uint = 0
-		rank    uint = 1
-	)
-	// inv mask
-	for i := range mask {
-		mask[i] = mask[i] ^ 0xff
+	// Allocated addresses, reservations and exclusions keep their IP, their
+	// offset changes if the start of the range moves
+	old := a.Subnets[index]
+	move := func(offset uint64) (uint64, error) {
+		ip := netutils.AddIntToIP(oldIPNet.IP, offset)
+		newOffset, err := netutils.IPOffset(newIPNet, ip)
+		if err != nil {
+			return 0, errors.Wrapf(err, "fail to move %v in %v", ip, newIPNet)
+		}
+		return newOffset, nil
+	}
+	for _, offset := range old.allocated() {
+		if old.boundary(offset) {
+			continue
+		}
+		newOffset, err := move(offset)
+		if err != nil {
+			return err
+		}
+		widened.set(newOffset)
+		if old.Reserved.test(offset) {
+			widened.Reserved.set(newOffset)
+		}
+	}
+	for _, released := range old.Quarantine {
+		offset, err := move(released.Offset)
+		if err != nil {
+			return err
+		}
+		widened.Quarantine = append(widened.Quarantine, releasedOffset{Offset: offset, ReleasedAt: released.ReleasedAt})
 	}
-	ip = ip.Mask(mask)
-	for i := len(ip) - 1; i >= 0; i-- {
-		ordinal += uint(ip[i]) * rank
-		rank++
+	for _, exclusion := range old.Exclusions {
+		first, err := move(exclusion.First)
+		if err != nil {
+			return err
+		}
+		widened.Exclusions = append(widened.Exclusions, offsetRange{
+			First: first, Last: first + exclusion.Last - exclusion.First,
+		})
 	}
-	return ordinal
+	a.Subnets[index] = widened
+	return nil
 }
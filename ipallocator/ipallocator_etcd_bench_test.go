@@ -0,0 +1,122 @@
+//go:build etcd
+// +build etcd
+
+package ipallocator
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-etcd-lock/v5/lock"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/etcd"
+	"github.com/Scalingo/sand/store"
+)
+
+// The benchmarks compare the allocator with the former locking one on the
+// etcd instance of ETCD_HOSTS:
+//
+//	go test -tags etcd -run '^$' -bench AllocateIP ./ipallocator/
+
+// benchmarkPoolSize is the number of addresses allocated in each pool, a /16
+// pool has 65534 addresses
+const benchmarkPoolSize = 60000
+
+// lockingAllocator reproduces the former behaviour of the allocator, which
+// took a lock on the allocation for every operation and saved it with a
+// plain Set.
+type lockingAllocator struct {
+	*allocator
+	locker lock.Locker
+}
+
+// AllocateIP is the former allocation of the next available address of a
+// pool, the benchmarks don't request addresses nor reservation keys
+func (a lockingAllocator) AllocateIP(ctx context.Context, id string, opts AllocateIPOpts) (string, error) {
+	l, err := a.locker.WaitAcquire("/ipalloc-lock/"+id, 20)
+	if err != nil {
+		return "", err
+	}
+	defer l.Release()
+
+	alloc := allocation{ID: id}
+	err = a.store.Get(ctx, alloc.storageKey(), false, &alloc)
+	if err == store.ErrNotFound {
+		err = alloc.init(ctx, opts)
+	}
+	if err != nil {
+		return "", err
+	}
+	err = alloc.expireReservations(ctx, a.now())
+	if err != nil {
+		return "", err
+	}
+	alloc.expireQuarantine(a.now().Add(-a.quarantine))
+
+	address, err := alloc.allocateNextAvailableIP(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = a.store.Set(ctx, alloc.storageKey(), &alloc)
+	if err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// newBenchmarkAllocator returns an allocator storing its pools in a prefix of
+// etcd dedicated to the benchmark, and the etcd locker
+func newBenchmarkAllocator(b *testing.B) (*allocator, lock.Locker) {
+	config, err := config.Build()
+	require.NoError(b, err)
+	config.IPQuarantine = 0
+	config.EtcdPrefix = fmt.Sprintf("/sand-benchmark-%d", time.Now().UnixNano())
+
+	client, err := etcd.NewClient()
+	require.NoError(b, err)
+	b.Cleanup(func() {
+		_, err := client.Delete(context.Background(), config.EtcdPrefix, clientv3.WithPrefix())
+		if err != nil {
+			b.Logf("fail to delete benchmark keys: %v", err)
+		}
+		client.Close()
+	})
+	return New(config, store.New(config, client)), lock.NewEtcdLocker(client)
+}
+
+// benchmarkAllocateIP allocates b.N addresses, a new pool is used every
+// benchmarkPoolSize addresses
+func benchmarkAllocateIP(b *testing.B, allocate func(ctx context.Context, id string, opts AllocateIPOpts) (string, error)) {
+	ctx := context.Background()
+	opts := AllocateIPOpts{AddressRange: "10.0.0.0/16"}
+	var allocated int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddInt64(&allocated, 1) - 1
+			id := fmt.Sprintf("net-%d", n/benchmarkPoolSize)
+			_, err := allocate(ctx, id, opts)
+			if err != nil {
+				// FailNow can't be called out of the benchmark goroutine
+				b.Errorf("fail to allocate IP: %v", err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkAllocateIP_Optimistic(b *testing.B) {
+	a, _ := newBenchmarkAllocator(b)
+	benchmarkAllocateIP(b, a.AllocateIP)
+}
+
+func BenchmarkAllocateIP_Locking(b *testing.B) {
+	a, locker := newBenchmarkAllocator(b)
+	benchmarkAllocateIP(b, lockingAllocator{allocator: a, locker: locker}.AllocateIP)
+}
@@ -0,0 +1,425 @@
+package ipallocator
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
+)
+
+// newTestAllocator returns an allocator backed by a memory store in which the
+// seed addresses are allocated in order, in addressRange when they do not
+// specify a range
+func newTestAllocator(t *testing.T, addressRange string, seed ...AllocateIPOpts) *allocator {
+	config, err := config.Build()
+	require.NoError(t, err)
+	a := New(config, store.NewMemory(config))
+	for _, opts := range seed {
+		if opts.AddressRange == "" {
+			opts.AddressRange = addressRange
+		}
+		_, err := a.AllocateIP(context.Background(), "net-1", opts)
+		require.NoError(t, err)
+	}
+	return a
+}
+
+func TestAllocator_AllocateIP(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it should allocate the addresses of an IPv4 range in order", func(t *testing.T) {
+		a := newTestAllocator(t, "")
+		opts := AllocateIPOpts{AddressRange: "10.0.0.0/30"}
+		ip, err := a.AllocateIP(ctx, "net-1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1/30", ip)
+		ip, err = a.AllocateIP(ctx, "net-1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.2/30", ip)
+
+		_, err = a.AllocateIP(ctx, "net-1", opts)
+		assert.Error(t, err, "the broadcast address should not be allocated")
+	})
+
+	t.Run("it should release an address outside of the first /24 of a range", func(t *testing.T) {
+		a := newTestAllocator(t, "")
+		opts := AllocateIPOpts{AddressRange: "10.0.0.0/16", Address: "10.0.1.5"}
+		ip, err := a.AllocateIP(ctx, "net-1", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.1.5/16", ip)
+		_, err = a.AllocateIP(ctx, "net-1", opts)
+		assert.Error(t, err)
+
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.1.5"))
+		_, err = a.AllocateIP(ctx, "net-1", opts)
+		require.NoError(t, err)
+	})
+
+	t.Run("it should allocate addresses of an IPv6 range without a bit set", func(t *testing.T) {
+		a := newTestAllocator(t, "")
+		opts := AllocateIPOpts{AddressRange: "fd00:0:0:1::/64"}
+		ip, err := a.AllocateIP(ctx, "net-1-ipv6", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "fd00:0:0:1::1/64", ip)
+
+		_, err = a.AllocateIP(ctx, "net-1-ipv6", AllocateIPOpts{Address: "fd00:0:0:1::3"})
+		require.NoError(t, err)
+		ip, err = a.AllocateIP(ctx, "net-1-ipv6", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "fd00:0:0:1::2/64", ip)
+		ip, err = a.AllocateIP(ctx, "net-1-ipv6", opts)
+		require.NoError(t, err)
+		assert.Equal(t, "fd00:0:0:1::4/64", ip)
+
+		_, err = a.AllocateIP(ctx, "net-1-ipv6", AllocateIPOpts{Address: "fd00:0:0:1::3"})
+		assert.Error(t, err)
+		require.NoError(t, a.ReleaseIP(ctx, "net-1-ipv6", "fd00:0:0:1::3/64"))
+		_, err = a.AllocateIP(ctx, "net-1-ipv6", AllocateIPOpts{Address: "fd00:0:0:1::3"})
+		require.NoError(t, err)
+
+		alloc := allocation{ID: "net-1-ipv6"}
+		require.NoError(t, a.store.Get(ctx, alloc.storageKey(), false, &alloc))
+		require.Len(t, alloc.Subnets, 1)
+		assert.Nil(t, alloc.Subnets[0].BitSet)
+		assert.Equal(t, addressSet{0, 1, 2, 3, 4}, alloc.Subnets[0].Offsets)
+	})
+}
+
+func TestAllocator_Ranges(t *testing.T) {
+	ctx := context.Background()
+	// Fills 10.0.0.0/30
+	newAllocator := func(t *testing.T) *allocator {
+		return newTestAllocator(t, "10.0.0.0/30", AllocateIPOpts{}, AllocateIPOpts{})
+	}
+
+	t.Run("it should allocate in the next range when the first one is full", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.AddRange(ctx, "net-1", "10.0.1.0/30"))
+
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.1.1/30", ip)
+
+		// Released addresses are reused right away without quarantine
+		a.quarantine = 0
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.2"))
+		ip, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.2/30", ip)
+	})
+
+	t.Run("it should refuse a range overlapping an existing one", func(t *testing.T) {
+		a := newAllocator(t)
+		err := a.AddRange(ctx, "net-1", "10.0.0.0/29")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "overlaps")
+	})
+
+	t.Run("it should do nothing when adding a range already in the pool", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.AddRange(ctx, "net-1", "10.0.1.0/30"))
+		require.NoError(t, a.AddRange(ctx, "net-1", "10.0.1.0/30"))
+
+		var alloc allocation
+		require.NoError(t, a.store.Get(ctx, allocation{ID: "net-1"}.storageKey(), false, &alloc))
+		assert.Len(t, alloc.Subnets, 2)
+	})
+
+	t.Run("it should do nothing when widening a range already widened", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.WidenRange(ctx, "net-1", "10.0.0.0/30", "10.0.0.0/29"))
+		require.NoError(t, a.WidenRange(ctx, "net-1", "10.0.0.0/30", "10.0.0.0/29"))
+
+		err := a.WidenRange(ctx, "net-1", "10.0.0.0/30", "10.0.0.0/28")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not a range")
+	})
+
+	t.Run("it should keep the allocated addresses of a widened range", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.WidenRange(ctx, "net-1", "10.0.0.0/30", "10.0.0.0/29"))
+
+		_, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.2"})
+		assert.Error(t, err)
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.3/29", ip, "the former broadcast address should be allocatable")
+
+		err = a.WidenRange(ctx, "net-1", "10.0.0.0/29", "10.0.0.0/30")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not larger")
+	})
+}
+
+func TestAllocator_Reservations(t *testing.T) {
+	ctx := context.Background()
+	newAllocator := func(t *testing.T) *allocator {
+		return newTestAllocator(t, "10.0.0.0/29", AllocateIPOpts{
+			Address: "10.0.0.1", Reserve: true, Exclusions: []string{"10.0.0.2", "10.0.0.4/30"},
+		})
+	}
+
+	t.Run("it should only allocate excluded addresses when requested explicitly", func(t *testing.T) {
+		a := newAllocator(t)
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.3/29", ip)
+		_, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		assert.Error(t, err)
+
+		ip, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.5"})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.5/29", ip)
+	})
+
+	t.Run("it should not release a reserved address", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.1/29"))
+		_, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("it should reserve a reserved address again", func(t *testing.T) {
+		a := newAllocator(t)
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.1", Reserve: true})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1/29", ip)
+	})
+
+	t.Run("it should keep the reservations of a widened range", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.WidenRange(ctx, "net-1", "10.0.0.0/29", "10.0.0.0/28"))
+
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.3/28", ip)
+		ip, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.8/28", ip)
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.1/28"))
+		_, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.1"})
+		assert.Error(t, err)
+	})
+
+	t.Run("it should refuse an exclusion outside of the range", func(t *testing.T) {
+		a := newTestAllocator(t, "")
+		_, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{
+			AddressRange: "10.0.0.0/29", Exclusions: []string{"10.0.0.0/28"},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestAllocator_ReservationKey(t *testing.T) {
+	ctx := context.Background()
+	// 10.0.0.1 is allocated and released for the key app-1
+	newAllocator := func(t *testing.T) *allocator {
+		a := newTestAllocator(t, "10.0.0.0/29", AllocateIPOpts{ReservationKey: "app-1"})
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.1/29"))
+		return a
+	}
+
+	t.Run("it should give back the released address to the same key", func(t *testing.T) {
+		a := newAllocator(t)
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.2/29", ip)
+
+		ip, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{ReservationKey: "app-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1/29", ip)
+		_, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{ReservationKey: "app-1"})
+		assert.Error(t, err, "the address of the key is in use")
+	})
+
+	t.Run("it should release the address when the reservation expires", func(t *testing.T) {
+		a := newAllocator(t)
+		a.now = func() time.Time { return time.Now().Add(a.reservationTTL + time.Minute) }
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1/29", ip)
+
+		ip, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{ReservationKey: "app-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.2/29", ip)
+	})
+
+	t.Run("it should release the address when the reservation is released", func(t *testing.T) {
+		a := newAllocator(t)
+		require.NoError(t, a.ReleaseReservation(ctx, "net-1", "app-1"))
+		assert.Equal(t, ErrReservationNotFound, a.ReleaseReservation(ctx, "net-1", "app-1"))
+
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1/29", ip)
+	})
+
+	t.Run("it should not report a kept address as orphaned", func(t *testing.T) {
+		a := newAllocator(t)
+		reconciliation, err := a.Reconcile(ctx, "net-1", nil, false)
+		require.NoError(t, err)
+		assert.Empty(t, reconciliation.Orphaned)
+	})
+}
+
+func TestAllocator_Quarantine(t *testing.T) {
+	ctx := context.Background()
+	// 10.0.0.1 and 10.0.0.2 are released, in this order
+	newAllocator := func(t *testing.T) *allocator {
+		a := newTestAllocator(t, "10.0.0.0/29", AllocateIPOpts{}, AllocateIPOpts{}, AllocateIPOpts{})
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.1/29"))
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.2/29"))
+		return a
+	}
+
+	t.Run("it should not allocate an address in quarantine", func(t *testing.T) {
+		a := newAllocator(t)
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.4/29", ip)
+
+		ip, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.2"})
+		require.NoError(t, err, "an address in quarantine can be requested explicitly")
+		assert.Equal(t, "10.0.0.2/29", ip)
+	})
+
+	t.Run("it should allocate the address released first when the pool is exhausted", func(t *testing.T) {
+		a := newAllocator(t)
+		for _, expected := range []string{"10.0.0.4/29", "10.0.0.5/29", "10.0.0.6/29", "10.0.0.1/29", "10.0.0.2/29"} {
+			ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+			require.NoError(t, err)
+			assert.Equal(t, expected, ip)
+		}
+		_, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		assert.Error(t, err)
+	})
+
+	t.Run("it should allocate the address again once the quarantine is over", func(t *testing.T) {
+		a := newAllocator(t)
+		a.now = func() time.Time { return time.Now().Add(a.quarantine + time.Second) }
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1/29", ip)
+
+		alloc := allocation{ID: "net-1"}
+		require.NoError(t, a.store.Get(ctx, alloc.storageKey(), false, &alloc))
+		assert.Empty(t, alloc.Subnets[0].Quarantine)
+	})
+}
+
+func TestAllocator_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	// 10.0.0.1 is reserved, 10.0.0.2 and 10.0.0.3 are allocated
+	newAllocator := func(t *testing.T) *allocator {
+		return newTestAllocator(t, "10.0.0.0/29",
+			AllocateIPOpts{Address: "10.0.0.1", Reserve: true}, AllocateIPOpts{}, AllocateIPOpts{})
+	}
+
+	t.Run("it should report orphaned and unallocated addresses", func(t *testing.T) {
+		a := newAllocator(t)
+		reconciliation, err := a.Reconcile(ctx, "net-1", []string{"10.0.0.2/29", "10.0.0.5/29"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.3/29"}, reconciliation.Orphaned)
+		assert.Equal(t, []string{"10.0.0.5/29"}, reconciliation.Unallocated)
+
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.4/29", ip, "the pool should not be modified")
+	})
+
+	t.Run("it should repair the pool", func(t *testing.T) {
+		a := newAllocator(t)
+		_, err := a.Reconcile(ctx, "net-1", []string{"10.0.0.2/29", "10.0.0.5/29"}, true)
+		require.NoError(t, err)
+
+		reconciliation, err := a.Reconcile(ctx, "net-1", []string{"10.0.0.2/29", "10.0.0.5/29"}, false)
+		require.NoError(t, err)
+		assert.Empty(t, reconciliation.Orphaned)
+		assert.Empty(t, reconciliation.Unallocated)
+
+		ip, err := a.AllocateIP(ctx, "net-1", AllocateIPOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.4/29", ip, "the orphaned address should be in quarantine")
+		_, err = a.AllocateIP(ctx, "net-1", AllocateIPOpts{Address: "10.0.0.5"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAllocator_Usage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it should count the reserved and excluded addresses", func(t *testing.T) {
+		a := newTestAllocator(t, "10.0.0.0/29",
+			AllocateIPOpts{Address: "10.0.0.1", Reserve: true, Exclusions: []string{"10.0.0.2", "10.0.0.4/30", "10.0.0.6"}},
+			AllocateIPOpts{ReservationKey: "app-1"},
+			AllocateIPOpts{Address: "10.0.0.5"},
+		)
+
+		usage, err := a.Usage(ctx, "net-1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.0/29"}, usage.Ranges)
+		assert.Equal(t, uint64(8), usage.Total)
+		assert.Equal(t, uint64(2), usage.Used)
+		// Network, gateway, broadcast and the free excluded 10.0.0.2, 10.0.0.4
+		// and 10.0.0.6
+		assert.Equal(t, uint64(6), usage.Reserved)
+		assert.Equal(t, uint64(0), usage.Free)
+		assert.Equal(t, []AllocatedAddress{
+			{Address: "10.0.0.1/29", Reserved: true},
+			{Address: "10.0.0.3/29", ReservationKey: "app-1"},
+			{Address: "10.0.0.5/29"},
+		}, usage.Allocated)
+
+		require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.5/29"))
+		usage, err = a.Usage(ctx, "net-1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), usage.Used)
+		assert.Equal(t, uint64(7), usage.Reserved)
+	})
+
+	t.Run("it should cap the counts of large IPv6 ranges", func(t *testing.T) {
+		a := newTestAllocator(t, "fd00::/48", AllocateIPOpts{})
+		usage, err := a.Usage(ctx, "net-1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(math.MaxUint64), usage.Total)
+		assert.Equal(t, uint64(1), usage.Used)
+		assert.Equal(t, uint64(1), usage.Reserved)
+		assert.Equal(t, uint64(math.MaxUint64-2), usage.Free)
+	})
+
+	t.Run("it should return an error if the pool does not exist", func(t *testing.T) {
+		a := newTestAllocator(t, "")
+		_, err := a.Usage(ctx, "net-1")
+		assert.Equal(t, store.ErrNotFound, errors.Cause(err))
+	})
+}
+
+func TestAddressSet_NextFree(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Set    addressSet
+		Max    uint64
+		Offset uint64
+		OK     bool
+	}{
+		{"empty set", addressSet{}, 10, 0, true},
+		{"gap in the set", addressSet{0, 1, 3}, 10, 2, true},
+		{"after the set", addressSet{0, 1, 2}, 10, 3, true},
+		{"full set", addressSet{0, 1, 2}, 2, 0, false},
+		{"full 64 bits range", addressSet{^uint64(0)}, ^uint64(0), 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			offset, ok := c.Set.nextFree(0, c.Max)
+			assert.Equal(t, c.OK, ok)
+			assert.Equal(t, c.Offset, offset)
+		})
+	}
+}
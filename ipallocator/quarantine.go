@@ -0,0 +1,92 @@
+package ipallocator
+
+import (
+	"time"
+)
+
+// releasedOffset is an address released during the quarantine, peers may
+// still have its MAC in their neighbor tables and clients may still have
+// connections to it
+type releasedOffset struct {
+	Offset     uint64    `json:"offset"`
+	ReleasedAt time.Time `json:"released_at"`
+}
+
+// free clears the offset of the subnet i and puts it in quarantine from
+// quarantinedAt, unless it is nil. Excluded addresses are only allocated
+// explicitly, they don't need to be kept out of the automatic allocation.
+func (a *allocation) free(i int, offset uint64, quarantinedAt *time.Time) {
+	a.Subnets[i].clear(offset)
+	_, excluded := a.Subnets[i].excluded(offset)
+	if quarantinedAt != nil && !excluded {
+		a.Subnets[i].quarantine(offset, *quarantinedAt)
+	}
+}
+
+// quarantineStart returns the beginning of the quarantine of the addresses
+// released now, nil if they are not quarantined
+func (a *allocator) quarantineStart() *time.Time {
+	if a.quarantine <= 0 {
+		return nil
+	}
+	now := a.now()
+	return &now
+}
+
+func (s *subnetAllocation) quarantine(offset uint64, now time.Time) {
+	s.unquarantine(offset)
+	s.Quarantine = append(s.Quarantine, releasedOffset{Offset: offset, ReleasedAt: now})
+}
+
+func (s *subnetAllocation) unquarantine(offset uint64) {
+	for i, released := range s.Quarantine {
+		if released.Offset == offset {
+			s.Quarantine = append(s.Quarantine[:i], s.Quarantine[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s subnetAllocation) quarantined(offset uint64) bool {
+	for _, released := range s.Quarantine {
+		if released.Offset == offset {
+			return true
+		}
+	}
+	return false
+}
+
+// expireQuarantine removes the addresses released before since from the
+// quarantine
+func (a *allocation) expireQuarantine(since time.Time) {
+	for i := range a.Subnets {
+		quarantine := a.Subnets[i].Quarantine[:0]
+		for _, released := range a.Subnets[i].Quarantine {
+			if released.ReleasedAt.After(since) {
+				quarantine = append(quarantine, released)
+			}
+		}
+		if len(quarantine) == 0 {
+			quarantine = nil
+		}
+		a.Subnets[i].Quarantine = quarantine
+	}
+}
+
+// oldestQuarantined returns the subnet and the offset of the address released
+// first, ok is false if the quarantine is empty
+func (a *allocation) oldestQuarantined() (int, uint64, bool) {
+	var (
+		found  bool
+		subnet int
+		oldest releasedOffset
+	)
+	for i, s := range a.Subnets {
+		for _, released := range s.Quarantine {
+			if !found || released.ReleasedAt.Before(oldest.ReleasedAt) {
+				found, subnet, oldest = true, i, released
+			}
+		}
+	}
+	return subnet, oldest.Offset, found
+}
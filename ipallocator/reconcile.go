@@ -0,0 +1,107 @@
+package ipallocator
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/netutils"
+)
+
+// Reconciliation is the difference between the addresses allocated in a pool
+// and the addresses in use
+type Reconciliation struct {
+	// Orphaned addresses are allocated but not in use, they are released when
+	// repairing, or kept for their reservation key until it expires
+	Orphaned []string
+	// Unallocated addresses are in use but free in the pool, they are
+	// allocated when repairing if they are in one of the ranges of the pool
+	Unallocated []string
+}
+
+// Reconcile compares the addresses allocated in the pool id with the addresses
+// in use. Reserved addresses are never orphaned.
+func (a *allocator) Reconcile(ctx context.Context, id string, addresses []string, repair bool) (Reconciliation, error) {
+	log := logger.Get(ctx).WithField("allocation_id", id).WithField("repair", repair)
+
+	var reconciliation Reconciliation
+	err := a.update(ctx, id, func(alloc *allocation, found bool) error {
+		reconciliation = Reconciliation{}
+		if !found {
+			// The pool has never been created, none of the addresses is
+			// allocated
+			reconciliation.Unallocated = addresses
+			return errNotModified
+		}
+
+		err := alloc.expireReservations(ctx, a.now())
+		if err != nil {
+			return errors.Wrapf(err, "fail to expire reservations")
+		}
+
+		inUse := map[string]bool{}
+		for _, address := range addresses {
+			ip, _, err := parseAddress(address)
+			if err != nil {
+				return errors.Wrapf(err, "invalid address in use")
+			}
+			inUse[ip.String()] = true
+
+			i, ipnet, err := alloc.subnetOf(ip)
+			if err != nil {
+				reconciliation.Unallocated = append(reconciliation.Unallocated, address)
+				continue
+			}
+			offset, err := netutils.IPOffset(ipnet, ip)
+			if err != nil {
+				return errors.Wrapf(err, "invalid address in use")
+			}
+			if alloc.Subnets[i].test(offset) {
+				continue
+			}
+			reconciliation.Unallocated = append(reconciliation.Unallocated, netutils.ToCIDR(ip, ipnet.Mask))
+			if repair {
+				alloc.Subnets[i].set(offset)
+			}
+		}
+
+		reservationKeys := alloc.reservationKeys()
+		for i, subnet := range alloc.Subnets {
+			ipnet, err := subnet.ipnet()
+			if err != nil {
+				return err
+			}
+			// The allocated offsets are copied as they are cleared while
+			// iterating
+			offsets := append([]uint64{}, subnet.allocated()...)
+			for _, offset := range offsets {
+				ip := netutils.AddIntToIP(ipnet.IP, offset)
+				if subnet.reserved(offset) || inUse[ip.String()] {
+					continue
+				}
+				// Released addresses kept for their reservation key are not leaked
+				key := reservationKeys[ip.String()]
+				if key != "" && alloc.Reservations[key].ExpiresAt != nil {
+					continue
+				}
+				reconciliation.Orphaned = append(reconciliation.Orphaned, netutils.ToCIDR(ip, ipnet.Mask))
+				if repair {
+					alloc.release(i, offset, key, a.reservationExpiration(), a.quarantineStart())
+				}
+			}
+		}
+
+		if !repair || (len(reconciliation.Orphaned) == 0 && len(reconciliation.Unallocated) == 0) {
+			return errNotModified
+		}
+		return nil
+	})
+	if err != nil {
+		return reconciliation, errors.Wrapf(err, "fail to reconcile allocation")
+	}
+	if repair {
+		log.WithField("orphaned", len(reconciliation.Orphaned)).Info("allocation repaired")
+	}
+	return reconciliation, nil
+}
@@ -0,0 +1,187 @@
+package ipallocator
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/netutils"
+	"github.com/Scalingo/sand/store"
+)
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+)
+
+// reservation binds a key chosen by the caller to an address of the pool. The
+// address stays allocated when it is released, it is given back to the next
+// allocation with the same key until the reservation expires.
+type reservation struct {
+	Address string `json:"address"`
+	// ExpiresAt is nil while the address is in use
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// allocateReservedIP returns the address of the reservation key, ok is false
+// if there is no such reservation
+func (a *allocation) allocateReservedIP(ctx context.Context, key string, address string) (string, bool, error) {
+	r, ok := a.Reservations[key]
+	if !ok {
+		return "", false, nil
+	}
+	log := logger.Get(ctx).WithField("reservation_key", key).WithField("ip", r.Address)
+
+	reservedIP, _, err := parseAddress(r.Address)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "invalid reserved address %v", r.Address)
+	}
+	if address != "" {
+		ip, _, err := parseAddress(address)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "fail to parse predefined address '%v'", address)
+		}
+		if !ip.Equal(reservedIP) {
+			return "", false, errors.Errorf("reservation %v is bound to %v", key, r.Address)
+		}
+	}
+	if r.ExpiresAt == nil {
+		return "", false, errors.Errorf("address %v of reservation %v is in use", r.Address, key)
+	}
+	// The prefix length changes if the range has been widened
+	_, ipnet, err := a.subnetOf(reservedIP)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "invalid reserved address")
+	}
+
+	r.ExpiresAt = nil
+	a.Reservations[key] = r
+	log.Info("allocated reserved IP")
+	return netutils.ToCIDR(reservedIP, ipnet.Mask), true, nil
+}
+
+// reserve binds key to an allocated address
+func (a *allocation) reserve(key string, address string) {
+	if a.Reservations == nil {
+		a.Reservations = map[string]reservation{}
+	}
+	a.Reservations[key] = reservation{Address: address}
+}
+
+// reservationOf returns the key of the reservation bound to ip
+func (a *allocation) reservationOf(ip net.IP) (string, bool) {
+	for key, r := range a.Reservations {
+		reservedIP, _, err := parseAddress(r.Address)
+		if err == nil && reservedIP.Equal(ip) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// reservationKeys returns the keys of the reservations by address, to look up
+// the reservations of many addresses
+func (a *allocation) reservationKeys() map[string]string {
+	keys := make(map[string]string, len(a.Reservations))
+	for key, r := range a.Reservations {
+		reservedIP, _, err := parseAddress(r.Address)
+		if err == nil {
+			keys[reservedIP.String()] = key
+		}
+	}
+	return keys
+}
+
+// release frees the address at offset of the subnet i and puts it in
+// quarantine from quarantinedAt. If the reservation key is bound to it, the
+// address is kept until expiresAt, or freed if expiresAt is nil.
+func (a *allocation) release(i int, offset uint64, key string, expiresAt, quarantinedAt *time.Time) bool {
+	if key != "" && expiresAt != nil {
+		r := a.Reservations[key]
+		r.ExpiresAt = expiresAt
+		a.Reservations[key] = r
+		return true
+	}
+	if key != "" {
+		delete(a.Reservations, key)
+	}
+	a.free(i, offset, quarantinedAt)
+	return false
+}
+
+// reservationExpiration returns the expiration of the reservations released
+// now, nil if they are not kept
+func (a *allocator) reservationExpiration() *time.Time {
+	if a.reservationTTL <= 0 {
+		return nil
+	}
+	expiresAt := a.now().Add(a.reservationTTL)
+	return &expiresAt
+}
+
+// expireReservations releases the addresses of the reservations expired at
+// now
+func (a *allocation) expireReservations(ctx context.Context, now time.Time) error {
+	for key, r := range a.Reservations {
+		if r.ExpiresAt == nil || r.ExpiresAt.After(now) {
+			continue
+		}
+		err := a.deleteReservation(key)
+		if err != nil {
+			return errors.Wrapf(err, "fail to expire reservation %v", key)
+		}
+		logger.Get(ctx).WithField("reservation_key", key).WithField("ip", r.Address).Info("reservation expired")
+	}
+	return nil
+}
+
+// deleteReservation removes the reservation key, its address is released
+// unless it is in use. It has not been used since the release of its endpoint,
+// it is not put in quarantine.
+func (a *allocation) deleteReservation(key string) error {
+	r := a.Reservations[key]
+	delete(a.Reservations, key)
+	if r.ExpiresAt == nil {
+		return nil
+	}
+	ip, _, err := parseAddress(r.Address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid reserved address %v", r.Address)
+	}
+	i, ipnet, err := a.subnetOf(ip)
+	if err != nil {
+		// The range of the address has been removed
+		return nil
+	}
+	offset, err := netutils.IPOffset(ipnet, ip)
+	if err != nil {
+		return err
+	}
+	a.free(i, offset, nil)
+	return nil
+}
+
+func (a *allocator) ReleaseReservation(ctx context.Context, id string, key string) error {
+	log := logger.Get(ctx).WithField("allocation_id", id).WithField("reservation_key", key)
+
+	err := a.update(ctx, id, func(alloc *allocation, found bool) error {
+		if !found {
+			return errors.Wrapf(store.ErrNotFound, "fail to get allocation from storage")
+		}
+		if _, ok := alloc.Reservations[key]; !ok {
+			return ErrReservationNotFound
+		}
+		err := alloc.deleteReservation(key)
+		if err != nil {
+			return errors.Wrapf(err, "fail to release reservation")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("reservation released")
+	return nil
+}
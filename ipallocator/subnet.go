@@ -0,0 +1,256 @@
+package ipallocator
+
+import (
+	"context"
+	"net"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/netutils"
+)
+
+// subnetAllocation contains the allocated addresses of one of the ranges of an
+// allocation
+type subnetAllocation struct {
+	AddressRange string `json:"address_range"`
+	AddressCount uint   `json:"address_count"`
+	// BitSet of the allocated addresses of IPv4 ranges
+	BitSet *bitset.BitSet `json:"bit_set,omitempty"`
+	// Offsets of the allocated addresses of IPv6 ranges
+	Offsets addressSet `json:"offsets,omitempty"`
+	// Reserved offsets are allocated for good, releasing them does nothing. The
+	// gateway of the subnet is reserved.
+	Reserved addressSet `json:"reserved,omitempty"`
+	// Exclusions are only allocated when they are requested explicitly
+	Exclusions []offsetRange `json:"exclusions,omitempty"`
+	// Quarantine contains the recently released addresses, they are only
+	// allocated again when all the other addresses of the pool are taken
+	Quarantine []releasedOffset `json:"quarantine,omitempty"`
+}
+
+// offsetRange is a range of offsets of a subnet, First and Last included
+type offsetRange struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
+func newSubnetAllocation(addressRange string) (subnetAllocation, error) {
+	subnet := subnetAllocation{AddressRange: addressRange}
+	_, addressNet, err := net.ParseCIDR(addressRange)
+	if err != nil {
+		return subnet, errors.Wrapf(err, "invalid iprange %v", addressRange)
+	}
+	subnet.AddressRange = addressNet.String()
+
+	if addressNet.IP.To4() == nil {
+		// There is no broadcast address in IPv6, the first address is the
+		// Subnet-Router anycast address
+		subnet.Offsets = addressSet{0}
+		return subnet, nil
+	}
+
+	mask, bits := addressNet.Mask.Size()
+	// 0.0.0.0/24 -> mask = 24, bits = 32
+	// 2^8 -> 256 addresses
+	subnet.AddressCount = uint(1) << uint(bits-mask)
+	// Network and Broadcast addresses are reserved
+	subnet.BitSet = bitset.New(subnet.AddressCount).Set(0).Set(subnet.AddressCount - 1)
+	return subnet, nil
+}
+
+func (s subnetAllocation) ipnet() (*net.IPNet, error) {
+	_, ipnet, err := net.ParseCIDR(s.AddressRange)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to parse allocation address range %v", s.AddressRange)
+	}
+	return ipnet, nil
+}
+
+// allocatePredefinedIP allocates ip, if reserve is true it will never be
+// released
+func (s *subnetAllocation) allocatePredefinedIP(ctx context.Context, ip net.IP, reserve bool) (string, error) {
+	log := logger.Get(ctx).WithField("ip", ip).WithField("ip-range", s.AddressRange)
+
+	ipnet, err := s.ipnet()
+	if err != nil {
+		return "", err
+	}
+	ordinal, err := netutils.IPOffset(ipnet, ip)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid predefined address %v", ip)
+	}
+	if reserve && s.Reserved.test(ordinal) {
+		// Reserving an address again does nothing
+		return netutils.ToCIDR(ip, ipnet.Mask), nil
+	}
+	if s.test(ordinal) {
+		return "", errors.New("ip is already allocated")
+	}
+	s.set(ordinal)
+	if reserve {
+		s.Reserved.set(ordinal)
+	}
+
+	log.WithField("reserved", reserve).Infof("allocated predefined IP (offset %d)", ordinal)
+	return netutils.ToCIDR(ip, ipnet.Mask), nil
+}
+
+// allocateNextAvailableIP returns false if there is no free address in the
+// subnet out of the quarantine
+func (s *subnetAllocation) allocateNextAvailableIP(ctx context.Context) (string, bool, error) {
+	ipnet, err := s.ipnet()
+	if err != nil {
+		return "", false, err
+	}
+
+	i, ok := s.nextFree(netutils.MaxIPOffset(ipnet))
+	if !ok {
+		return "", false, nil
+	}
+	address, err := s.allocateOffset(ctx, i)
+	if err != nil {
+		return "", false, err
+	}
+	return address, true, nil
+}
+
+func (s *subnetAllocation) allocateOffset(ctx context.Context, offset uint64) (string, error) {
+	ipnet, err := s.ipnet()
+	if err != nil {
+		return "", err
+	}
+	s.set(offset)
+	ip := netutils.AddIntToIP(ipnet.IP, offset)
+
+	logger.Get(ctx).WithField("ip", ip).WithField("ip-range", s.AddressRange).Infof("allocated IP (offset %d)", offset)
+	return netutils.ToCIDR(ip, ipnet.Mask), nil
+}
+
+// exclude prevents the automatic allocation of an address or a range of the
+// subnet
+func (s *subnetAllocation) exclude(exclusion string) error {
+	ipnet, err := s.ipnet()
+	if err != nil {
+		return err
+	}
+	ip, exclusionNet, err := parseAddress(exclusion)
+	if err != nil {
+		return errors.Wrapf(err, "invalid exclusion '%v'", exclusion)
+	}
+	first, err := netutils.IPOffset(ipnet, ip)
+	if err != nil {
+		return errors.Wrapf(err, "invalid exclusion '%v'", exclusion)
+	}
+	last := first
+	if exclusionNet != nil {
+		first, err = netutils.IPOffset(ipnet, exclusionNet.IP)
+		if err != nil {
+			return errors.Wrapf(err, "invalid exclusion '%v'", exclusion)
+		}
+		last = first + netutils.MaxIPOffset(exclusionNet)
+		if last < first || last > netutils.MaxIPOffset(ipnet) {
+			return errors.Errorf("exclusion %v is larger than %v", exclusionNet, ipnet)
+		}
+	}
+	s.Exclusions = append(s.Exclusions, offsetRange{First: first, Last: last})
+	return nil
+}
+
+// excluded returns the exclusion containing offset
+func (s subnetAllocation) excluded(offset uint64) (offsetRange, bool) {
+	for _, exclusion := range s.Exclusions {
+		if offset >= exclusion.First && offset <= exclusion.Last {
+			return exclusion, true
+		}
+	}
+	return offsetRange{}, false
+}
+
+// boundary returns true for the offsets set when the subnet is created
+func (s subnetAllocation) boundary(offset uint64) bool {
+	if s.BitSet != nil {
+		return offset == 0 || offset == uint64(s.AddressCount)-1
+	}
+	return offset == 0
+}
+
+// reserved returns true for the offsets which are never released
+func (s subnetAllocation) reserved(offset uint64) bool {
+	return s.boundary(offset) || s.Reserved.test(offset)
+}
+
+// allocated returns the offsets of the allocated addresses, reserved ones
+// included
+func (s subnetAllocation) allocated() []uint64 {
+	if s.BitSet == nil {
+		return s.Offsets
+	}
+	var offsets []uint64
+	for i, ok := s.BitSet.NextSet(0); ok; i, ok = s.BitSet.NextSet(i + 1) {
+		offsets = append(offsets, uint64(i))
+	}
+	return offsets
+}
+
+// nextFree returns the first free offset which is neither excluded nor in
+// quarantine
+func (s *subnetAllocation) nextFree(max uint64) (uint64, bool) {
+	var from uint64
+	for {
+		i, ok := s.nextClear(from, max)
+		if !ok {
+			return 0, false
+		}
+		exclusion, excluded := s.excluded(i)
+		if !excluded && !s.quarantined(i) {
+			return i, true
+		}
+		next := i
+		if excluded {
+			next = exclusion.Last
+		}
+		if next >= max {
+			return 0, false
+		}
+		from = next + 1
+	}
+}
+
+// test, set, clear and nextClear use the bit set of IPv4 ranges or the sparse
+// set of IPv6 ranges
+func (s *subnetAllocation) test(offset uint64) bool {
+	if s.BitSet != nil {
+		return s.BitSet.Test(uint(offset))
+	}
+	return s.Offsets.test(offset)
+}
+
+func (s *subnetAllocation) set(offset uint64) {
+	s.unquarantine(offset)
+	if s.BitSet != nil {
+		s.BitSet.Set(uint(offset))
+		return
+	}
+	s.Offsets.set(offset)
+}
+
+func (s *subnetAllocation) clear(offset uint64) {
+	if s.BitSet != nil {
+		s.BitSet.Clear(uint(offset))
+		return
+	}
+	s.Offsets.clear(offset)
+}
+
+func (s *subnetAllocation) nextClear(from, max uint64) (uint64, bool) {
+	if s.BitSet != nil {
+		i, ok := s.BitSet.NextClear(uint(from))
+		if !ok || uint64(i) > max {
+			return 0, false
+		}
+		return uint64(i), true
+	}
+	return s.Offsets.nextFree(from, max)
+}
@@ -0,0 +1,28 @@
+package ipallocator
+
+import (
+	"context"
+
+	"github.com/Scalingo/sand/store"
+)
+
+// errNotModified is returned by an update function when there is nothing to
+// save
+var errNotModified = store.ErrNotModified
+
+// update reads the allocation id, applies fn and saves the result if the
+// allocation has not been modified in the meantime, in which case fn is
+// applied again on its new version. found is false if the allocation does not
+// exist yet.
+func (a *allocator) update(ctx context.Context, id string, fn func(alloc *allocation, found bool) error) error {
+	key := allocation{ID: id}.storageKey()
+	var alloc allocation
+	return store.Update(ctx, a.store, key, &alloc, func(found bool) ([]store.Op, error) {
+		alloc.ID = id
+		err := fn(&alloc, found)
+		if err != nil {
+			return nil, err
+		}
+		return []store.Op{store.OpSet(key, &alloc)}, nil
+	})
+}
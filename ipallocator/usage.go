@@ -0,0 +1,125 @@
+package ipallocator
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/netutils"
+	"github.com/Scalingo/sand/store"
+)
+
+// Usage counts the addresses of a pool. Counts of IPv6 ranges larger than a
+// /64 are capped to math.MaxUint64.
+type Usage struct {
+	Ranges []string
+	Total  uint64
+	// Used addresses are allocated to endpoints or kept for a reservation key
+	Used uint64
+	// Reserved addresses are never allocated automatically: network,
+	// broadcast and gateway addresses, and the free excluded addresses
+	Reserved uint64
+	Free     uint64
+	// Allocated are the addresses allocated in the pool, gateways included
+	Allocated []AllocatedAddress
+}
+
+type AllocatedAddress struct {
+	Address string
+	// Reserved is true for the addresses which are never released
+	Reserved bool
+	// ReservationKey is set if the address is bound to a reservation key
+	ReservationKey string
+}
+
+// Usage returns the usage of the pool id, the pool is not modified
+func (a *allocator) Usage(ctx context.Context, id string) (Usage, error) {
+	var usage Usage
+	alloc := allocation{ID: id}
+	err := a.store.Get(ctx, alloc.storageKey(), false, &alloc)
+	if err == store.ErrNotFound {
+		return usage, errors.Wrapf(err, "allocation %v not found", id)
+	} else if err != nil {
+		return usage, errors.Wrapf(err, "fail to get allocation from storage")
+	}
+
+	// Expired reservations are not saved, their addresses are only counted as
+	// free
+	err = alloc.expireReservations(ctx, a.now())
+	if err != nil {
+		return usage, errors.Wrapf(err, "fail to expire reservations")
+	}
+
+	reservationKeys := alloc.reservationKeys()
+	for _, subnet := range alloc.Subnets {
+		ipnet, err := subnet.ipnet()
+		if err != nil {
+			return usage, err
+		}
+		usage.Ranges = append(usage.Ranges, subnet.AddressRange)
+		usage.Total = addCapped(usage.Total, addCapped(netutils.MaxIPOffset(ipnet), 1))
+
+		exclusions := subnet.mergedExclusions()
+		for _, exclusion := range exclusions {
+			usage.Reserved = addCapped(usage.Reserved, addCapped(exclusion.Last-exclusion.First, 1))
+		}
+		for _, offset := range subnet.allocated() {
+			// Allocated excluded addresses are not free excluded addresses
+			for _, exclusion := range exclusions {
+				if offset >= exclusion.First && offset <= exclusion.Last {
+					usage.Reserved--
+					break
+				}
+			}
+			if subnet.reserved(offset) {
+				usage.Reserved = addCapped(usage.Reserved, 1)
+			} else {
+				usage.Used++
+			}
+			if subnet.boundary(offset) {
+				continue
+			}
+
+			ip := netutils.AddIntToIP(ipnet.IP, offset)
+			address := AllocatedAddress{
+				Address:        netutils.ToCIDR(ip, ipnet.Mask),
+				Reserved:       subnet.reserved(offset),
+				ReservationKey: reservationKeys[ip.String()],
+			}
+			usage.Allocated = append(usage.Allocated, address)
+		}
+	}
+	if taken := addCapped(usage.Used, usage.Reserved); taken < usage.Total {
+		usage.Free = usage.Total - taken
+	}
+	return usage, nil
+}
+
+// mergedExclusions returns the exclusions sorted and without overlap
+func (s subnetAllocation) mergedExclusions() []offsetRange {
+	exclusions := append([]offsetRange{}, s.Exclusions...)
+	sort.Slice(exclusions, func(i, j int) bool {
+		return exclusions[i].First < exclusions[j].First
+	})
+	var merged []offsetRange
+	for _, exclusion := range exclusions {
+		last := len(merged) - 1
+		if last >= 0 && exclusion.First <= merged[last].Last {
+			if exclusion.Last > merged[last].Last {
+				merged[last].Last = exclusion.Last
+			}
+			continue
+		}
+		merged = append(merged, exclusion)
+	}
+	return merged
+}
+
+func addCapped(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
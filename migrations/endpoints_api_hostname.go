@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/store"
+)
+
+func backfillEndpointsAPIHostname(ctx context.Context, s store.Store, dryRun bool) ([]Change, error) {
+	var endpoints []types.Endpoint
+	err := s.Get(ctx, types.EndpointStoragePrefix+"/", true, &endpoints)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list endpoints")
+	}
+
+	var changes []Change
+	for _, endpoint := range endpoints {
+		if endpoint.APIHostname != "" {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:         endpoint.StorageKey(),
+			Description: fmt.Sprintf("set api_hostname to '%s'", endpoint.Hostname),
+		})
+		if dryRun {
+			continue
+		}
+
+		err := setEndpointAPIHostname(ctx, s, endpoint.StorageKey())
+		if err != nil {
+			return changes, errors.Wrapf(err, "fail to migrate endpoint %s", endpoint)
+		}
+	}
+	return changes, nil
+}
+
+// setEndpointAPIHostname writes the endpoint in its node and network keys,
+// unless it has been modified since it has been read
+func setEndpointAPIHostname(ctx context.Context, s store.Store, key string) error {
+	var endpoint types.Endpoint
+	return store.Update(ctx, s, key, &endpoint, func(found bool) ([]store.Op, error) {
+		// The endpoint may have been deleted in the meantime
+		if !found || endpoint.APIHostname != "" {
+			return nil, store.ErrNotModified
+		}
+
+		endpoint.APIHostname = endpoint.Hostname
+		return []store.Op{
+			store.OpSet(endpoint.StorageKey(), &endpoint),
+			store.OpSet(endpoint.NetworkStorageKey(), &endpoint),
+		}, nil
+	})
+}
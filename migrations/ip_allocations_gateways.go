@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/netutils"
+	"github.com/Scalingo/sand/store"
+)
+
+// gatewaysPool is an IP allocation pool of a network and the gateways of its
+// subnets
+type gatewaysPool struct {
+	id       string
+	gateways []string
+}
+
+func reserveIPAllocationsGateways(ctx context.Context, s store.Store, dryRun bool) ([]Change, error) {
+	var networks []types.Network
+	err := s.Get(ctx, "/network/", true, &networks)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list networks")
+	}
+
+	var changes []Change
+	for _, network := range networks {
+		var gateways []string
+		for _, subnet := range network.IPv4Subnets() {
+			gateways = append(gateways, subnet.Gateway)
+		}
+		pools := []gatewaysPool{{id: network.ID, gateways: gateways}}
+		if network.IPv6Gateway != "" {
+			pools = append(pools, gatewaysPool{id: network.IPv6PoolID(), gateways: []string{network.IPv6Gateway}})
+		}
+
+		for _, pool := range pools {
+			key := fmt.Sprintf("%s/%s", ipallocator.IPAllocatorPrefix, pool.id)
+			changes = append(changes, Change{
+				Key:         key,
+				Description: fmt.Sprintf("reserve gateways %v", pool.gateways),
+			})
+			if dryRun {
+				continue
+			}
+
+			err := setIPAllocationReserved(ctx, s, key, pool.gateways)
+			if err != nil {
+				return changes, errors.Wrapf(err, "fail to migrate IP allocation %s", pool.id)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// setIPAllocationReserved allocates and reserves the gateways in the subnets
+// containing them, unless the allocation has been modified since it has been
+// read
+func setIPAllocationReserved(ctx context.Context, s store.Store, key string, gateways []string) error {
+	var allocation types.IPAllocation
+	return store.Update(ctx, s, key, &allocation, func(found bool) ([]store.Op, error) {
+		if !found {
+			return nil, store.ErrNotModified
+		}
+		for _, gateway := range gateways {
+			err := reserveGateway(&allocation, gateway)
+			if err != nil {
+				return nil, errors.Wrapf(err, "fail to reserve gateway %v", gateway)
+			}
+		}
+		return []store.Op{store.OpSet(key, &allocation)}, nil
+	})
+}
+
+func reserveGateway(allocation *types.IPAllocation, gateway string) error {
+	ip, _, err := net.ParseCIDR(gateway)
+	if err != nil {
+		return errors.Wrapf(err, "invalid gateway")
+	}
+	for i, subnet := range allocation.Subnets {
+		_, ipnet, err := net.ParseCIDR(subnet.AddressRange)
+		if err != nil || !ipnet.Contains(ip) {
+			continue
+		}
+		offset, err := netutils.IPOffset(ipnet, ip)
+		if err != nil {
+			return err
+		}
+
+		if len(subnet.BitSet) != 0 {
+			var bits bitset.BitSet
+			err := json.Unmarshal(subnet.BitSet, &bits)
+			if err != nil {
+				return errors.Wrapf(err, "invalid bit set of %v", subnet.AddressRange)
+			}
+			subnet.BitSet, err = json.Marshal(bits.Set(uint(offset)))
+			if err != nil {
+				return errors.Wrapf(err, "fail to serialize bit set of %v", subnet.AddressRange)
+			}
+		} else {
+			subnet.Offsets = addOffset(subnet.Offsets, offset)
+		}
+		subnet.Reserved = addOffset(subnet.Reserved, offset)
+		allocation.Subnets[i] = subnet
+		return nil
+	}
+	return errors.Errorf("not in the ranges of allocation %v", allocation.ID)
+}
+
+// addOffset inserts offset in the sorted offsets if it is not there yet
+func addOffset(offsets []uint64, offset uint64) []uint64 {
+	i := sort.Search(len(offsets), func(i int) bool { return offsets[i] >= offset })
+	if i < len(offsets) && offsets[i] == offset {
+		return offsets
+	}
+	offsets = append(offsets, 0)
+	copy(offsets[i+1:], offsets[i:])
+	offsets[i] = offset
+	return offsets
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/store"
+)
+
+// legacyIPAllocation is an IP allocation written before networks could have
+// several subnets, its range is the first subnet of the new format
+type legacyIPAllocation struct {
+	ID           string          `json:"id"`
+	AddressRange string          `json:"address_range"`
+	AddressCount uint            `json:"address_count"`
+	BitSet       json.RawMessage `json:"bit_set,omitempty"`
+	Offsets      []uint64        `json:"offsets,omitempty"`
+}
+
+func (a legacyIPAllocation) storageKey() string {
+	return fmt.Sprintf("%s/%s", ipallocator.IPAllocatorPrefix, a.ID)
+}
+
+func splitIPAllocationsSubnets(ctx context.Context, s store.Store, dryRun bool) ([]Change, error) {
+	var allocations []legacyIPAllocation
+	err := s.Get(ctx, ipallocator.IPAllocatorPrefix+"/", true, &allocations)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list IP allocations")
+	}
+
+	var changes []Change
+	for _, allocation := range allocations {
+		if allocation.AddressRange == "" {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:         allocation.storageKey(),
+			Description: fmt.Sprintf("move range %s in subnets", allocation.AddressRange),
+		})
+		if dryRun {
+			continue
+		}
+
+		err := setIPAllocationSubnets(ctx, s, allocation.storageKey())
+		if err != nil {
+			return changes, errors.Wrapf(err, "fail to migrate IP allocation %s", allocation.ID)
+		}
+	}
+	return changes, nil
+}
+
+// setIPAllocationSubnets rewrites the allocation in the new format, unless it
+// has been modified since it has been read
+func setIPAllocationSubnets(ctx context.Context, s store.Store, key string) error {
+	var legacy legacyIPAllocation
+	return store.Update(ctx, s, key, &legacy, func(found bool) ([]store.Op, error) {
+		if !found || legacy.AddressRange == "" {
+			return nil, store.ErrNotModified
+		}
+
+		allocation := types.IPAllocation{
+			ID: legacy.ID,
+			Subnets: []types.IPAllocationSubnet{{
+				AddressRange: legacy.AddressRange,
+				AddressCount: legacy.AddressCount,
+				BitSet:       legacy.BitSet,
+				Offsets:      legacy.Offsets,
+			}},
+		}
+		return []store.Op{store.OpSet(key, &allocation)}, nil
+	})
+}
@@ -0,0 +1,134 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-etcd-lock/v5/lock"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/store"
+)
+
+const (
+	// SchemaVersionKey is the key of the store where the version of the schema
+	// of the data is written, it is the version of the last migration applied
+	SchemaVersionKey = "/schema-version"
+
+	schemaLockKey = "/sand-schema-migration"
+	schemaLockTTL = 300
+)
+
+// Migration transforms the data of the store from the previous version of the
+// schema to Version. Migrations are run while agents with the previous version
+// may still be running, they should not break the data read by these agents.
+type Migration struct {
+	Version     int
+	Description string
+	// Up applies the migration. When dryRun is true, nothing is written and the
+	// changes which would have been done are returned.
+	Up func(ctx context.Context, s store.Store, dryRun bool) ([]Change, error)
+}
+
+// Change describes a modification done by a migration on a key
+type Change struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Result is the report of a migration which has been run
+type Result struct {
+	Version     int      `json:"version"`
+	Description string   `json:"description"`
+	Changes     []Change `json:"changes"`
+}
+
+type SchemaVersion struct {
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Migrator interface {
+	// Run applies the migrations more recent than the schema version of the
+	// store, in order. The schema version is updated after each of them.
+	Run(ctx context.Context, dryRun bool) ([]Result, error)
+}
+
+type migrator struct {
+	store      store.Store
+	locker     lock.Locker
+	migrations []Migration
+}
+
+// New returns a Migrator applying the migrations of the registry
+func New(s store.Store, locker lock.Locker) Migrator {
+	return &migrator{store: s, locker: locker, migrations: registry}
+}
+
+func (m *migrator) Run(ctx context.Context, dryRun bool) ([]Result, error) {
+	log := logger.Get(ctx)
+
+	// A dry run doesn't write anything, it doesn't need to wait for the other
+	// agents
+	if !dryRun {
+		l, err := m.locker.WaitAcquire(schemaLockKey, schemaLockTTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to get schema migration lock")
+		}
+		defer l.Release()
+	}
+
+	current, err := CurrentVersion(ctx, m.store)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get schema version")
+	}
+	latest := 0
+	if len(m.migrations) > 0 {
+		latest = m.migrations[len(m.migrations)-1].Version
+	}
+	if current > latest {
+		return nil, errors.Errorf("schema version of the store (%d) is more recent than the one of this agent (%d)", current, latest)
+	}
+
+	var results []Result
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		log := log.WithField("schema_version", migration.Version)
+		log.Infof("running migration: %s", migration.Description)
+
+		changes, err := migration.Up(ctx, m.store, dryRun)
+		if err != nil {
+			return results, errors.Wrapf(err, "fail to run migration %d", migration.Version)
+		}
+		results = append(results, Result{
+			Version: migration.Version, Description: migration.Description, Changes: changes,
+		})
+		if dryRun {
+			continue
+		}
+
+		err = m.store.Set(ctx, SchemaVersionKey, SchemaVersion{Version: migration.Version, UpdatedAt: time.Now()})
+		if err != nil {
+			return results, errors.Wrapf(err, "fail to update schema version to %d", migration.Version)
+		}
+		log.WithField("changes_count", len(changes)).Info("migration applied")
+	}
+	return results, nil
+}
+
+// CurrentVersion returns the schema version of the data of the store, 0 if no
+// migration has ever been applied
+func CurrentVersion(ctx context.Context, s store.Store) (int, error) {
+	var version SchemaVersion
+	err := s.Get(ctx, SchemaVersionKey, false, &version)
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "fail to read %v", SchemaVersionKey)
+	}
+	return version.Version, nil
+}
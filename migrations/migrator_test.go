@@ -0,0 +1,175 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/idmanager"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Run("migrations should be ordered by version starting at 1", func(t *testing.T) {
+		for i, migration := range registry {
+			assert.Equal(t, i+1, migration.Version)
+			assert.NotEmpty(t, migration.Description)
+			assert.NotNil(t, migration.Up)
+		}
+	})
+}
+
+func TestMigrator_Run(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	legacy := types.Endpoint{ID: "1", NetworkID: "net", Hostname: "node-1"}
+	recent := types.Endpoint{ID: "2", NetworkID: "net", Hostname: "node-1", APIHostname: "api.node-1"}
+	newStore := func(t *testing.T) store.Store {
+		s := store.NewMemory(config)
+		for _, e := range []types.Endpoint{legacy, recent} {
+			require.NoError(t, s.Txn(ctx, nil, store.OpSet(e.StorageKey(), e), store.OpSet(e.NetworkStorageKey(), e)))
+		}
+		return s
+	}
+
+	t.Run("it should apply the migrations and update the schema version", func(t *testing.T) {
+		s := newStore(t)
+		m := New(s, store.NewMemoryLocker())
+
+		results, err := m.Run(ctx, false)
+		require.NoError(t, err)
+		require.Len(t, results, len(registry))
+		assert.Equal(t, []Change{{Key: legacy.StorageKey(), Description: "set api_hostname to 'node-1'"}}, results[0].Changes)
+
+		for _, key := range []string{legacy.StorageKey(), legacy.NetworkStorageKey()} {
+			var endpoint types.Endpoint
+			require.NoError(t, s.Get(ctx, key, false, &endpoint))
+			assert.Equal(t, "node-1", endpoint.APIHostname)
+		}
+		var version SchemaVersion
+		require.NoError(t, s.Get(ctx, SchemaVersionKey, false, &version))
+		assert.Equal(t, len(registry), version.Version)
+
+		results, err = m.Run(ctx, false)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+
+	t.Run("it should only report the changes in dry run", func(t *testing.T) {
+		s := newStore(t)
+		m := New(s, store.NewMemoryLocker())
+
+		results, err := m.Run(ctx, true)
+		require.NoError(t, err)
+		require.Len(t, results, len(registry))
+		assert.Len(t, results[0].Changes, 1)
+
+		var endpoint types.Endpoint
+		require.NoError(t, s.Get(ctx, legacy.StorageKey(), false, &endpoint))
+		assert.Empty(t, endpoint.APIHostname)
+		assert.Equal(t, store.ErrNotFound, s.Get(ctx, SchemaVersionKey, false, &SchemaVersion{}))
+	})
+
+	t.Run("it should refuse to run if the schema is more recent than the agent", func(t *testing.T) {
+		s := newStore(t)
+		require.NoError(t, s.Set(ctx, SchemaVersionKey, SchemaVersion{Version: len(registry) + 1}))
+		m := New(s, store.NewMemoryLocker())
+
+		_, err := m.Run(ctx, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "more recent")
+	})
+}
+
+func TestSplitIPAllocationsSubnets(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	// 10.0.0.1 was allocated before the migration
+	bits, err := json.Marshal(bitset.New(4).Set(0).Set(1).Set(3))
+	require.NoError(t, err)
+	s := store.NewMemory(config)
+	require.NoError(t, s.Set(ctx, "/ipalloc/net-1", legacyIPAllocation{
+		ID: "net-1", AddressRange: "10.0.0.0/30", AddressCount: 4, BitSet: bits,
+	}))
+
+	changes, err := splitIPAllocationsSubnets(ctx, s, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Key: "/ipalloc/net-1", Description: "move range 10.0.0.0/30 in subnets"}}, changes)
+
+	a := ipallocator.New(config, s)
+	ip, err := a.AllocateIP(ctx, "net-1", ipallocator.AllocateIPOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2/30", ip)
+
+	changes, err = splitIPAllocationsSubnets(ctx, s, false)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestReserveIPAllocationsGateways(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	bits, err := json.Marshal(bitset.New(4).Set(0).Set(1).Set(3))
+	require.NoError(t, err)
+	s := store.NewMemory(config)
+	network := types.Network{ID: "net-1", IPRange: "10.0.0.0/30", Gateway: "10.0.0.1/30"}
+	require.NoError(t, s.Set(ctx, network.StorageKey(), network))
+	require.NoError(t, s.Set(ctx, "/ipalloc/net-1", types.IPAllocation{
+		ID: "net-1", Subnets: []types.IPAllocationSubnet{{AddressRange: "10.0.0.0/30", AddressCount: 4, BitSet: bits}},
+	}))
+
+	changes, err := reserveIPAllocationsGateways(ctx, s, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Key: "/ipalloc/net-1", Description: "reserve gateways [10.0.0.1/30]"}}, changes)
+
+	// Releasing the gateway does not make it available
+	a := ipallocator.New(config, s)
+	require.NoError(t, a.ReleaseIP(ctx, "net-1", "10.0.0.1/30"))
+	ip, err := a.AllocateIP(ctx, "net-1", ipallocator.AllocateIPOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2/30", ip)
+	_, err = a.AllocateIP(ctx, "net-1", ipallocator.AllocateIPOpts{})
+	require.Error(t, err)
+}
+
+func TestAllocateNetworksVNIs(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+	config.MaxVNI = 10
+
+	s := store.NewMemory(config)
+	for _, network := range []types.Network{{ID: "net-1", VxLANVNI: 1}, {ID: "net-2", VxLANVNI: 3}} {
+		require.NoError(t, s.Set(ctx, network.StorageKey(), network))
+	}
+
+	changes, err := allocateNetworksVNIs(ctx, s, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{{Key: "/idmanager/vni", Description: "allocate VNIs [1 3]"}}, changes)
+
+	// The VNIs of the existing networks are not allocated again
+	vni, err := overlay.NewVNIGenerator(config, s).Generate(ctx, []idmanager.Range{{First: 1, Last: 10}}, func(int) []store.Op {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, vni)
+	vni, err = overlay.NewVNIGenerator(config, s).Generate(ctx, []idmanager.Range{{First: 1, Last: 10}}, func(int) []store.Op {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, vni)
+}
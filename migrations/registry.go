@@ -0,0 +1,23 @@
+package migrations
+
+// registry is the list of the migrations, ordered by version. A migration
+// must never be modified or removed once released, add a new one instead.
+var registry = []Migration{
+	{
+		Version:     1,
+		Description: "backfill api_hostname of the endpoints created before it existed",
+		Up:          backfillEndpointsAPIHostname,
+	}, {
+		Version:     2,
+		Description: "move the range of the IP allocations in a list of subnets",
+		Up:          splitIPAllocationsSubnets,
+	}, {
+		Version:     3,
+		Description: "reserve the gateways in the IP allocations, they are never released",
+		Up:          reserveIPAllocationsGateways,
+	}, {
+		Version:     4,
+		Description: "allocate the VNIs of the networks in the bitmap of the VNI allocator",
+		Up:          allocateNetworksVNIs,
+	},
+}
@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/idmanager"
+	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
+)
+
+func allocateNetworksVNIs(ctx context.Context, s store.Store, dryRun bool) ([]Change, error) {
+	var networks []types.Network
+	err := s.Get(ctx, "/network/", true, &networks)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list networks")
+	}
+
+	var vnis []int
+	for _, network := range networks {
+		if network.VxLANVNI > 0 {
+			vnis = append(vnis, network.VxLANVNI)
+		}
+	}
+	if len(vnis) == 0 {
+		return nil, nil
+	}
+	sort.Ints(vnis)
+
+	key := idmanager.StorageKey(overlay.IDManagerName)
+	changes := []Change{{
+		Key:         key,
+		Description: fmt.Sprintf("allocate VNIs %v", vnis),
+	}}
+	if dryRun {
+		return changes, nil
+	}
+
+	err = setVNIsAllocated(ctx, s, key, vnis)
+	if err != nil {
+		return changes, errors.Wrapf(err, "fail to migrate VNIs")
+	}
+	return changes, nil
+}
+
+// setVNIsAllocated sets the VNIs in the bitmap of the allocated VNIs, unless
+// it has been modified since it has been read
+func setVNIsAllocated(ctx context.Context, s store.Store, key string, vnis []int) error {
+	var ids idmanager.IDs
+	return store.Update(ctx, s, key, &ids, func(bool) ([]store.Op, error) {
+		if ids.BitSet == nil {
+			ids.BitSet = bitset.New(0)
+		}
+		for _, vni := range vnis {
+			ids.BitSet.Set(uint(vni))
+		}
+		return []store.Op{store.OpSet(key, &ids)}, nil
+	})
+}
@@ -2,6 +2,7 @@ package netutils
 
 import (
 	"fmt"
+	"math/big"
 	"net"
 
 	"gopkg.in/errgo.v1"
@@ -18,15 +19,58 @@ func DefaultGateway(cidr string) (string, error) {
 
 // Adds the ordinal IP to the current array
 // 192.168.0.0 + 53 => 192.168.0.53
+// fd00:: + 53 => fd00::35
 func AddIntToIP(ip net.IP, ordinal uint64) net.IP {
-	ip = ip.To4()
-	v := uint64(ip[0])<<24 + uint64(ip[1])<<16 + uint64(ip[2])<<8 + uint64(ip[3])
-	v += ordinal
-	v3 := byte(v & 0xFF)
-	v2 := byte((v >> 8) & 0xFF)
-	v1 := byte((v >> 16) & 0xFF)
-	v0 := byte((v >> 24) & 0xFF)
-	return net.IPv4(v0, v1, v2, v3)
+	if ip4 := ip.To4(); ip4 != nil {
+		v := uint64(ip4[0])<<24 + uint64(ip4[1])<<16 + uint64(ip4[2])<<8 + uint64(ip4[3])
+		v += ordinal
+		v3 := byte(v & 0xFF)
+		v2 := byte((v >> 8) & 0xFF)
+		v1 := byte((v >> 16) & 0xFF)
+		v0 := byte((v >> 24) & 0xFF)
+		return net.IPv4(v0, v1, v2, v3)
+	}
+
+	v := new(big.Int).SetBytes(ip.To16())
+	v.Add(v, new(big.Int).SetUint64(ordinal))
+	b := v.Bytes()
+	// Overflowing ffff:... wraps around like IPv4 addresses do
+	if len(b) > net.IPv6len {
+		b = b[len(b)-net.IPv6len:]
+	}
+	result := make(net.IP, net.IPv6len)
+	copy(result[net.IPv6len-len(b):], b)
+	return result
+}
+
+// IPOffset returns the position of ip in ipnet, the network address being at
+// offset 0. Offsets of IPv6 networks larger than /64 are limited to 64 bits.
+func IPOffset(ipnet *net.IPNet, ip net.IP) (uint64, error) {
+	if !ipnet.Contains(ip) {
+		return 0, errgo.Newf("%v is not in %v", ip, ipnet)
+	}
+	base := ipnet.IP.To16()
+	if ipnet.IP.To4() != nil {
+		base = ipnet.IP.To4()
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	offset := new(big.Int).Sub(new(big.Int).SetBytes(ip), new(big.Int).SetBytes(base))
+	if !offset.IsUint64() {
+		return 0, errgo.Newf("%v is too far from the start of %v", ip, ipnet)
+	}
+	return offset.Uint64(), nil
+}
+
+// MaxIPOffset returns the offset of the last address of ipnet, capped to the
+// largest uint64 for IPv6 networks larger than /64
+func MaxIPOffset(ipnet *net.IPNet) uint64 {
+	ones, bits := ipnet.Mask.Size()
+	if bits-ones >= 64 {
+		return ^uint64(0)
+	}
+	return uint64(1)<<uint(bits-ones) - 1
 }
 
 func ToCIDR(ip net.IP, mask net.IPMask) string {
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAddIntToIP(t *testing.T) {
@@ -20,6 +21,10 @@ func TestAddIntToIP(t *testing.T) {
 		{"10.0.255.255", 1, "10.1.0.0"},
 		{"10.0.0.0", 10, "10.0.0.10"},
 		{"10.0.0.1", 256, "10.0.1.1"},
+		{"fd00::", 1, "fd00::1"},
+		{"fd00::ffff", 1, "fd00::1:0"},
+		{"fd00::", 1 << 32, "fd00::1:0:0"},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 1, "::"},
 	}
 
 	for _, c := range cases {
@@ -30,3 +35,34 @@ func TestAddIntToIP(t *testing.T) {
 		})
 	}
 }
+
+func TestIPOffset(t *testing.T) {
+	cases := []struct {
+		Network string
+		IP      string
+		Offset  uint64
+		Error   string
+	}{
+		{"10.0.0.0/24", "10.0.0.0", 0, ""},
+		{"10.0.0.0/24", "10.0.0.42", 42, ""},
+		{"10.0.0.0/16", "10.0.1.5", 261, ""},
+		{"10.0.0.0/24", "10.0.1.5", 0, "is not in"},
+		{"fd00::/64", "fd00::1:0", 65536, ""},
+		{"fd00::/48", "fd00:0:0:1::", 0, "too far"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s in %s", c.IP, c.Network), func(t *testing.T) {
+			_, ipnet, err := net.ParseCIDR(c.Network)
+			require.NoError(t, err)
+			offset, err := IPOffset(ipnet, net.ParseIP(c.IP))
+			if c.Error != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), c.Error)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.Offset, offset)
+		})
+	}
+}
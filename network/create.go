@@ -15,6 +15,7 @@ import (
 	"github.com/Scalingo/sand/api/types"
 	"github.com/Scalingo/sand/idmanager"
 	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
 )
 
 var (
@@ -22,7 +23,6 @@ var (
 )
 
 func (r *repository) Create(ctx context.Context, params params.NetworkCreate) (types.Network, error) {
-	var err error
 	log := logger.Get(ctx).WithField("network_name", params.Name)
 	log.Info("Create network")
 
@@ -38,17 +38,42 @@ func (r *repository) Create(ctx context.Context, params params.NetworkCreate) (t
 		uuid = params.ID
 	}
 
+	if params.VxLANPort == 0 {
+		params.VxLANPort = r.config.VxLANPort
+	}
+	if params.VxLANSourcePortRange == "" {
+		params.VxLANSourcePortRange = r.config.VxLANSourcePortRange
+	}
+
+	if params.VTEPFamily == "" {
+		// Networks are created with the family of the node creating them
+		params.VTEPFamily = types.VTEPFamilyIPv4
+		family, err := overlay.VTEPFamily(r.config.GetPeerIP())
+		if err == nil {
+			params.VTEPFamily = family
+		}
+	}
+
 	if params.Name == "" {
 		params.Name = fmt.Sprintf("net-sc-%s", uuid)
 	}
 
 	network := types.Network{
-		CreatedAt: time.Now(),
-		ID:        uuid,
-		IPRange:   params.IPRange,
-		Gateway:   params.Gateway,
-		Name:      params.Name,
-		Type:      params.Type,
+		CreatedAt:            time.Now(),
+		ID:                   uuid,
+		IPRange:              params.IPRange,
+		Gateway:              params.Gateway,
+		IPv6Range:            params.IPv6Range,
+		IPv6Gateway:          params.IPv6Gateway,
+		ReservedAddresses:    params.ReservedAddresses,
+		ReservedRanges:       params.ReservedRanges,
+		Infrastructure:       params.Infrastructure,
+		MTU:                  params.MTU,
+		VxLANPort:            params.VxLANPort,
+		VxLANSourcePortRange: params.VxLANSourcePortRange,
+		VTEPFamily:           params.VTEPFamily,
+		Name:                 params.Name,
+		Type:                 params.Type,
 		NSHandlePath: filepath.Join(
 			r.config.NetnsPath, fmt.Sprintf("%s%s", r.config.NetnsPrefix, uuid),
 		),
@@ -56,37 +81,38 @@ func (r *repository) Create(ctx context.Context, params params.NetworkCreate) (t
 	log = log.WithField("network_id", network.ID)
 	ctx = logger.ToCtx(ctx, log)
 
-	vniGen := overlay.NewVNIGenerator(ctx, r.config, r.store)
-	var idlock idmanager.Unlocker
-	switch network.Type {
-	case types.OverlayNetworkType:
-		idlock, err = vniGen.Lock(ctx)
+	switch {
+	case network.Type == types.OverlayNetworkType && params.VxLANVNI != 0:
+		network.VxLANVNI = params.VxLANVNI
+		err := r.saveWithVNI(ctx, network)
 		if err != nil {
-			return network, errors.Wrapf(err, "fail to lock VNI generator for %s", network)
+			return network, errors.Wrapf(err, "fail to save %s with VNI %d", network, network.VxLANVNI)
 		}
-		vni, err := vniGen.Generate(ctx)
+	case network.Type == types.OverlayNetworkType:
+		ranges, err := overlay.VNIRanges(r.config, network.Infrastructure)
 		if err != nil {
-			return network, errors.Wrapf(err, "fail to generate VNI for %s", network)
+			return network, errors.Wrapf(err, "fail to get VNI ranges for %s", network)
+		}
+		// The bitmap may not know the VNIs of the networks created by older
+		// agents
+		used, err := r.usedVNIs(ctx)
+		if err != nil {
+			return network, errors.Wrapf(err, "fail to get VNIs of the networks")
+		}
+		ranges = idmanager.Subtract(ranges, used)
+		// The network is saved in the same transaction as its VNI
+		vni, err := overlay.NewVNIGenerator(r.config, r.store).Generate(ctx, ranges, func(vni int) []store.Op {
+			network.VxLANVNI = vni
+			return []store.Op{store.OpSet(network.StorageKey(), &network)}
+		})
+		if err != nil {
+			return network, errors.Wrapf(err, "fail to save %s with a new VNI", network)
 		}
-
 		log.Debugf("vni is %v", vni)
-		network.VxLANVNI = vni
 	default:
 		return network, errors.New("invalid network type for init")
 	}
 
-	err = r.store.Set(ctx, network.StorageKey(), &network)
-	if err != nil {
-		return network, errors.Wrapf(err, "fail to get network %s from store", network)
-	}
-
-	if idlock != nil {
-		err := idlock.Unlock(ctx)
-		if err != nil {
-			log.WithError(err).Errorf("fail to unlock VNI generator for %s", network)
-		}
-	}
-
 	log.Info("Network created")
 	return network, nil
 }
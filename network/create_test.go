@@ -14,6 +14,7 @@ import (
 	"github.com/Scalingo/sand/api/types"
 	"github.com/Scalingo/sand/config"
 	"github.com/Scalingo/sand/network/netmanager"
+	"github.com/Scalingo/sand/store"
 	"github.com/Scalingo/sand/store/storemock"
 	"github.com/Scalingo/sand/test/mocks/network/netmanagermock"
 )
@@ -75,6 +76,19 @@ func TestRepository_Ensure(t *testing.T) {
 				).Return(nil)
 			},
 			Error: "fail to add neighbors",
+		}, {
+			Name: "overlay: without endpoint, it should ensure an empty list of neighbors",
+			ExpectNetManager: func(t *testing.T, m *netmanagermock.MockNetManager, n types.Network) {
+				m.EXPECT().Ensure(gomock.Any(), n).Return(nil)
+				m.EXPECT().EnsureEndpointsNeigh(gomock.Any(), n, []types.Endpoint{}).Return(nil)
+				m.EXPECT().ListenNetworkChange(gomock.Any(), n).Return(nil)
+			},
+			ExpectStore: func(t *testing.T, m *storemock.MockStore, n types.Network) {
+				m.EXPECT().Get(
+					gomock.Any(), n.EndpointsStorageKey(""), true, gomock.Any(),
+				).Return(store.ErrNotFound)
+				m.EXPECT().Txn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
 		}, {
 			Name:             "overlay: it should add entries in the store",
 			ExpectNetManager: expectNetManager(nil),
@@ -86,16 +100,20 @@ func TestRepository_Ensure(t *testing.T) {
 						reflect.ValueOf(data).Elem().Set(reflect.ValueOf([]types.Endpoint{{ID: "ep-1"}}))
 					},
 				).Return(nil)
-				for _, key := range []string{"/nodes/test-hostname/networks/1", "/nodes-networks/1/test-hostname"} {
-					m.EXPECT().Set(
-						gomock.Any(), key, gomock.Any(),
-					).Do(func(ctx context.Context, key string, data interface{}) {
-						m, ok := data.(map[string]interface{})
-						assert.True(t, ok)
-						assert.Equal(t, "1", m["id"].(string))
-						assert.IsType(t, time.Now(), m["created_at"])
-					}).Return(nil)
-				}
+				m.EXPECT().Txn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Do(
+					func(ctx context.Context, cmps []store.Compare, ops ...store.Op) {
+						require.Len(t, ops, 2)
+						assert.Equal(t, "/nodes/test-hostname/networks/1", ops[0].Key)
+						assert.Equal(t, "/nodes-networks/1/test-hostname", ops[1].Key)
+						for _, op := range ops {
+							assert.Equal(t, store.OpTypeSet, op.Type)
+							m, ok := op.Data.(map[string]interface{})
+							assert.True(t, ok)
+							assert.Equal(t, "1", m["id"].(string))
+							assert.IsType(t, time.Now(), m["created_at"])
+						}
+					},
+				).Return(nil)
 			},
 		},
 	}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/store"
 )
 
 func (c *repository) Deactivate(ctx context.Context, network types.Network) error {
@@ -41,19 +42,13 @@ func (c *repository) deleteNodeFromStore(ctx context.Context, hostname string, n
 	log := logger.Get(ctx)
 	log.WithField("host", hostname).Info("unlinking host")
 
-	err := c.store.Delete(
-		ctx,
-		fmt.Sprintf("/nodes/%s/networks/%s", hostname, network.ID),
+	err := c.store.Txn(ctx, nil,
+		store.OpDelete(fmt.Sprintf("/nodes/%s/networks/%s", hostname, network.ID)),
+		store.OpDelete(fmt.Sprintf("/nodes-networks/%s/%s", network.ID, hostname)),
 	)
 	if err != nil {
-		return errors.Wrapf(err, "fail to delete network-host link %s from store", network)
-	}
-	err = c.store.Delete(
-		ctx,
-		fmt.Sprintf("/nodes-networks/%s/%s", network.ID, hostname),
-	)
-	if err != nil {
-		return errors.Wrapf(err, "fail to delete network-host link %s from store", network)
+		return errors.Wrapf(err, "fail to delete network-host links %s from store", network)
 	}
+
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/api/types"
 	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/network/overlay"
 	"github.com/Scalingo/sand/store"
 )
 
@@ -29,7 +30,7 @@ func (c *repository) Delete(ctx context.Context, network types.Network, a ipallo
 
 	if len(nets) == 0 {
 		log.Infof("Deleting network %v definition", network)
-		err = c.store.Delete(ctx, network.StorageKey())
+		err = c.deleteDefinition(ctx, network)
 		if err != nil {
 			return errors.Wrapf(err, "fail to delete network %s from store", network)
 		}
@@ -38,8 +39,26 @@ func (c *repository) Delete(ctx context.Context, network types.Network, a ipallo
 		if err != nil {
 			return errors.Wrapf(err, "fail to release pool of network %s", network)
 		}
+
+		if network.IPv6Range != "" {
+			err = a.ReleasePool(ctx, network.IPv6PoolID())
+			if err != nil {
+				return errors.Wrapf(err, "fail to release IPv6 pool of network %s", network)
+			}
+		}
 	} else {
 		log.Infof("Network still on %d hosts, keeping %v definition", len(nets), network)
 	}
 	return nil
 }
+
+// deleteDefinition deletes the network from the store and releases its VNI in
+// the same transaction
+func (c *repository) deleteDefinition(ctx context.Context, network types.Network) error {
+	if network.Type != types.OverlayNetworkType || network.VxLANVNI == 0 {
+		return c.store.Delete(ctx, network.StorageKey())
+	}
+	return overlay.NewVNIGenerator(c.config, c.store).Release(
+		ctx, network.VxLANVNI, store.OpDelete(network.StorageKey()),
+	)
+}
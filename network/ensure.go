@@ -24,13 +24,15 @@ func (c *repository) Ensure(ctx context.Context, network types.Network) error {
 		if err != nil {
 			return errors.Wrapf(err, "fail to ensure overlay network %s", network)
 		}
-		var endpoints []types.Endpoint
-		err = c.store.Get(ctx, network.EndpointsStorageKey(""), true, &endpoints)
-		if err != nil && err != store.ErrNotFound {
-			return errors.Wrapf(err, "fail to get network endpoints")
-		}
-
-		if len(endpoints) > 0 {
+		// With on-demand neighbors, the listener installs them on misses.
+		// Otherwise the neighbors are ensured even without endpoint, to remove
+		// the entries of the deleted ones.
+		if !c.config.OnDemandNeighbors() {
+			endpoints := []types.Endpoint{}
+			err = c.store.Get(ctx, network.EndpointsStorageKey(""), true, &endpoints)
+			if err != nil && err != store.ErrNotFound {
+				return errors.Wrapf(err, "fail to get network endpoints")
+			}
 			err = m.EnsureEndpointsNeigh(ctx, network, endpoints)
 			if err != nil {
 				return errors.Wrapf(err, "fail to ensure neighbors (ARP/FDB)")
@@ -45,24 +47,15 @@ func (c *repository) Ensure(ctx context.Context, network types.Network) error {
 		return errors.New("invalid network type")
 	}
 
-	// Ability to list all networks with node hostname as prefix
-	err := c.store.Set(
-		ctx,
-		fmt.Sprintf("/nodes/%s/networks/%s", c.config.GetPeerHostname(), network.ID),
-		map[string]interface{}{"id": network.ID, "created_at": time.Now()},
-	)
-	if err != nil {
-		return errors.Wrapf(err, "err to store nodes link to network %s", network)
-	}
-
-	// Ability to list nodes present in a network
-	err = c.store.Set(
-		ctx,
-		fmt.Sprintf("/nodes-networks/%s/%s", network.ID, c.config.GetPeerHostname()),
-		map[string]interface{}{"id": network.ID, "created_at": time.Now()},
+	link := map[string]interface{}{"id": network.ID, "created_at": time.Now()}
+	err := c.store.Txn(ctx, nil,
+		// Ability to list all networks with node hostname as prefix
+		store.OpSet(fmt.Sprintf("/nodes/%s/networks/%s", c.config.GetPeerHostname(), network.ID), link),
+		// Ability to list nodes present in a network
+		store.OpSet(fmt.Sprintf("/nodes-networks/%s/%s", network.ID, c.config.GetPeerHostname()), link),
 	)
 	if err != nil {
-		return errors.Wrapf(err, "err to store network %s link to hostname", network)
+		return errors.Wrapf(err, "err to store nodes links to network %s", network)
 	}
 
 	log.Info("Network setup ensured")
@@ -0,0 +1,33 @@
+package network
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/store"
+)
+
+// UpdateMTU changes the MTU of the network, 0 to derive it from the underlay
+// interface of each node. Nodes of the network update their interfaces when
+// they get the modification. The other fields of the network modified in the
+// meantime are kept.
+func (c *repository) UpdateMTU(ctx context.Context, network types.Network, mtu int) (types.Network, error) {
+	log := logger.Get(ctx)
+
+	var stored types.Network
+	err := store.Update(ctx, c.store, network.StorageKey(), &stored, func(found bool) ([]store.Op, error) {
+		if !found {
+			return nil, errors.Errorf("network %s not found", network)
+		}
+		stored.MTU = mtu
+		return []store.Op{store.OpSet(network.StorageKey(), &stored)}, nil
+	})
+	if err != nil {
+		return network, errors.Wrapf(err, "fail to save network %s in store", network)
+	}
+	log.WithField("mtu", mtu).Info("Network MTU updated")
+	return stored, nil
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
+)
+
+func TestRepository_UpdateMTU(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	r := &repository{config: config, store: store.NewMemory(config)}
+	network := types.Network{ID: "net-1", IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"}
+	modified := network
+	modified.Subnets = []types.Subnet{
+		{IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"},
+		{IPRange: "10.0.1.0/24", Gateway: "10.0.1.1/24"},
+	}
+	require.NoError(t, r.store.Set(ctx, network.StorageKey(), modified))
+
+	updated, err := r.UpdateMTU(ctx, network, 1400)
+	require.NoError(t, err)
+	assert.Equal(t, 1400, updated.MTU)
+	assert.Equal(t, modified.Subnets, updated.Subnets, "the subnets added in the meantime should be kept")
+
+	var stored types.Network
+	require.NoError(t, r.store.Get(ctx, network.StorageKey(), false, &stored))
+	assert.Equal(t, updated, stored)
+}
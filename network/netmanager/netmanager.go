@@ -3,6 +3,7 @@ package netmanager
 import (
 	"context"
 	"errors"
+	"net"
 
 	"github.com/Scalingo/sand/api/params"
 	"github.com/Scalingo/sand/api/types"
@@ -14,13 +15,44 @@ type NetManager interface {
 
 	EnsureEndpoint(context.Context, types.Network, types.Endpoint, params.EndpointActivate) (types.Endpoint, error)
 	DeleteEndpoint(context.Context, types.Network, types.Endpoint) error
+	EnsureEndpointRoutes(context.Context, types.Network, types.Endpoint) error
 
 	EnsureEndpointsNeigh(context.Context, types.Network, []types.Endpoint) error
 	AddEndpointNeigh(context.Context, types.Network, types.Endpoint) error
 	RemoveEndpointNeigh(context.Context, types.Network, types.Endpoint) error
+	SubscribeNeighMisses(context.Context, types.Network, <-chan struct{}) (<-chan NeighMiss, error)
+
+	// CheckNetwork returns the differences between the kernel state of the
+	// network on the node and the network and its endpoints, nothing is
+	// modified
+	CheckNetwork(context.Context, types.Network, []types.Endpoint) ([]Drift, error)
 
 	ListenNetworkChange(context.Context, types.Network) error
 	StopListenNetworkChange(context.Context, types.Network) error
 }
 
+// NeighMiss is a neighbor the kernel failed to resolve in a network, IP is set
+// for a missing ARP/NDP entry and MAC for a missing FDB entry
+type NeighMiss struct {
+	IP  net.IP
+	MAC net.HardwareAddr
+}
+
+type DriftKind string
+
+const (
+	DriftLink     DriftKind = "link"
+	DriftAddress  DriftKind = "address"
+	DriftNeighbor DriftKind = "neighbor"
+)
+
+// Drift is a difference between the kernel state of a network and its
+// definition, EndpointID is set if it concerns the interfaces of a local
+// endpoint
+type Drift struct {
+	Kind        DriftKind
+	EndpointID  string
+	Description string
+}
+
 var EndpointAlreadyDisabledErr = errors.New("endpoint already disabled")
@@ -0,0 +1,216 @@
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/netutils"
+	"github.com/Scalingo/sand/network/netmanager"
+)
+
+// CheckNetwork compares the namespace of the network, its bridge, VxLAN
+// interface and neighbors, and the interfaces of the local active endpoints
+// with their definition. The checks of the interfaces depending on a missing
+// one are skipped.
+func (m manager) CheckNetwork(ctx context.Context, network types.Network, endpoints []types.Endpoint) ([]netmanager.Drift, error) {
+	var drifts []netmanager.Drift
+	drift := func(kind netmanager.DriftKind, endpointID, format string, args ...interface{}) {
+		drifts = append(drifts, netmanager.Drift{Kind: kind, EndpointID: endpointID, Description: fmt.Sprintf(format, args...)})
+	}
+
+	nsfd, err := netns.GetFromPath(network.NSHandlePath)
+	if os.IsNotExist(errors.Cause(err)) {
+		drift(netmanager.DriftLink, "", "namespace %s is missing", network.NSHandlePath)
+		return drifts, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get namespace handler")
+	}
+	defer nsfd.Close()
+
+	nlh, err := netlink.NewHandleAt(nsfd, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get netlink handler of netns")
+	}
+	defer nlh.Delete()
+	err = nlh.SetSocketTimeout(NetlinkSocketsTimeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to configure timeout on netlink socket")
+	}
+
+	links, err := nlh.LinkList()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list links")
+	}
+	byName := map[string]netlink.Link{}
+	for _, link := range links {
+		byName[link.Attrs().Name] = link
+	}
+
+	mtu := m.mtu(ctx, network)
+	bridge, ok := byName[BridgeName]
+	if !ok {
+		drift(netmanager.DriftLink, "", "bridge %s is missing", BridgeName)
+		return drifts, nil
+	}
+	if bridge.Attrs().Flags&net.FlagUp == 0 {
+		drift(netmanager.DriftLink, "", "bridge %s is down", BridgeName)
+	}
+	addresses, err := nlh.AddrList(bridge, nl.FAMILY_ALL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list addresses of %s", BridgeName)
+	}
+	for _, gateway := range network.Gateways() {
+		addr, err := netlink.ParseAddr(gateway)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to parse %s IP address", gateway)
+		}
+		current := findAddr(addresses, addr)
+		if current == nil || current.IPNet.String() != addr.IPNet.String() {
+			drift(netmanager.DriftAddress, "", "gateway %s is missing on %s", gateway, BridgeName)
+		}
+	}
+
+	vxlan, ok := byName[VxLANInNSName]
+	if !ok {
+		drift(netmanager.DriftLink, "", "VxLAN interface %s is missing", VxLANInNSName)
+		return drifts, nil
+	}
+	if vxlan.Attrs().Flags&net.FlagUp == 0 {
+		drift(netmanager.DriftLink, "", "VxLAN interface %s is down", VxLANInNSName)
+	}
+	if vxlan.Attrs().MasterIndex != bridge.Attrs().Index {
+		drift(netmanager.DriftLink, "", "VxLAN interface %s is not in %s", VxLANInNSName, BridgeName)
+	}
+	if vxlan.Attrs().MTU != mtu {
+		drift(netmanager.DriftLink, "", "MTU of %s is %d instead of %d", VxLANInNSName, vxlan.Attrs().MTU, mtu)
+	}
+
+	// On-demand neighbors are only installed on misses, they can't be compared
+	// to the endpoints
+	if !m.config.OnDemandNeighbors() {
+		var desired []*netlink.Neigh
+		for _, endpoint := range endpoints {
+			neighs, err := m.endpointNeighs(network, endpoint, vxlan)
+			if err != nil {
+				continue
+			}
+			desired = append(desired, neighs...)
+		}
+		existing, err := permanentNeighs(nlh, vxlan)
+		if err != nil {
+			return nil, err
+		}
+		toSet, toRemove := diffNeighs(desired, existing)
+		for _, neigh := range toSet {
+			drift(netmanager.DriftNeighbor, "", "%s is missing", neighDescription(neigh))
+		}
+		for _, neigh := range toRemove {
+			drift(netmanager.DriftNeighbor, "", "%s is stale", neighDescription(neigh))
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Active || endpoint.Hostname != m.config.GetPeerHostname() {
+			continue
+		}
+		endpointDrifts, err := m.checkEndpoint(ctx, network, endpoint, byName, bridge, mtu)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to check endpoint %v", endpoint.ID)
+		}
+		drifts = append(drifts, endpointDrifts...)
+	}
+	return drifts, nil
+}
+
+// checkEndpoint compares the veth pair of a local endpoint and the addresses
+// of its target interface with the endpoint, overlayLinks are the links of
+// the namespace of the network by name
+func (m manager) checkEndpoint(ctx context.Context, network types.Network, endpoint types.Endpoint, overlayLinks map[string]netlink.Link, bridge netlink.Link, mtu int) ([]netmanager.Drift, error) {
+	var drifts []netmanager.Drift
+	drift := func(kind netmanager.DriftKind, format string, args ...interface{}) {
+		drifts = append(drifts, netmanager.Drift{Kind: kind, EndpointID: endpoint.ID, Description: fmt.Sprintf(format, args...)})
+	}
+
+	overlayVeth, ok := overlayLinks[endpoint.OverlayVethName]
+	if !ok {
+		drift(netmanager.DriftLink, "overlay veth %s is missing", endpoint.OverlayVethName)
+		return drifts, nil
+	}
+	if overlayVeth.Attrs().Flags&net.FlagUp == 0 {
+		drift(netmanager.DriftLink, "overlay veth %s is down", endpoint.OverlayVethName)
+	}
+	if overlayVeth.Attrs().MasterIndex != bridge.Attrs().Index {
+		drift(netmanager.DriftLink, "overlay veth %s is not in %s", endpoint.OverlayVethName, BridgeName)
+	}
+
+	targetnsfd, err := netns.GetFromPath(endpoint.TargetNetnsPath)
+	if os.IsNotExist(errors.Cause(err)) {
+		drift(netmanager.DriftLink, "target namespace %s is missing", endpoint.TargetNetnsPath)
+		return drifts, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get target namespace handler: %s", endpoint.TargetNetnsPath)
+	}
+	defer targetnsfd.Close()
+
+	targetnlh, err := netlink.NewHandleAt(targetnsfd, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get target namespace netlink handler")
+	}
+	defer targetnlh.Delete()
+
+	// The target interface may have been renamed, it is found by its MAC
+	links, err := targetnlh.LinkList()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list links of target namespace")
+	}
+	var target netlink.Link
+	for _, link := range links {
+		if link.Attrs().HardwareAddr.String() == endpoint.TargetVethMAC {
+			target = link
+			break
+		}
+	}
+	if target == nil {
+		drift(netmanager.DriftLink, "target veth with MAC %s is missing", endpoint.TargetVethMAC)
+		return drifts, nil
+	}
+	if target.Attrs().Flags&net.FlagUp == 0 {
+		drift(netmanager.DriftLink, "target veth %s is down", target.Attrs().Name)
+	}
+	if target.Attrs().MTU != mtu {
+		drift(netmanager.DriftLink, "MTU of target veth %s is %d instead of %d", target.Attrs().Name, target.Attrs().MTU, mtu)
+	}
+
+	addrs, err := targetnlh.AddrList(target, nl.FAMILY_ALL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to list addresses of target %v", target.Attrs().Name)
+	}
+	for _, ip := range endpoint.TargetVethIPs() {
+		addr, err := netutils.ParseAddr(ip)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to parse %s IP address", ip)
+		}
+		if findAddr(addrs, addr) == nil {
+			drift(netmanager.DriftAddress, "address %s is missing on target veth %s", ip, target.Attrs().Name)
+		}
+	}
+	return drifts, nil
+}
+
+func neighDescription(neigh *netlink.Neigh) string {
+	if neigh.Family == unix.AF_BRIDGE {
+		return fmt.Sprintf("FDB entry %s via %s", neigh.HardwareAddr, neigh.IP)
+	}
+	return fmt.Sprintf("neighbor %s at %s", neigh.IP, neigh.HardwareAddr)
+}
@@ -24,11 +24,21 @@ const (
 )
 
 func (netm manager) Ensure(ctx context.Context, network types.Network) error {
+	// The VxLAN interface sends its packets from the peer IP of the node, its
+	// family must be the one of the VTEPs of the network
+	localIP, err := VTEPIP(network, netm.config.GetPeerIP())
+	if err != nil {
+		return errors.Wrapf(err, "invalid peer IP for %s", network)
+	}
+
 	m := netnsbuilder.NewManager(netm.config)
-	err := m.Create(ctx, network.Name, network)
+	err = m.Create(ctx, network.Name, network)
 	if err != nil && err != netnsbuilder.ErrAlreadyExist {
 		return errors.Wrapf(err, "fail to create network namspace")
 	}
+	// The subscription to the neighbor misses of a network already listened
+	// is bound to the former namespace or VxLAN interface
+	recreated := err == nil
 
 	// Get a netlink handle to the root network namespace
 	rootNetlinkHandle, err := netlink.NewHandle(unix.NETLINK_ROUTE)
@@ -100,23 +110,40 @@ func (netm manager) Ensure(ctx context.Context, network types.Network) error {
 		bridge, _ = link.(*netlink.Bridge)
 	}
 
-	// Check the gateway IP address is correctly set on the bridge
-	addresses, err := nlh.AddrList(link, nl.FAMILY_V4)
+	// Check the gateway IP addresses are correctly set on the bridge
+	addresses, err := nlh.AddrList(link, nl.FAMILY_ALL)
 	if err != nil {
 		return errors.Wrapf(err, "fail to list addresses of %s", BridgeName)
 	}
 
-	if len(addresses) == 0 {
-		brAddr, err := netlink.ParseAddr(network.Gateway)
+	for _, gateway := range network.Gateways() {
+		brAddr, err := netlink.ParseAddr(gateway)
 		if err != nil {
-			return errors.Wrapf(err, "fail to parse %s IP address", network.Gateway)
+			return errors.Wrapf(err, "fail to parse %s IP address", gateway)
+		}
+		current := findAddr(addresses, brAddr)
+		if current != nil && current.IPNet.String() == brAddr.IPNet.String() {
+			continue
+		}
+		if current != nil {
+			// The subnet of the gateway has been widened
+			err = nlh.AddrDel(link, current)
+			if err != nil {
+				return errors.Wrapf(err, "fail to remove %s from bridge", current.IPNet)
+			}
+		}
+		if brAddr.IP.To4() == nil {
+			// Duplicate address detection would keep the address tentative
+			brAddr.Flags = unix.IFA_F_NODAD
 		}
 		err = nlh.AddrAdd(link, brAddr)
 		if err != nil {
-			return errors.Wrapf(err, "fail to add %s on bridge", network.Gateway)
+			return errors.Wrapf(err, "fail to add %s on bridge", gateway)
 		}
 	}
 
+	mtu := netm.mtu(ctx, network)
+
 	// Check that the VxLAN interface exist in its dedicated namespace (alongside the bridge)
 	exist = false
 	for _, link := range links {
@@ -127,11 +154,19 @@ func (netm manager) Ensure(ctx context.Context, network types.Network) error {
 	}
 
 	if !exist {
+		// The ports have been checked when the network was created
+		portLow, portHigh, err := ParseSourcePortRange(network.VxLANSourcePortRange)
+		if err != nil {
+			return errors.Wrapf(err, "invalid VxLAN source ports of %s", network)
+		}
 		vxlan := &netlink.Vxlan{
-			LinkAttrs: netlink.LinkAttrs{Name: fmt.Sprintf("%s%05d", VxLANInHostPrefix, genVxLANSuffix()), MTU: 1450},
+			LinkAttrs: netlink.LinkAttrs{Name: fmt.Sprintf("%s%05d", VxLANInHostPrefix, genVxLANSuffix()), MTU: mtu},
 			VxlanId:   network.VxLANVNI,
+			SrcAddr:   localIP,
 			Learning:  true,
-			Port:      4789,
+			Port:      vxlanPort(network),
+			PortLow:   portLow,
+			PortHigh:  portHigh,
 			Proxy:     true,
 			L3miss:    true,
 			L2miss:    true,
@@ -140,7 +175,7 @@ func (netm manager) Ensure(ctx context.Context, network types.Network) error {
 		// Create a VxLAN interface in the root namespace (only way to ensure the
 		// kernel does take it into account, creating one in a sub-namespace
 		// doesn't work)
-		err := rootNetlinkHandle.LinkAdd(vxlan)
+		err = rootNetlinkHandle.LinkAdd(vxlan)
 		if err != nil {
 			return errors.Wrapf(err, "error creating %s interface (VNI: %v)", vxlan.Attrs().Name, network.VxLANVNI)
 		}
@@ -161,6 +196,7 @@ func (netm manager) Ensure(ctx context.Context, network types.Network) error {
 		if err != nil {
 			return errors.Wrapf(err, "fail to rename %s to %s in ns", link.Attrs().Name, VxLANInNSName)
 		}
+		recreated = true
 	}
 
 	// Plug the VxLAN interface in the bridge by setting its master attribute
@@ -176,6 +212,24 @@ func (netm manager) Ensure(ctx context.Context, network types.Network) error {
 		}
 	}
 
+	// The MTU of the network may have been changed, it is applied to the VxLAN
+	// interface and to the veths of the endpoints plugged in the bridge
+	ports := []netlink.Link{link}
+	for _, l := range links {
+		if l.Attrs().MasterIndex == bridge.Attrs().Index && l.Attrs().Name != VxLANInNSName {
+			ports = append(ports, l)
+		}
+	}
+	for _, port := range ports {
+		if port.Attrs().MTU == mtu {
+			continue
+		}
+		err := nlh.LinkSetMTU(port, mtu)
+		if err != nil {
+			return errors.Wrapf(err, "fail to set MTU %d on %s", mtu, port.Attrs().Name)
+		}
+	}
+
 	// Ensure all interface of the VxLAN namespace are up
 	for _, ifName := range []string{"lo", BridgeName, VxLANInNSName} {
 		link, err = nlh.LinkByName(ifName)
@@ -187,6 +241,10 @@ func (netm manager) Ensure(ctx context.Context, network types.Network) error {
 			return errors.Wrapf(err, "fail to set %s up", ifName)
 		}
 	}
+
+	if recreated {
+		netm.listener.ResubscribeNeighMisses(ctx, network)
+	}
 	return nil
 }
 
@@ -194,3 +252,14 @@ func genVxLANSuffix() uint32 {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Uint32() % 100000
 }
+
+// findAddr returns the address of the list with the IP of addr, whatever its
+// prefix length
+func findAddr(addresses []netlink.Addr, addr *netlink.Addr) *netlink.Addr {
+	for i, a := range addresses {
+		if a.IP.Equal(addr.IP) {
+			return &addresses[i]
+		}
+	}
+	return nil
+}
@@ -88,9 +88,10 @@ func (m manager) EnsureEndpoint(ctx context.Context, network types.Network, endp
 		return endpoint, errors.Wrapf(err, "fail to find br0")
 	}
 
-	err = overlaynlh.LinkSetMTU(vethOverlay, 1450)
+	mtu := m.mtu(ctx, network)
+	err = overlaynlh.LinkSetMTU(vethOverlay, mtu)
 	if err != nil {
-		return endpoint, errors.Wrapf(err, "fail to set MTU 1450 on %s", vethOverlay.Attrs().Name)
+		return endpoint, errors.Wrapf(err, "fail to set MTU %d on %s", mtu, vethOverlay.Attrs().Name)
 	}
 
 	err = overlaynlh.LinkSetMaster(vethOverlay, bridge)
@@ -98,9 +99,9 @@ func (m manager) EnsureEndpoint(ctx context.Context, network types.Network, endp
 		return endpoint, errors.Wrapf(err, "fail to add %s in bridge", vethOverlay.Attrs().Name)
 	}
 
-	err = targetnlh.LinkSetMTU(vethTarget, 1450)
+	err = targetnlh.LinkSetMTU(vethTarget, mtu)
 	if err != nil {
-		return endpoint, errors.Wrapf(err, "fail to set MTU to 1450 on %s", vethTarget.Attrs().Name)
+		return endpoint, errors.Wrapf(err, "fail to set MTU to %d on %s", mtu, vethTarget.Attrs().Name)
 	}
 
 	if params.SetAddr {
@@ -109,30 +110,33 @@ func (m manager) EnsureEndpoint(ctx context.Context, network types.Network, endp
 			return endpoint, errors.Wrapf(err, "fail to set link up %s in target", vethTarget.Attrs().Name)
 		}
 
-		addr, err := netutils.ParseAddr(endpoint.TargetVethIP)
-		if err != nil {
-			return endpoint, errors.Wrapf(err, "fail to parse %s IP address", endpoint.TargetVethIP)
-		}
-
-		addrs, err := targetnlh.AddrList(vethTarget, nl.FAMILY_V4)
+		addrs, err := targetnlh.AddrList(vethTarget, nl.FAMILY_ALL)
 		if err != nil {
 			return endpoint, errors.Wrapf(err, "fail to list addresses of target %v", vethTarget.Attrs().Name)
 		}
 
-		exist := false
-		for _, a := range addrs {
-			if a.IP.String() == addr.IP.String() {
-				exist = true
-				break
+		for _, ip := range endpoint.TargetVethIPs() {
+			addr, err := netutils.ParseAddr(ip)
+			if err != nil {
+				return endpoint, errors.Wrapf(err, "fail to parse %s IP address", ip)
+			}
+			if findAddr(addrs, addr) != nil {
+				continue
+			}
+			if addr.IP.To4() == nil {
+				// Duplicate address detection would keep the address tentative
+				addr.Flags = unix.IFA_F_NODAD
 			}
-		}
-
-		if !exist {
 			err = targetnlh.AddrAdd(vethTarget, addr)
 			if err != nil {
-				return endpoint, errors.Wrapf(err, "fail to add %s on target veth %v", endpoint.TargetVethIP, vethTarget.Attrs().Name)
+				return endpoint, errors.Wrapf(err, "fail to add %s on target veth %v", ip, vethTarget.Attrs().Name)
 			}
 		}
+
+		err = ensureSubnetsRoutes(targetnlh, vethTarget, network, endpoint)
+		if err != nil {
+			return endpoint, errors.Wrapf(err, "fail to ensure routes to the subnets of the network")
+		}
 	}
 
 	err = overlaynlh.LinkSetUp(vethOverlay)
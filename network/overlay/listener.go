@@ -21,6 +21,10 @@ import (
 type NetworkEndpointListener interface {
 	Add(context.Context, netmanager.NetManager, types.Network) (chan struct{}, error)
 	Remove(context.Context, types.Network) error
+	// ResubscribeNeighMisses subscribes again to the neighbor misses of a
+	// registered network, the subscription is bound to the namespace of the
+	// network and to its VxLAN interface
+	ResubscribeNeighMisses(context.Context, types.Network)
 }
 
 type Registrar interface {
@@ -32,7 +36,7 @@ type listener struct {
 	config               *config.Config
 	store                store.Store
 	registrar            Registrar
-	networkRegistrations map[string]store.Registration
+	networkRegistrations map[string]networkRegistrations
 
 	// globalContext is the context used to start etcd registrar when it is
 	// canceled all resources are released. We can't use the one of Add, as it is
@@ -41,8 +45,17 @@ type listener struct {
 	globalContext context.Context
 }
 
+// networkRegistrations are the registrations to the endpoints of a network and
+// to the network itself
+type networkRegistrations struct {
+	endpoints store.Registration
+	network   store.Registration
+	// resubscribe is nil without on-demand neighbors
+	resubscribe chan struct{}
+}
+
 func NewNetworkEndpointListener(ctx context.Context, config *config.Config, r Registrar, s store.Store) NetworkEndpointListener {
-	return &listener{config: config, registrar: r, store: s, networkRegistrations: map[string]store.Registration{}, globalContext: ctx}
+	return &listener{config: config, registrar: r, store: s, networkRegistrations: map[string]networkRegistrations{}, globalContext: ctx}
 }
 
 func (l *listener) Remove(ctx context.Context, network types.Network) error {
@@ -52,12 +65,28 @@ func (l *listener) Remove(ctx context.Context, network types.Network) error {
 	if r, ok := l.networkRegistrations[network.ID]; !ok {
 		return nil
 	} else {
-		r.Unregister()
+		r.endpoints.Unregister()
+		r.network.Unregister()
 		delete(l.networkRegistrations, network.ID)
 	}
 	return nil
 }
 
+func (l *listener) ResubscribeNeighMisses(ctx context.Context, network types.Network) {
+	l.Lock()
+	defer l.Unlock()
+
+	r, ok := l.networkRegistrations[network.ID]
+	if !ok || r.resubscribe == nil {
+		return
+	}
+	select {
+	case r.resubscribe <- struct{}{}:
+	default:
+		// A resubscription is already pending
+	}
+}
+
 func (l *listener) Add(ctx context.Context, nm netmanager.NetManager, network types.Network) (chan struct{}, error) {
 	l.Lock()
 	defer l.Unlock()
@@ -78,25 +107,170 @@ func (l *listener) Add(ctx context.Context, nm netmanager.NetManager, network ty
 	if err != nil {
 		return nil, errors.Wrapf(err, "fail to create registration for network %s", network)
 	}
-	l.networkRegistrations[network.ID] = r
+	nr, err := l.registrar.Register(network.StorageKey())
+	if err != nil {
+		r.Unregister()
+		return nil, errors.Wrapf(err, "fail to create registration for network %s definition", network)
+	}
+
+	// With on-demand neighbors, the neighbors missed by the kernel are resolved
+	// from an index of the endpoints of the network
+	var misses <-chan netmanager.NeighMiss
+	var neighbors *onDemandNeighbors
+	var resubscribe chan struct{}
+	stopMisses := make(chan struct{})
+	if l.config.OnDemandNeighbors() {
+		misses, err = nm.SubscribeNeighMisses(listenerCtx, network, stopMisses)
+		if err != nil {
+			close(stopMisses)
+			r.Unregister()
+			nr.Unregister()
+			return nil, errors.Wrapf(err, "fail to subscribe to neighbor misses of network %s", network)
+		}
+		neighbors = newOnDemandNeighbors()
+		resubscribe = make(chan struct{}, 1)
+	}
+	l.networkRegistrations[network.ID] = networkRegistrations{endpoints: r, network: nr, resubscribe: resubscribe}
 
 	done := make(chan struct{})
-	go func(r store.Registration) {
+	go func(r, nr store.Registration) {
 		defer close(done)
+		defer func() { close(stopMisses) }()
 		log.Info("start listening registration events")
-		for event := range r.EventChan() {
-			err := l.handleEvent(listenerCtx, event, nm, network)
+		events, resyncs, networkEvents := r.EventChan(), r.ResyncChan(), nr.EventChan()
+		if neighbors != nil {
+			err := l.resync(listenerCtx, nm, network, neighbors)
 			if err != nil {
-				log.WithError(err).Error("fail to handle registration response")
+				log.WithError(err).Error("fail to index network endpoints")
+			}
+		}
+		for {
+			select {
+			case miss, ok := <-misses:
+				if !ok {
+					misses = nil
+					continue
+				}
+				err := l.handleMiss(listenerCtx, miss, nm, network, neighbors)
+				if err != nil {
+					log.WithError(err).Error("fail to resolve neighbor miss")
+				}
+			case <-resubscribe:
+				// The neighbors of the former VxLAN interface are gone with it, the
+				// resolved ones are ensured again
+				log.Info("resubscribe to neighbor misses")
+				close(stopMisses)
+				stopMisses = make(chan struct{})
+				var err error
+				misses, err = nm.SubscribeNeighMisses(listenerCtx, network, stopMisses)
+				if err != nil {
+					log.WithError(err).Error("fail to resubscribe to neighbor misses")
+				}
+				err = l.resync(listenerCtx, nm, network, neighbors)
+				if err != nil {
+					log.WithError(err).Error("fail to resync network endpoints")
+				}
+			case event, ok := <-networkEvents:
+				if !ok {
+					networkEvents = nil
+					continue
+				}
+				updated, err := l.handleNetworkEvent(listenerCtx, event, nm)
+				if err != nil {
+					log.WithError(err).Error("fail to handle network modification")
+				}
+				if updated != nil {
+					network = *updated
+				}
+			case event, ok := <-events:
+				if !ok {
+					log.Info("stop listening registration events")
+					return
+				}
+				err := l.handleEvent(listenerCtx, event, nm, network, neighbors)
+				if err != nil {
+					log.WithError(err).Error("fail to handle registration response")
+				}
+			case <-resyncs:
+				err := l.resync(listenerCtx, nm, network, neighbors)
+				if err != nil {
+					log.WithError(err).Error("fail to resync network endpoints")
+				}
 			}
 		}
-		log.Info("stop listening registration events")
-	}(r)
+	}(r, nr)
 
 	return done, nil
 }
 
-func (l *listener) handleEvent(ctx context.Context, event *clientv3.Event, nm netmanager.NetManager, network types.Network) error {
+// resync ensures the neighbors of all the endpoints of the network, or only
+// the resolved ones with on-demand neighbors whose index is rebuilt, it is used
+// when some events of the registration may have been lost
+func (l *listener) resync(ctx context.Context, nm netmanager.NetManager, network types.Network, neighbors *onDemandNeighbors) error {
+	log := logger.Get(ctx)
+	log.Info("resync network endpoints")
+
+	endpoints := []types.Endpoint{}
+	err := l.store.Get(ctx, network.EndpointsStorageKey(""), true, &endpoints)
+	if err != nil && err != store.ErrNotFound {
+		return errors.Wrapf(err, "fail to get network endpoints")
+	}
+	if neighbors != nil {
+		return neighbors.resync(ctx, nm, network, endpoints)
+	}
+
+	// The neighbors are ensured even without endpoint, to remove the entries
+	// of the deleted ones
+	err = nm.EnsureEndpointsNeigh(ctx, network, endpoints)
+	if err != nil {
+		return errors.Wrapf(err, "fail to ensure neighbors (ARP/FDB)")
+	}
+	return nil
+}
+
+// handleNetworkEvent ensures the network and the routes of the local endpoints
+// when the network is modified, it returns the new version of the network
+func (l *listener) handleNetworkEvent(ctx context.Context, event *clientv3.Event, nm netmanager.NetManager) (*types.Network, error) {
+	log := logger.Get(ctx)
+	if event.Type != mvccpb.PUT {
+		return nil, nil
+	}
+
+	var network types.Network
+	err := json.NewDecoder(bytes.NewReader(event.Kv.Value)).Decode(&network)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to decode JSON")
+	}
+	log.Info("registration got network modification")
+
+	err = nm.Ensure(ctx, network)
+	if err != nil {
+		return &network, errors.Wrapf(err, "fail to ensure network %s", network)
+	}
+
+	var endpoints []types.Endpoint
+	err = l.store.Get(ctx, network.EndpointsStorageKey(""), true, &endpoints)
+	if err == store.ErrNotFound {
+		return &network, nil
+	}
+	if err != nil {
+		return &network, errors.Wrapf(err, "fail to get network endpoints")
+	}
+	for _, endpoint := range endpoints {
+		if !endpoint.Active || endpoint.Hostname != l.config.GetPeerHostname() {
+			continue
+		}
+		err = nm.EnsureEndpointRoutes(logger.ToCtx(ctx, log.WithField("endpoint_id", endpoint.ID)), network, endpoint)
+		if err != nil {
+			log.WithError(err).WithField("endpoint_id", endpoint.ID).Error("fail to ensure endpoint routes")
+		}
+	}
+	return &network, nil
+}
+
+// handleEvent adds or removes the neighbors of a modified endpoint, with
+// on-demand neighbors only the ones which have been resolved are modified
+func (l *listener) handleEvent(ctx context.Context, event *clientv3.Event, nm netmanager.NetManager, network types.Network, neighbors *onDemandNeighbors) error {
 	log := logger.Get(ctx)
 	switch event.Type {
 	case mvccpb.PUT:
@@ -114,6 +288,9 @@ func (l *listener) handleEvent(ctx context.Context, event *clientv3.Event, nm ne
 		log.Info("registration got new endpoint")
 		ctx = logger.ToCtx(ctx, log)
 
+		if neighbors != nil && !neighbors.set(endpoint) {
+			return nil
+		}
 		err = nm.AddEndpointNeigh(ctx, network, endpoint)
 		if err != nil {
 			log.WithError(err).Error("fail to add endpoint ARP/FDB neigh rules")
@@ -134,6 +311,9 @@ func (l *listener) handleEvent(ctx context.Context, event *clientv3.Event, nm ne
 		log.Info("etcd watch got deleted endpoint")
 		ctx = logger.ToCtx(ctx, log)
 
+		if neighbors != nil && !neighbors.remove(endpoint.ID) {
+			return nil
+		}
 		err = nm.RemoveEndpointNeigh(ctx, network, endpoint)
 		if err != nil {
 			log.WithError(err).Error("fail to remove endpoint ARP/FDB neigh rules")
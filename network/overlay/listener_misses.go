@@ -0,0 +1,144 @@
+package overlay
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/network/netmanager"
+)
+
+// onDemandNeighbors indexes the endpoints of a network by address to resolve
+// the neighbors missed by the kernel without reading the store. The index is
+// fed by the registration events and rebuilt on resync.
+type onDemandNeighbors struct {
+	// endpoints are the endpoints of the network by ID
+	endpoints map[string]types.Endpoint
+	// addresses are the IDs of the endpoints by IP and MAC address
+	addresses map[string]string
+	// resolved are the IDs of the endpoints whose neighbors have been
+	// installed after a miss, they are kept up to date
+	resolved map[string]bool
+}
+
+func newOnDemandNeighbors() *onDemandNeighbors {
+	return &onDemandNeighbors{
+		endpoints: map[string]types.Endpoint{},
+		addresses: map[string]string{},
+		resolved:  map[string]bool{},
+	}
+}
+
+// endpointAddresses returns the keys of the IP and MAC addresses of endpoint
+// in the index
+func endpointAddresses(endpoint types.Endpoint) []string {
+	var addresses []string
+	mac, err := net.ParseMAC(endpoint.TargetVethMAC)
+	if err == nil {
+		addresses = append(addresses, "mac/"+mac.String())
+	}
+	for _, targetIP := range endpoint.TargetVethIPs() {
+		ip, _, err := net.ParseCIDR(targetIP)
+		if err == nil {
+			addresses = append(addresses, "ip/"+ip.String())
+		}
+	}
+	return addresses
+}
+
+// missAddress returns the key of the missed address in the index
+func missAddress(miss netmanager.NeighMiss) string {
+	if miss.MAC != nil {
+		return "mac/" + miss.MAC.String()
+	}
+	return "ip/" + miss.IP.String()
+}
+
+// set indexes the new version of endpoint, it returns true if its neighbors
+// have been resolved
+func (n *onDemandNeighbors) set(endpoint types.Endpoint) bool {
+	n.unindex(endpoint.ID)
+	n.endpoints[endpoint.ID] = endpoint
+	for _, address := range endpointAddresses(endpoint) {
+		n.addresses[address] = endpoint.ID
+	}
+	return n.resolved[endpoint.ID]
+}
+
+// remove removes the endpoint id from the index, it returns true if its
+// neighbors have been resolved. They are not considered resolved anymore.
+func (n *onDemandNeighbors) remove(id string) bool {
+	n.unindex(id)
+	resolved := n.resolved[id]
+	delete(n.resolved, id)
+	return resolved
+}
+
+// unindex removes the endpoint id and its addresses from the index
+func (n *onDemandNeighbors) unindex(id string) {
+	for _, address := range endpointAddresses(n.endpoints[id]) {
+		if n.addresses[address] == id {
+			delete(n.addresses, address)
+		}
+	}
+	delete(n.endpoints, id)
+}
+
+// handleMiss installs the neighbors of the endpoint having the missed IP or
+// MAC address, misses of addresses which are not endpoints are ignored
+func (l *listener) handleMiss(ctx context.Context, miss netmanager.NeighMiss, nm netmanager.NetManager, network types.Network, neighbors *onDemandNeighbors) error {
+	log := logger.Get(ctx).WithFields(logrus.Fields{
+		"missed_ip":  miss.IP,
+		"missed_mac": miss.MAC,
+	})
+
+	id, ok := neighbors.addresses[missAddress(miss)]
+	if !ok {
+		log.Debug("missed neighbor is not an endpoint of the network")
+		return nil
+	}
+	endpoint := neighbors.endpoints[id]
+	log = log.WithField("endpoint_id", endpoint.ID)
+	log.Info("resolve missed neighbor")
+
+	err := nm.AddEndpointNeigh(logger.ToCtx(ctx, log), network, endpoint)
+	if err != nil {
+		return errors.Wrapf(err, "fail to add endpoint ARP/FDB neigh rules")
+	}
+	neighbors.resolved[endpoint.ID] = true
+	return nil
+}
+
+// resync rebuilds the index with endpoints, it ensures the resolved neighbors
+// of the endpoints which still exist and removes the ones of the deleted
+// endpoints
+func (n *onDemandNeighbors) resync(ctx context.Context, nm netmanager.NetManager, network types.Network, endpoints []types.Endpoint) error {
+	log := logger.Get(ctx)
+	previous := n.endpoints
+	resolved := n.resolved
+	n.endpoints, n.addresses, n.resolved = map[string]types.Endpoint{}, map[string]string{}, map[string]bool{}
+	for _, endpoint := range endpoints {
+		n.set(endpoint)
+	}
+
+	for id := range resolved {
+		endpoint, ok := n.endpoints[id]
+		if !ok {
+			err := nm.RemoveEndpointNeigh(ctx, network, previous[id])
+			if err != nil {
+				log.WithError(err).WithField("endpoint_id", id).Error("fail to remove endpoint ARP/FDB neigh rules")
+			}
+			continue
+		}
+		n.resolved[id] = true
+		err := nm.AddEndpointNeigh(ctx, network, endpoint)
+		if err != nil {
+			return errors.Wrapf(err, "fail to add endpoint ARP/FDB neigh rules")
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package overlay
 
 import (
 	"context"
+	"net"
 	"testing"
 	"time"
 
@@ -14,19 +15,29 @@ import (
 
 	"github.com/Scalingo/sand/api/types"
 	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/network/netmanager"
 	"github.com/Scalingo/sand/network/overlay/overlaymock"
+	"github.com/Scalingo/sand/store"
 	"github.com/Scalingo/sand/store/storemock"
 	"github.com/Scalingo/sand/test/mocks/network/netmanagermock"
 )
 
 func TestListener_Add(t *testing.T) {
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	// closeEvents stops the registration of cases which don't close their
+	// events channel up front
+	var closeEvents func()
 	cases := []struct {
-		Name               string
-		Error              string
-		ExpectStore        func(m *storemock.MockStore, network types.Network, registrar Registrar)
-		ExpectRegistration func(r *storemock.MockRegistration)
-		ExpectNetManager   func(m *netmanagermock.MockNetManager, n types.Network)
-		ExpectDone         bool
+		Name                      string
+		Error                     string
+		ExpectStore               func(m *storemock.MockStore, network types.Network, registrar Registrar)
+		ExpectRegistration        func(r *storemock.MockRegistration)
+		ExpectNetworkRegistration func(r *storemock.MockRegistration)
+		ExpectNetManager          func(m *netmanagermock.MockNetManager, n types.Network)
+		ExpectDone                bool
+		NeighborResolution        string
 	}{
 		{
 			Name:       "it should start listening to message and stop when there is no more message",
@@ -35,6 +46,7 @@ func TestListener_Add(t *testing.T) {
 				c := make(chan *clientv3.Event)
 				close(c)
 				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(nil)
 			},
 		}, {
 			Name:       "it should handle PUT message with an Endpoint and add it as neighbor",
@@ -53,12 +65,139 @@ func TestListener_Add(t *testing.T) {
 				}
 				close(c)
 				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(nil)
 			},
 			ExpectNetManager: func(m *netmanagermock.MockNetManager, n types.Network) {
 				m.EXPECT().AddEndpointNeigh(gomock.Any(), n, types.Endpoint{
 					ID: "1", TargetVethIP: "10.0.0.1", Hostname: "src-node.example.com",
 				}).Return(nil)
 			},
+		}, {
+			Name:       "it should ensure all the endpoints of the network as neighbors when resync is required",
+			ExpectDone: true,
+			ExpectStore: func(m *storemock.MockStore, network types.Network, registrar Registrar) {
+				m.EXPECT().Get(gomock.Any(), "/network-endpoints/1", true, gomock.Any()).Do(
+					func(_ context.Context, _ string, _ bool, data interface{}) {
+						*data.(*[]types.Endpoint) = []types.Endpoint{{ID: "1"}, {ID: "2"}}
+					},
+				).Return(nil)
+			},
+			ExpectRegistration: func(r *storemock.MockRegistration) {
+				c := make(chan *clientv3.Event)
+				resync := make(chan struct{}, 1)
+				resync <- struct{}{}
+				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(resync)
+				closeEvents = func() { close(c) }
+			},
+			ExpectNetManager: func(m *netmanagermock.MockNetManager, n types.Network) {
+				m.EXPECT().EnsureEndpointsNeigh(gomock.Any(), n, []types.Endpoint{{ID: "1"}, {ID: "2"}}).Do(
+					func(context.Context, types.Network, []types.Endpoint) { closeEvents() },
+				).Return(nil)
+			},
+		}, {
+			Name:       "it should remove all the neighbors on resync when the network has no endpoint anymore",
+			ExpectDone: true,
+			ExpectStore: func(m *storemock.MockStore, network types.Network, registrar Registrar) {
+				m.EXPECT().Get(gomock.Any(), "/network-endpoints/1", true, gomock.Any()).Return(store.ErrNotFound)
+			},
+			ExpectRegistration: func(r *storemock.MockRegistration) {
+				c := make(chan *clientv3.Event)
+				resync := make(chan struct{}, 1)
+				resync <- struct{}{}
+				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(resync)
+				closeEvents = func() { close(c) }
+			},
+			ExpectNetManager: func(m *netmanagermock.MockNetManager, n types.Network) {
+				m.EXPECT().EnsureEndpointsNeigh(gomock.Any(), n, []types.Endpoint{}).Do(
+					func(context.Context, types.Network, []types.Endpoint) { closeEvents() },
+				).Return(nil)
+			},
+		}, {
+			Name:       "it should ensure the network and the routes of the local endpoints when the network is modified",
+			ExpectDone: true,
+			ExpectStore: func(m *storemock.MockStore, network types.Network, registrar Registrar) {
+				m.EXPECT().Get(gomock.Any(), "/network-endpoints/1", true, gomock.Any()).Do(
+					func(_ context.Context, _ string, _ bool, data interface{}) {
+						*data.(*[]types.Endpoint) = []types.Endpoint{
+							{ID: "1", Hostname: config.GetPeerHostname(), Active: true},
+							{ID: "2", Hostname: "other-node.example.com", Active: true},
+						}
+					},
+				).Return(nil)
+			},
+			ExpectRegistration: func(r *storemock.MockRegistration) {
+				c := make(chan *clientv3.Event)
+				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(nil)
+				closeEvents = func() { close(c) }
+			},
+			ExpectNetworkRegistration: func(r *storemock.MockRegistration) {
+				c := make(chan *clientv3.Event, 1)
+				c <- &clientv3.Event{
+					Type: mvccpb.PUT,
+					Kv: &mvccpb.KeyValue{
+						Value: []byte(`{"id": "1", "subnets": [{"ip_range": "10.0.0.0/24"}, {"ip_range": "10.0.1.0/24"}]}`),
+					},
+				}
+				r.EXPECT().EventChan().Return(c)
+			},
+			ExpectNetManager: func(m *netmanagermock.MockNetManager, n types.Network) {
+				n.Subnets = []types.Subnet{{IPRange: "10.0.0.0/24"}, {IPRange: "10.0.1.0/24"}}
+				m.EXPECT().Ensure(gomock.Any(), n).Return(nil)
+				m.EXPECT().EnsureEndpointRoutes(gomock.Any(), n, types.Endpoint{ID: "1", Hostname: config.GetPeerHostname(), Active: true}).Do(
+					func(context.Context, types.Network, types.Endpoint) { closeEvents() },
+				).Return(nil)
+			},
+		}, {
+			Name:               "with on-demand neighbors it should add the neighbors of the endpoint having a missed IP",
+			ExpectDone:         true,
+			NeighborResolution: "on-demand",
+			ExpectStore: func(m *storemock.MockStore, network types.Network, registrar Registrar) {
+				m.EXPECT().Get(gomock.Any(), "/network-endpoints/1", true, gomock.Any()).Do(
+					func(_ context.Context, _ string, _ bool, data interface{}) {
+						*data.(*[]types.Endpoint) = []types.Endpoint{
+							{ID: "1", TargetVethIP: "10.0.0.2/24"},
+							{ID: "2", TargetVethIP: "10.0.0.3/24"},
+						}
+					},
+				).Return(nil)
+			},
+			ExpectRegistration: func(r *storemock.MockRegistration) {
+				c := make(chan *clientv3.Event)
+				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(nil)
+				closeEvents = func() { close(c) }
+			},
+			ExpectNetManager: func(m *netmanagermock.MockNetManager, n types.Network) {
+				misses := make(chan netmanager.NeighMiss, 1)
+				misses <- netmanager.NeighMiss{IP: net.ParseIP("10.0.0.3")}
+				m.EXPECT().SubscribeNeighMisses(gomock.Any(), n, gomock.Any()).Return((<-chan netmanager.NeighMiss)(misses), nil)
+				m.EXPECT().AddEndpointNeigh(gomock.Any(), n, types.Endpoint{ID: "2", TargetVethIP: "10.0.0.3/24"}).Do(
+					func(context.Context, types.Network, types.Endpoint) { closeEvents() },
+				).Return(nil)
+			},
+		}, {
+			Name:               "with on-demand neighbors it should not add the neighbors of a new endpoint",
+			ExpectDone:         true,
+			NeighborResolution: "on-demand",
+			ExpectStore: func(m *storemock.MockStore, network types.Network, registrar Registrar) {
+				m.EXPECT().Get(gomock.Any(), "/network-endpoints/1", true, gomock.Any()).Return(store.ErrNotFound)
+			},
+			ExpectRegistration: func(r *storemock.MockRegistration) {
+				c := make(chan *clientv3.Event, 1)
+				c <- &clientv3.Event{
+					Type: mvccpb.PUT,
+					Kv:   &mvccpb.KeyValue{Value: []byte(`{"id": "1", "target_veth_ip": "10.0.0.2/24"}`)},
+				}
+				close(c)
+				r.EXPECT().EventChan().Return(c)
+				r.EXPECT().ResyncChan().Return(nil)
+			},
+			ExpectNetManager: func(m *netmanagermock.MockNetManager, n types.Network) {
+				m.EXPECT().SubscribeNeighMisses(gomock.Any(), n, gomock.Any()).Return(nil, nil)
+			},
 		},
 	}
 	for _, c := range cases {
@@ -69,14 +208,17 @@ func TestListener_Add(t *testing.T) {
 			store := storemock.NewMockStore(ctrl)
 			registrar := overlaymock.NewMockRegistrar(ctrl)
 			registration := storemock.NewMockRegistration(ctrl)
-
-			config, err := config.Build()
-			require.NoError(t, err)
+			networkRegistration := storemock.NewMockRegistration(ctrl)
 
 			network := types.Network{ID: "1"}
 			registrar.EXPECT().Register("/network-endpoints/1").Return(registration, nil)
+			registrar.EXPECT().Register("/network/1").Return(networkRegistration, nil)
 
-			listener := NewNetworkEndpointListener(context.Background(), config, registrar, store)
+			listenerConfig := *config
+			if c.NeighborResolution != "" {
+				listenerConfig.NeighborResolution = c.NeighborResolution
+			}
+			listener := NewNetworkEndpointListener(context.Background(), &listenerConfig, registrar, store)
 
 			if c.ExpectStore != nil {
 				c.ExpectStore(store, network, registrar)
@@ -85,6 +227,11 @@ func TestListener_Add(t *testing.T) {
 			if c.ExpectRegistration != nil {
 				c.ExpectRegistration(registration)
 			}
+			if c.ExpectNetworkRegistration != nil {
+				c.ExpectNetworkRegistration(networkRegistration)
+			} else {
+				networkRegistration.EXPECT().EventChan().Return(nil)
+			}
 
 			if c.ExpectNetManager != nil {
 				c.ExpectNetManager(nm, network)
@@ -109,6 +256,92 @@ func TestListener_Add(t *testing.T) {
 	}
 }
 
+func TestOnDemandNeighbors(t *testing.T) {
+	neighbors := newOnDemandNeighbors()
+	endpoint := types.Endpoint{ID: "1", TargetVethIP: "10.0.0.2/24", TargetVethMAC: "02:00:00:00:00:02"}
+	assert.False(t, neighbors.set(endpoint))
+	assert.Equal(t, "1", neighbors.addresses[missAddress(netmanager.NeighMiss{IP: net.ParseIP("10.0.0.2")})])
+	mac, err := net.ParseMAC("02:00:00:00:00:02")
+	require.NoError(t, err)
+	assert.Equal(t, "1", neighbors.addresses[missAddress(netmanager.NeighMiss{MAC: mac})])
+
+	// The previous address of a modified endpoint is not indexed anymore
+	neighbors.resolved["1"] = true
+	endpoint.TargetVethIP = "10.0.0.3/24"
+	assert.True(t, neighbors.set(endpoint))
+	assert.NotContains(t, neighbors.addresses, "ip/10.0.0.2")
+	assert.Equal(t, "1", neighbors.addresses["ip/10.0.0.3"])
+
+	assert.True(t, neighbors.remove("1"))
+	assert.Empty(t, neighbors.addresses)
+	assert.Empty(t, neighbors.resolved)
+	assert.False(t, neighbors.remove("1"))
+}
+
+func TestListener_ResubscribeNeighMisses(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+	config.NeighborResolution = "on-demand"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	nm := netmanagermock.NewMockNetManager(ctrl)
+	s := storemock.NewMockStore(ctrl)
+	registrar := overlaymock.NewMockRegistrar(ctrl)
+	registration := storemock.NewMockRegistration(ctrl)
+	networkRegistration := storemock.NewMockRegistration(ctrl)
+
+	network := types.Network{ID: "1"}
+	endpoint := types.Endpoint{ID: "2", TargetVethIP: "10.0.0.3/24"}
+	registrar.EXPECT().Register("/network-endpoints/1").Return(registration, nil)
+	registrar.EXPECT().Register("/network/1").Return(networkRegistration, nil)
+	events := make(chan *clientv3.Event)
+	registration.EXPECT().EventChan().Return(events)
+	registration.EXPECT().ResyncChan().Return(nil)
+	networkRegistration.EXPECT().EventChan().Return(nil)
+	s.EXPECT().Get(gomock.Any(), "/network-endpoints/1", true, gomock.Any()).Do(
+		func(_ context.Context, _ string, _ bool, data interface{}) {
+			*data.(*[]types.Endpoint) = []types.Endpoint{endpoint}
+		},
+	).Return(nil).Times(2)
+
+	misses := make(chan netmanager.NeighMiss, 1)
+	misses <- netmanager.NeighMiss{IP: net.ParseIP("10.0.0.3")}
+	var firstStop <-chan struct{}
+	resolved := make(chan struct{})
+	gomock.InOrder(
+		nm.EXPECT().SubscribeNeighMisses(gomock.Any(), network, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ types.Network, stop <-chan struct{}) (<-chan netmanager.NeighMiss, error) {
+				firstStop = stop
+				return misses, nil
+			},
+		),
+		nm.EXPECT().AddEndpointNeigh(gomock.Any(), network, endpoint).Do(
+			func(context.Context, types.Network, types.Endpoint) { close(resolved) },
+		).Return(nil),
+		nm.EXPECT().SubscribeNeighMisses(gomock.Any(), network, gomock.Any()).Return(nil, nil),
+		// The resolved neighbors are installed again on the new VxLAN interface
+		nm.EXPECT().AddEndpointNeigh(gomock.Any(), network, endpoint).Do(
+			func(context.Context, types.Network, types.Endpoint) { close(events) },
+		).Return(nil),
+	)
+
+	listener := NewNetworkEndpointListener(ctx, config, registrar, s)
+	done, err := listener.Add(ctx, nm, network)
+	require.NoError(t, err)
+	<-resolved
+	listener.ResubscribeNeighMisses(ctx, network)
+
+	select {
+	case <-time.NewTimer(time.Second).C:
+		require.Fail(t, "should not timeout")
+	case <-done:
+	}
+	_, open := <-firstStop
+	assert.False(t, open, "the first subscription should be stopped")
+}
+
 func TestListener_Remove(t *testing.T) {
 
 }
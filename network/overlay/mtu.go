@@ -0,0 +1,66 @@
+package overlay
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+)
+
+const (
+	// DefaultMTU is used when the MTU of the underlay interface can't be
+	// detected, it fits a 1500 bytes underlay
+	DefaultMTU = 1450
+	// VxLAN encapsulation adds the outer Ethernet (14 bytes), IP (20 bytes for
+	// IPv4, 40 bytes for IPv6), UDP (8 bytes) and VxLAN (8 bytes) headers
+	vxlanIPv4Overhead = 50
+	vxlanIPv6Overhead = 70
+)
+
+// mtu returns the MTU of the interfaces of the network: the one of the
+// network if it is set, or the MTU of the underlay interface carrying the
+// peer IP of the node minus the VxLAN overhead
+func (m manager) mtu(ctx context.Context, network types.Network) int {
+	if network.MTU != 0 {
+		return network.MTU
+	}
+	mtu, err := underlayMTU(m.config.GetPeerIP())
+	if err != nil {
+		logger.Get(ctx).WithError(err).Warnf("fail to detect underlay MTU, use %d", DefaultMTU)
+		return DefaultMTU
+	}
+	return mtu
+}
+
+// underlayMTU returns the MTU available inside the VxLAN tunnels going
+// through the interface which has the address peerIP
+func underlayMTU(peerIP string) (int, error) {
+	ip := net.ParseIP(peerIP)
+	if ip == nil {
+		return 0, errors.Errorf("invalid peer IP '%v'", peerIP)
+	}
+	addrs, err := netlink.AddrList(nil, nl.FAMILY_ALL)
+	if err != nil {
+		return 0, errors.Wrapf(err, "fail to list addresses")
+	}
+	for _, addr := range addrs {
+		if !addr.IP.Equal(ip) {
+			continue
+		}
+		link, err := netlink.LinkByIndex(addr.LinkIndex)
+		if err != nil {
+			return 0, errors.Wrapf(err, "fail to get interface of %v", ip)
+		}
+		overhead := vxlanIPv4Overhead
+		if ip.To4() == nil {
+			overhead = vxlanIPv6Overhead
+		}
+		return link.Attrs().MTU - overhead, nil
+	}
+	return 0, errors.Errorf("no interface with address %v", ip)
+}
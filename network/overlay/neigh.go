@@ -1,12 +1,14 @@
 package overlay
 
 import (
+	"bytes"
 	"context"
 	"net"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
 
@@ -14,20 +16,55 @@ import (
 	"github.com/Scalingo/sand/api/types"
 )
 
+// EnsureEndpointsNeigh makes the ARP/NDP and FDB tables of the VxLAN
+// interface of the network match the endpoints: missing or different entries
+// are set and the permanent entries of the endpoints which are not in the
+// list anymore are removed. The whole batch is applied with a single netlink
+// handle.
 func (m manager) EnsureEndpointsNeigh(ctx context.Context, network types.Network, endpoints []types.Endpoint) error {
 	log := logger.Get(ctx)
+
+	nlh, link, err := vxlanHandle(network)
+	if err != nil {
+		return err
+	}
+	defer nlh.Delete()
+
+	var desired []*netlink.Neigh
 	for _, endpoint := range endpoints {
-		log = log.WithFields(logrus.Fields{
-			"endpoint_id":              endpoint.ID,
-			"endpoint_target_ip":       endpoint.TargetVethIP,
-			"endpoint_target_hostname": endpoint.Hostname,
-		})
-		ctx = logger.ToCtx(ctx, log)
-		err := m.AddEndpointNeigh(ctx, network, endpoint)
+		neighs, err := m.endpointNeighs(network, endpoint, link)
+		if err != nil {
+			// The entries of this endpoint are removed if they exist
+			log.WithError(err).WithField("endpoint_id", endpoint.ID).Error("fail to get endpoint ARP/FDB neigh rules")
+			continue
+		}
+		desired = append(desired, neighs...)
+	}
+
+	existing, err := permanentNeighs(nlh, link)
+	if err != nil {
+		return err
+	}
+
+	toSet, toRemove := diffNeighs(desired, existing)
+	for _, neigh := range toSet {
+		err := nlh.NeighSet(neigh)
+		if err != nil {
+			return errors.Wrapf(err, "could not modify neighbor entry: %+v", neigh)
+		}
+	}
+	for _, neigh := range toRemove {
+		err := nlh.NeighDel(neigh)
 		if err != nil {
-			return errors.Wrapf(err, "fail to add endpoint ARP/FDB neigh rules")
+			return errors.Wrapf(err, "could not remove stale neighbor entry: %+v", neigh)
 		}
 	}
+
+	log.WithFields(logrus.Fields{
+		"endpoints":         len(endpoints),
+		"neighbors_set":     len(toSet),
+		"neighbors_removed": len(toRemove),
+	}).Info("endpoints ARP/FDB rules ensured")
 	return nil
 }
 
@@ -44,63 +81,169 @@ func (m manager) RemoveEndpointNeigh(ctx context.Context, network types.Network,
 func (m manager) endpointNeighAction(ctx context.Context, network types.Network, endpoint types.Endpoint, action func(*netlink.Handle, *netlink.Neigh) error) error {
 	log := logger.Get(ctx)
 
+	vtepIP, err := VTEPIP(network, endpoint.HostIP)
+	if err != nil {
+		return errors.Wrapf(err, "invalid host IP of endpoint %v", endpoint.ID)
+	}
 	// No rule to add for endpoint located on the current server
-	if endpoint.HostIP == m.config.GetPeerIP() {
+	if vtepIP.Equal(net.ParseIP(m.config.GetPeerIP())) {
 		return nil
 	}
 
 	log.Info("change endpoint ARP/FDB rules")
 
+	nlh, link, err := vxlanHandle(network)
+	if err != nil {
+		return err
+	}
+	defer nlh.Delete()
+
+	neighs, err := m.endpointNeighs(network, endpoint, link)
+	if err != nil {
+		return err
+	}
+	for _, neigh := range neighs {
+		if err := action(nlh, neigh); err != nil {
+			return errors.Wrapf(err, "could not modify neighbor entry: %+v", neigh)
+		}
+	}
+	return nil
+}
+
+// vxlanHandle returns a netlink handle in the namespace of the network and the
+// VxLAN interface of the network, the handle must be deleted by the caller
+func vxlanHandle(network types.Network) (*netlink.Handle, netlink.Link, error) {
 	nsfd, err := netns.GetFromPath(network.NSHandlePath)
 	if err != nil {
-		return errors.Wrapf(err, "fail to get namespace handler")
+		return nil, nil, errors.Wrapf(err, "fail to get namespace handler")
 	}
 	defer nsfd.Close()
 
 	nlh, err := netlink.NewHandleAt(nsfd, unix.NETLINK_ROUTE)
 	if err != nil {
-		return errors.Wrapf(err, "fail to get netlink handler of netns")
+		return nil, nil, errors.Wrapf(err, "fail to get netlink handler of netns")
+	}
+	err = nlh.SetSocketTimeout(NetlinkSocketsTimeout)
+	if err != nil {
+		nlh.Delete()
+		return nil, nil, errors.Wrapf(err, "fail to configure timeout on netlink socket")
 	}
-	defer nlh.Delete()
 
 	link, err := nlh.LinkByName(VxLANInNSName)
 	if err != nil {
-		return errors.Wrapf(err, "fail to get vxlan interface")
+		nlh.Delete()
+		return nil, nil, errors.Wrapf(err, "fail to get vxlan interface")
 	}
+	return nlh, link, nil
+}
 
-	ip, _, err := net.ParseCIDR(endpoint.TargetVethIP)
+// endpointNeighs returns the ARP/NDP entries of the addresses of a remote
+// endpoint and the FDB entry of its MAC towards the VTEP of its node, there
+// are none for the local endpoints
+func (m manager) endpointNeighs(network types.Network, endpoint types.Endpoint, link netlink.Link) ([]*netlink.Neigh, error) {
+	vtepIP, err := VTEPIP(network, endpoint.HostIP)
 	if err != nil {
-		return errors.Wrapf(err, "fail to parse IP of %v '%s'", endpoint.TargetVethName, endpoint.TargetVethIP)
+		return nil, errors.Wrapf(err, "invalid host IP of endpoint %v", endpoint.ID)
+	}
+	if vtepIP.Equal(net.ParseIP(m.config.GetPeerIP())) {
+		return nil, nil
 	}
+
 	mac, err := net.ParseMAC(endpoint.TargetVethMAC)
 	if err != nil {
-		return errors.Wrapf(err, "fail to parse MAC of %v '%s'", endpoint.TargetVethName, endpoint.TargetVethMAC)
-	}
-	vtepIP := net.ParseIP(endpoint.HostIP)
-	if vtepIP == nil {
-		return errors.Errorf("fail to parse endpoint host IP (VTEP IP) '%s'", endpoint.HostIP)
+		return nil, errors.Wrapf(err, "fail to parse MAC of %v '%s'", endpoint.TargetVethName, endpoint.TargetVethMAC)
 	}
 
-	nlnh := &netlink.Neigh{
-		IP:           ip,
-		HardwareAddr: mac,
-		State:        netlink.NUD_PERMANENT,
-		LinkIndex:    link.Attrs().Index,
-	}
-	if err := action(nlh, nlnh); err != nil {
-		return errors.Wrapf(err, "could not modify neighbor entry: %+v", nlnh)
+	var neighs []*netlink.Neigh
+	// ARP entry for IPv4, NDP entry for IPv6, the family is deduced from the IP
+	for _, targetIP := range endpoint.TargetVethIPs() {
+		ip, _, err := net.ParseCIDR(targetIP)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to parse IP of %v '%s'", endpoint.TargetVethName, targetIP)
+		}
+		neighs = append(neighs, &netlink.Neigh{
+			IP:           ip,
+			HardwareAddr: mac,
+			State:        netlink.NUD_PERMANENT,
+			LinkIndex:    link.Attrs().Index,
+		})
 	}
 
-	nlnh = &netlink.Neigh{
+	// FDB entry towards the VTEP of the node of the endpoint, IPv4 or IPv6
+	neighs = append(neighs, &netlink.Neigh{
 		IP:           vtepIP,
 		HardwareAddr: mac,
 		State:        netlink.NUD_PERMANENT,
 		LinkIndex:    link.Attrs().Index,
 		Family:       unix.AF_BRIDGE,
 		Flags:        netlink.NTF_SELF,
+	})
+	return neighs, nil
+}
+
+// permanentNeighs returns the permanent ARP/NDP and FDB entries of the VxLAN
+// interface indexed by neighKey, the others are learned by the kernel
+func permanentNeighs(nlh *netlink.Handle, link netlink.Link) (map[string]*netlink.Neigh, error) {
+	neighs := map[string]*netlink.Neigh{}
+	for _, family := range []int{nl.FAMILY_V4, nl.FAMILY_V6, unix.AF_BRIDGE} {
+		list, err := nlh.NeighList(link.Attrs().Index, family)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to list neighbors of %s", VxLANInNSName)
+		}
+		for i := range list {
+			neigh := &list[i]
+			if neigh.State&netlink.NUD_PERMANENT == 0 {
+				continue
+			}
+			// Only the entries of the VxLAN interface itself are managed, not
+			// the ones of the bridge it is plugged in
+			if family == unix.AF_BRIDGE && neigh.Flags&netlink.NTF_SELF == 0 {
+				continue
+			}
+			if family == unix.AF_BRIDGE {
+				neigh.Flags = netlink.NTF_SELF
+			}
+			neighs[neighKey(neigh)] = neigh
+		}
 	}
-	if err := action(nlh, nlnh); err != nil {
-		return errors.Wrapf(err, "could not modify neighbor entry: %+v", nlnh)
+	return neighs, nil
+}
+
+// diffNeighs returns the entries to set and the stale entries to remove so
+// that the existing entries match the desired ones
+func diffNeighs(desired []*netlink.Neigh, existing map[string]*netlink.Neigh) ([]*netlink.Neigh, []*netlink.Neigh) {
+	var toSet, toRemove []*netlink.Neigh
+	wanted := map[string]bool{}
+	for _, neigh := range desired {
+		key := neighKey(neigh)
+		wanted[key] = true
+		if current, ok := existing[key]; ok && sameNeighDestination(current, neigh) {
+			continue
+		}
+		toSet = append(toSet, neigh)
 	}
-	return nil
+	for key, neigh := range existing {
+		if !wanted[key] {
+			toRemove = append(toRemove, neigh)
+		}
+	}
+	return toSet, toRemove
+}
+
+// neighKey identifies an entry: FDB entries by MAC address, ARP/NDP entries by
+// IP address
+func neighKey(neigh *netlink.Neigh) string {
+	if neigh.Family == unix.AF_BRIDGE {
+		return "fdb/" + neigh.HardwareAddr.String()
+	}
+	return "ip/" + neigh.IP.String()
+}
+
+// sameNeighDestination returns true if both entries lead to the same
+// destination: the same MAC for ARP/NDP entries, the same VTEP for FDB ones
+func sameNeighDestination(current, neigh *netlink.Neigh) bool {
+	if neigh.Family == unix.AF_BRIDGE {
+		return current.IP.Equal(neigh.IP)
+	}
+	return bytes.Equal(current.HardwareAddr, neigh.HardwareAddr)
 }
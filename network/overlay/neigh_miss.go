@@ -0,0 +1,97 @@
+package overlay
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/network/netmanager"
+)
+
+// SubscribeNeighMisses returns the neighbors missed by the VxLAN interface of
+// the network, the kernel notifies them because the interface is created
+// with L2miss and L3miss. The channel is closed once done is closed.
+//
+// The subscription is bound to the current namespace of the network, it must
+// be done again if the namespace is recreated.
+func (m manager) SubscribeNeighMisses(ctx context.Context, network types.Network, done <-chan struct{}) (<-chan netmanager.NeighMiss, error) {
+	log := logger.Get(ctx)
+
+	nsfd, err := netns.GetFromPath(network.NSHandlePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get namespace handler")
+	}
+
+	// The handle is kept to look up the VxLAN interface again if it is
+	// recreated, it is closed with the subscription
+	nlh, err := netlink.NewHandleAt(nsfd, unix.NETLINK_ROUTE)
+	if err != nil {
+		nsfd.Close()
+		return nil, errors.Wrapf(err, "fail to get netlink handler of netns")
+	}
+	closeHandles := func() {
+		nlh.Delete()
+		nsfd.Close()
+	}
+
+	link, err := nlh.LinkByName(VxLANInNSName)
+	if err != nil {
+		closeHandles()
+		return nil, errors.Wrapf(err, "fail to get vxlan interface")
+	}
+	index := link.Attrs().Index
+
+	updates := make(chan netlink.NeighUpdate)
+	err = netlink.NeighSubscribeWithOptions(updates, done, netlink.NeighSubscribeOptions{
+		Namespace: &nsfd,
+		ErrorCallback: func(err error) {
+			select {
+			case <-done:
+				// The subscription socket has been closed
+			default:
+				log.WithError(err).Error("fail to receive neighbor notification")
+			}
+		},
+	})
+	if err != nil {
+		closeHandles()
+		return nil, errors.Wrapf(err, "fail to subscribe to neighbor notifications")
+	}
+
+	misses := make(chan netmanager.NeighMiss)
+	go func() {
+		defer close(misses)
+		defer closeHandles()
+		for update := range updates {
+			// Misses are notified as requests for the neighbor
+			if update.Type != unix.RTM_GETNEIGH {
+				continue
+			}
+			if update.LinkIndex != index {
+				// The VxLAN interface may have been recreated with another index
+				link, err := nlh.LinkByName(VxLANInNSName)
+				if err != nil || link.Attrs().Index != update.LinkIndex {
+					continue
+				}
+				index = link.Attrs().Index
+			}
+			var miss netmanager.NeighMiss
+			if update.Family == unix.AF_BRIDGE {
+				miss.MAC = update.HardwareAddr
+			} else {
+				miss.IP = update.IP
+			}
+			// updates is drained until it is closed after done
+			select {
+			case misses <- miss:
+			case <-done:
+			}
+		}
+	}()
+	return misses, nil
+}
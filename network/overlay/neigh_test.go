@@ -0,0 +1,71 @@
+package overlay
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestDiffNeighs(t *testing.T) {
+	mac := func(s string) net.HardwareAddr {
+		m, _ := net.ParseMAC(s)
+		return m
+	}
+	arp := func(ip, hw string) *netlink.Neigh {
+		return &netlink.Neigh{IP: net.ParseIP(ip), HardwareAddr: mac(hw)}
+	}
+	fdb := func(hw, vtep string) *netlink.Neigh {
+		return &netlink.Neigh{IP: net.ParseIP(vtep), HardwareAddr: mac(hw), Family: unix.AF_BRIDGE}
+	}
+	index := func(neighs ...*netlink.Neigh) map[string]*netlink.Neigh {
+		m := map[string]*netlink.Neigh{}
+		for _, n := range neighs {
+			m[neighKey(n)] = n
+		}
+		return m
+	}
+
+	cases := []struct {
+		Name     string
+		Desired  []*netlink.Neigh
+		Existing map[string]*netlink.Neigh
+		ToSet    []*netlink.Neigh
+		ToRemove []*netlink.Neigh
+	}{
+		{
+			Name:     "all the entries are set in an empty table",
+			Desired:  []*netlink.Neigh{arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")},
+			Existing: index(),
+			ToSet:    []*netlink.Neigh{arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")},
+		}, {
+			Name:     "identical entries are not set again",
+			Desired:  []*netlink.Neigh{arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")},
+			Existing: index(arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")),
+		}, {
+			Name:     "an endpoint moved to another node has its FDB entry set",
+			Desired:  []*netlink.Neigh{arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.3")},
+			Existing: index(arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")),
+			ToSet:    []*netlink.Neigh{fdb("02:84:0a:00:00:02", "192.168.1.3")},
+		}, {
+			Name:     "the entries of the deleted endpoints are removed",
+			Desired:  []*netlink.Neigh{arp("10.0.0.2", "02:84:0a:00:00:02")},
+			Existing: index(arp("10.0.0.2", "02:84:0a:00:00:02"), arp("10.0.0.3", "02:84:0a:00:00:03")),
+			ToRemove: []*netlink.Neigh{arp("10.0.0.3", "02:84:0a:00:00:03")},
+		}, {
+			Name:     "all the entries are removed when there is no endpoint",
+			Existing: index(arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")),
+			ToRemove: []*netlink.Neigh{arp("10.0.0.2", "02:84:0a:00:00:02"), fdb("02:84:0a:00:00:02", "192.168.1.2")},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			toSet, toRemove := diffNeighs(c.Desired, c.Existing)
+			assert.ElementsMatch(t, c.ToSet, toSet)
+			assert.ElementsMatch(t, c.ToRemove, toRemove)
+		})
+	}
+}
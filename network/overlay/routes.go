@@ -0,0 +1,87 @@
+package overlay
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+)
+
+// EnsureEndpointRoutes updates the routes of an endpoint whose addresses have
+// been set by SAND, when subnets have been added to its network, and the MTU
+// of its target interface when the one of the network has been changed
+func (m manager) EnsureEndpointRoutes(ctx context.Context, network types.Network, endpoint types.Endpoint) error {
+	log := logger.Get(ctx)
+	if endpoint.TargetNetnsPath == "" {
+		return nil
+	}
+
+	targetnsfd, err := netns.GetFromPath(endpoint.TargetNetnsPath)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get target namespace handler: %s", endpoint.TargetNetnsPath)
+	}
+	defer targetnsfd.Close()
+
+	targetnlh, err := netlink.NewHandleAt(targetnsfd, unix.NETLINK_ROUTE)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get target namespace netlink handler")
+	}
+	defer targetnlh.Delete()
+
+	// The target interface may have been renamed, it is found by its MAC
+	links, err := targetnlh.LinkList()
+	if err != nil {
+		return errors.Wrapf(err, "fail to list links of target namespace")
+	}
+	for _, link := range links {
+		if link.Attrs().HardwareAddr.String() != endpoint.TargetVethMAC {
+			continue
+		}
+		mtu := m.mtu(ctx, network)
+		if link.Attrs().MTU != mtu {
+			err := targetnlh.LinkSetMTU(link, mtu)
+			if err != nil {
+				return errors.Wrapf(err, "fail to set MTU %d on %s", mtu, link.Attrs().Name)
+			}
+		}
+		return ensureSubnetsRoutes(targetnlh, link, network, endpoint)
+	}
+	log.Info("target interface of endpoint not found, skip routes")
+	return nil
+}
+
+// ensureSubnetsRoutes adds on-link routes through the target interface of the
+// endpoint to the subnets of the network which are not the one of its IPv4
+// address. All the subnets are sharing the same L2 segment.
+func ensureSubnetsRoutes(nlh *netlink.Handle, link netlink.Link, network types.Network, endpoint types.Endpoint) error {
+	_, addrNet, err := net.ParseCIDR(endpoint.TargetVethIP)
+	if err != nil {
+		return errors.Wrapf(err, "fail to parse %s IP address", endpoint.TargetVethIP)
+	}
+
+	for _, subnet := range network.IPv4Subnets() {
+		_, subnetNet, err := net.ParseCIDR(subnet.IPRange)
+		if err != nil {
+			return errors.Wrapf(err, "fail to parse subnet %s", subnet.IPRange)
+		}
+		if subnetNet.String() == addrNet.String() {
+			continue
+		}
+		route := &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Dst:       subnetNet,
+			Scope:     netlink.SCOPE_LINK,
+		}
+		err = nlh.RouteReplace(route)
+		if err != nil {
+			return errors.Wrapf(err, "fail to add route to %s on %s", subnetNet, link.Attrs().Name)
+		}
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 package overlay
 
 import (
-	"context"
+	"github.com/pkg/errors"
 
 	"github.com/Scalingo/sand/config"
 	"github.com/Scalingo/sand/idmanager"
@@ -9,11 +9,39 @@ import (
 )
 
 const (
-	IDManagerName         = "vni"
-	VxLANField            = "vxlan_vni"
-	StoreCollectionPrefix = "/network/"
+	IDManagerName = "vni"
 )
 
-func NewVNIGenerator(ctx context.Context, config *config.Config, store store.Store) idmanager.Manager {
-	return idmanager.New(config.MaxVNI, store, IDManagerName, VxLANField, StoreCollectionPrefix)
+func NewVNIGenerator(config *config.Config, store store.Store) idmanager.Manager {
+	return idmanager.New(config.MaxVNI, store, IDManagerName)
+}
+
+// VNIRanges returns the ranges in which the VNIs of the networks are
+// allocated, the ones of the infrastructure networks are only allocated to
+// them
+func VNIRanges(config *config.Config, infrastructure bool) ([]idmanager.Range, error) {
+	infrastructureRanges, err := idmanager.ParseRanges(config.VNIInfrastructureRanges)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid VNI_INFRASTRUCTURE_RANGES")
+	}
+	if infrastructure {
+		if len(infrastructureRanges) == 0 {
+			return nil, errors.New("no VNI range for infrastructure networks, VNI_INFRASTRUCTURE_RANGES is not set")
+		}
+		return infrastructureRanges, nil
+	}
+
+	if config.VNIRanges == "" {
+		return idmanager.Subtract(
+			[]idmanager.Range{{First: 1, Last: config.MaxVNI}}, infrastructureRanges,
+		), nil
+	}
+	ranges, err := idmanager.ParseRanges(config.VNIRanges)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid VNI_RANGES")
+	}
+	if idmanager.Overlap(ranges, infrastructureRanges) {
+		return nil, errors.New("VNI_RANGES and VNI_INFRASTRUCTURE_RANGES overlap")
+	}
+	return ranges, nil
 }
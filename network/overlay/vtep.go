@@ -0,0 +1,37 @@
+package overlay
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+)
+
+// VTEPFamily returns the family of the VTEP address
+func VTEPFamily(address string) (types.VTEPFamily, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", errors.Errorf("invalid VTEP address '%v'", address)
+	}
+	if ip.To4() == nil {
+		return types.VTEPFamilyIPv6, nil
+	}
+	return types.VTEPFamilyIPv4, nil
+}
+
+// VTEPIP parses the VTEP address of a node of network, the VTEPs of a
+// network must all have the same family
+func VTEPIP(network types.Network, address string) (net.IP, error) {
+	family, err := VTEPFamily(address)
+	if err != nil {
+		return nil, err
+	}
+	if family != network.GetVTEPFamily() {
+		return nil, errors.Errorf(
+			"VTEP address %v is %s, the VTEPs of %s are %s, networks mixing VTEP families are not supported",
+			address, family, network, network.GetVTEPFamily(),
+		)
+	}
+	return net.ParseIP(address), nil
+}
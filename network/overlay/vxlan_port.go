@@ -0,0 +1,57 @@
+package overlay
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+)
+
+// DefaultVxLANPort is the IANA port of VxLAN, it is used by the networks
+// created before the port was saved with them
+const DefaultVxLANPort = 4789
+
+// CheckVxLANPorts returns an error if the destination port or the source port
+// range can't be used by the VxLAN interfaces of a network
+func CheckVxLANPorts(port int, sourcePortRange string) error {
+	if port < 0 || port > 65535 {
+		return errors.Errorf("invalid VxLAN port %d", port)
+	}
+	_, _, err := ParseSourcePortRange(sourcePortRange)
+	return err
+}
+
+// ParseSourcePortRange parses a UDP source port range like "49152-65535", an
+// empty range is the default range of the kernel and returns 0, 0
+func ParseSourcePortRange(s string) (int, int, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	bounds := strings.SplitN(s, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, errors.Errorf("invalid source port range '%v', expected low-high", s)
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "invalid source port range '%v'", s)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "invalid source port range '%v'", s)
+	}
+	if low < 1 || high > 65535 || low > high {
+		return 0, 0, errors.Errorf("invalid source port range '%v'", s)
+	}
+	return low, high, nil
+}
+
+// vxlanPort is the destination port of the VxLAN interface of network, the
+// same on all the nodes
+func vxlanPort(network types.Network) int {
+	if network.VxLANPort == 0 {
+		return DefaultVxLANPort
+	}
+	return network.VxLANPort
+}
@@ -0,0 +1,40 @@
+package overlay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourcePortRange(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Range string
+		Low   int
+		High  int
+		Error string
+	}{
+		{Name: "empty range is the kernel default", Range: ""},
+		{Name: "valid range", Range: "49152-65535", Low: 49152, High: 65535},
+		{Name: "single port", Range: "5000-5000", Low: 5000, High: 5000},
+		{Name: "missing high bound", Range: "5000", Error: "expected low-high"},
+		{Name: "not a number", Range: "a-5000", Error: "invalid source port range"},
+		{Name: "reversed bounds", Range: "6000-5000", Error: "invalid source port range"},
+		{Name: "out of range", Range: "0-70000", Error: "invalid source port range"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			low, high, err := ParseSourcePortRange(c.Range)
+			if c.Error != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), c.Error)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.Low, low)
+			assert.Equal(t, c.High, high)
+		})
+	}
+}
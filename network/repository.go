@@ -18,6 +18,13 @@ type Repository interface {
 	Deactivate(ctx context.Context, network types.Network) error
 	Delete(ctx context.Context, network types.Network, a ipallocator.IPAllocator) error
 	Exists(ctx context.Context, id string) (types.Network, bool, error)
+	UpdateSubnets(ctx context.Context, network types.Network, subnets []types.Subnet) (types.Network, error)
+	UpdateMTU(ctx context.Context, network types.Network, mtu int) (types.Network, error)
+	// ReserveVNI keeps a VNI out of the allocation until it is released or
+	// taken over by a network created with it
+	ReserveVNI(ctx context.Context, params params.VNIReservationCreate) (types.VNIReservation, error)
+	VNIReservations(ctx context.Context) ([]types.VNIReservation, error)
+	ReleaseVNIReservation(ctx context.Context, vni int) error
 }
 
 type repository struct {
@@ -0,0 +1,48 @@
+package network
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/store"
+)
+
+// ErrSubnetsModified is returned by UpdateSubnets when the subnets of the
+// network have been modified since it has been read
+var ErrSubnetsModified = errors.New("subnets of the network modified concurrently")
+
+// UpdateSubnets replaces the IPv4 subnets of the network, the first one is
+// also exposed as IPRange and Gateway. Nodes of the network update their
+// bridge and the routes of their endpoints when they get the modification.
+//
+// The other fields of the network modified in the meantime are kept, the
+// subnets must be the ones of network.
+func (c *repository) UpdateSubnets(ctx context.Context, network types.Network, subnets []types.Subnet) (types.Network, error) {
+	log := logger.Get(ctx)
+	if len(subnets) == 0 {
+		return network, errors.New("a network needs at least one subnet")
+	}
+
+	var stored types.Network
+	err := store.Update(ctx, c.store, network.StorageKey(), &stored, func(found bool) ([]store.Op, error) {
+		if !found {
+			return nil, errors.Errorf("network %s not found", network)
+		}
+		if !reflect.DeepEqual(stored.IPv4Subnets(), network.IPv4Subnets()) {
+			return nil, ErrSubnetsModified
+		}
+		stored.Subnets = subnets
+		stored.IPRange = subnets[0].IPRange
+		stored.Gateway = subnets[0].Gateway
+		return []store.Op{store.OpSet(network.StorageKey(), &stored)}, nil
+	})
+	if err != nil {
+		return network, errors.Wrapf(err, "fail to save network %s in store", network)
+	}
+	log.WithField("subnets_count", len(subnets)).Info("Network subnets updated")
+	return stored, nil
+}
@@ -0,0 +1,52 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
+)
+
+func TestRepository_UpdateSubnets(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	network := types.Network{ID: "net-1", IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"}
+	subnets := []types.Subnet{
+		{IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"},
+		{IPRange: "10.0.1.0/24", Gateway: "10.0.1.1/24"},
+	}
+
+	t.Run("it should keep the fields modified since the network has been read", func(t *testing.T) {
+		r := &repository{config: config, store: store.NewMemory(config)}
+		modified := network
+		modified.MTU = 1400
+		require.NoError(t, r.store.Set(ctx, network.StorageKey(), modified))
+
+		updated, err := r.UpdateSubnets(ctx, network, subnets)
+		require.NoError(t, err)
+		assert.Equal(t, subnets, updated.Subnets)
+		assert.Equal(t, 1400, updated.MTU)
+
+		var stored types.Network
+		require.NoError(t, r.store.Get(ctx, network.StorageKey(), false, &stored))
+		assert.Equal(t, updated, stored)
+	})
+
+	t.Run("it should refuse to overwrite subnets modified since the network has been read", func(t *testing.T) {
+		r := &repository{config: config, store: store.NewMemory(config)}
+		modified := network
+		modified.Subnets = []types.Subnet{subnets[0], {IPRange: "10.0.2.0/24", Gateway: "10.0.2.1/24"}}
+		require.NoError(t, r.store.Set(ctx, network.StorageKey(), modified))
+
+		_, err := r.UpdateSubnets(ctx, network, subnets)
+		assert.Equal(t, ErrSubnetsModified, errors.Cause(err))
+	})
+}
@@ -0,0 +1,157 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/idmanager"
+	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
+)
+
+var (
+	ErrVNIOutOfRange          = errors.New("VNI out of the configured ranges")
+	ErrVNIUnavailable         = errors.New("VNI already used")
+	ErrVNIReservationNotFound = errors.New("VNI reservation not found")
+)
+
+// checkVNIRange returns ErrVNIOutOfRange if vni is not in the ranges of the
+// networks, or of the infrastructure networks if infrastructure is set
+func (r *repository) checkVNIRange(vni int, infrastructure bool) error {
+	ranges, err := overlay.VNIRanges(r.config, infrastructure)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get VNI ranges")
+	}
+	for _, vniRange := range ranges {
+		if vniRange.Contains(vni) {
+			return nil
+		}
+	}
+	return ErrVNIOutOfRange
+}
+
+// usedVNIs returns the VNIs of the stored networks. During a rolling upgrade,
+// the agents which don't know the bitmap of the VNIs still allocate them by
+// listing the networks, without setting their bit.
+func (r *repository) usedVNIs(ctx context.Context) ([]idmanager.Range, error) {
+	var networks []types.Network
+	err := r.store.Get(ctx, "/network/", true, &networks)
+	if err != nil && err != store.ErrNotFound {
+		return nil, errors.Wrapf(err, "fail to list networks")
+	}
+	var used []idmanager.Range
+	for _, network := range networks {
+		if network.VxLANVNI != 0 {
+			used = append(used, idmanager.Range{First: network.VxLANVNI, Last: network.VxLANVNI})
+		}
+	}
+	return used, nil
+}
+
+// checkVNIUnused returns ErrVNIUnavailable if a stored network uses vni
+func (r *repository) checkVNIUnused(ctx context.Context, vni int) error {
+	used, err := r.usedVNIs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, vniRange := range used {
+		if vniRange.Contains(vni) {
+			return ErrVNIUnavailable
+		}
+	}
+	return nil
+}
+
+// saveWithVNI saves the network with the VNI requested by the caller. A
+// reserved VNI is taken over by the network.
+func (r *repository) saveWithVNI(ctx context.Context, network types.Network) error {
+	err := r.checkVNIRange(network.VxLANVNI, network.Infrastructure)
+	if err != nil {
+		return err
+	}
+	err = r.checkVNIUnused(ctx, network.VxLANVNI)
+	if err != nil {
+		return err
+	}
+
+	reservation := types.VNIReservation{VNI: network.VxLANVNI}
+	return overlay.NewVNIGenerator(r.config, r.store).Update(ctx, network.VxLANVNI, func(allocated bool) (bool, []store.Op, error) {
+		ops := []store.Op{store.OpSet(network.StorageKey(), &network)}
+		if !allocated {
+			return true, ops, nil
+		}
+		err := r.store.Get(ctx, reservation.StorageKey(), false, &reservation)
+		if err == store.ErrNotFound {
+			return true, nil, ErrVNIUnavailable
+		}
+		if err != nil {
+			return true, nil, errors.Wrapf(err, "fail to get reservation of VNI %d", network.VxLANVNI)
+		}
+		logger.Get(ctx).Infof("network takes over reserved VNI %d", network.VxLANVNI)
+		return true, append(ops, store.OpDelete(reservation.StorageKey())), nil
+	})
+}
+
+func (r *repository) ReserveVNI(ctx context.Context, params params.VNIReservationCreate) (types.VNIReservation, error) {
+	reservation := types.VNIReservation{
+		VNI: params.VNI, Description: params.Description, CreatedAt: time.Now(),
+	}
+	err := r.checkVNIRange(reservation.VNI, false)
+	if err == ErrVNIOutOfRange {
+		err = r.checkVNIRange(reservation.VNI, true)
+	}
+	if err != nil {
+		return reservation, err
+	}
+	err = r.checkVNIUnused(ctx, reservation.VNI)
+	if err != nil {
+		return reservation, err
+	}
+
+	err = overlay.NewVNIGenerator(r.config, r.store).Reserve(
+		ctx, reservation.VNI, store.OpSet(reservation.StorageKey(), &reservation),
+	)
+	if errors.Cause(err) == idmanager.ErrIDUnavailable {
+		return reservation, ErrVNIUnavailable
+	}
+	if err != nil {
+		return reservation, errors.Wrapf(err, "fail to reserve VNI %d", reservation.VNI)
+	}
+	logger.Get(ctx).WithField("vni", reservation.VNI).Info("VNI reserved")
+	return reservation, nil
+}
+
+func (r *repository) VNIReservations(ctx context.Context) ([]types.VNIReservation, error) {
+	reservations := []types.VNIReservation{}
+	err := r.store.Get(ctx, types.VNIReservationStoragePrefix+"/", true, &reservations)
+	if err != nil && err != store.ErrNotFound {
+		return nil, errors.Wrapf(err, "fail to list VNI reservations")
+	}
+	return reservations, nil
+}
+
+// ReleaseVNIReservation deletes the reservation and frees its VNI, unless a
+// network has taken it over in the meantime
+func (r *repository) ReleaseVNIReservation(ctx context.Context, vni int) error {
+	reservation := types.VNIReservation{VNI: vni}
+	err := overlay.NewVNIGenerator(r.config, r.store).Update(ctx, vni, func(allocated bool) (bool, []store.Op, error) {
+		err := r.store.Get(ctx, reservation.StorageKey(), false, &reservation)
+		if err == store.ErrNotFound {
+			return allocated, nil, ErrVNIReservationNotFound
+		}
+		if err != nil {
+			return allocated, nil, errors.Wrapf(err, "fail to get reservation of VNI %d", vni)
+		}
+		return false, []store.Op{store.OpDelete(reservation.StorageKey())}, nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Get(ctx).WithField("vni", vni).Info("VNI reservation released")
+	return nil
+}
@@ -0,0 +1,109 @@
+package network
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
+)
+
+func TestRepository_VNIReservations(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+	config.MaxVNI = 10
+	config.VNIInfrastructureRanges = "9-10"
+
+	newRepository := func() *repository {
+		return &repository{config: config, store: store.NewMemory(config)}
+	}
+
+	t.Run("it should create a network with the requested VNI once", func(t *testing.T) {
+		r := newRepository()
+		network, err := r.Create(ctx, params.NetworkCreate{VxLANVNI: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 2, network.VxLANVNI)
+
+		_, err = r.Create(ctx, params.NetworkCreate{VxLANVNI: 2})
+		assert.Equal(t, ErrVNIUnavailable, errors.Cause(err))
+
+		network, err = r.Create(ctx, params.NetworkCreate{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, network.VxLANVNI)
+		network, err = r.Create(ctx, params.NetworkCreate{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, network.VxLANVNI)
+	})
+
+	t.Run("it should not give the VNI of a network created by an older agent", func(t *testing.T) {
+		r := newRepository()
+		// Older agents don't set the bit of the VNI in the bitmap
+		older := types.Network{ID: "older", VxLANVNI: 1}
+		require.NoError(t, r.store.Set(ctx, older.StorageKey(), &older))
+
+		network, err := r.Create(ctx, params.NetworkCreate{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, network.VxLANVNI)
+		_, err = r.Create(ctx, params.NetworkCreate{VxLANVNI: 1})
+		assert.Equal(t, ErrVNIUnavailable, errors.Cause(err))
+		_, err = r.ReserveVNI(ctx, params.VNIReservationCreate{VNI: 1})
+		assert.Equal(t, ErrVNIUnavailable, errors.Cause(err))
+	})
+
+	t.Run("it should refuse a VNI out of the ranges of the network", func(t *testing.T) {
+		r := newRepository()
+		_, err := r.Create(ctx, params.NetworkCreate{VxLANVNI: 9})
+		assert.Equal(t, ErrVNIOutOfRange, errors.Cause(err))
+		_, err = r.Create(ctx, params.NetworkCreate{VxLANVNI: 2, Infrastructure: true})
+		assert.Equal(t, ErrVNIOutOfRange, errors.Cause(err))
+
+		network, err := r.Create(ctx, params.NetworkCreate{VxLANVNI: 9, Infrastructure: true})
+		require.NoError(t, err)
+		assert.Equal(t, 9, network.VxLANVNI)
+	})
+
+	t.Run("a reserved VNI should only be given to the network requesting it", func(t *testing.T) {
+		r := newRepository()
+		_, err := r.ReserveVNI(ctx, params.VNIReservationCreate{VNI: 1, Description: "hardware VTEP"})
+		require.NoError(t, err)
+		_, err = r.ReserveVNI(ctx, params.VNIReservationCreate{VNI: 1})
+		assert.Equal(t, ErrVNIUnavailable, errors.Cause(err))
+
+		network, err := r.Create(ctx, params.NetworkCreate{})
+		require.NoError(t, err)
+		assert.Equal(t, 2, network.VxLANVNI)
+
+		network, err = r.Create(ctx, params.NetworkCreate{VxLANVNI: 1})
+		require.NoError(t, err)
+		assert.Equal(t, 1, network.VxLANVNI)
+		reservations, err := r.VNIReservations(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reservations)
+
+		// The reservation has been taken over by the network
+		err = r.ReleaseVNIReservation(ctx, 1)
+		assert.Equal(t, ErrVNIReservationNotFound, err)
+	})
+
+	t.Run("releasing a reservation should free its VNI", func(t *testing.T) {
+		r := newRepository()
+		_, err := r.ReserveVNI(ctx, params.VNIReservationCreate{VNI: 1})
+		require.NoError(t, err)
+		reservations, err := r.VNIReservations(ctx)
+		require.NoError(t, err)
+		require.Len(t, reservations, 1)
+		assert.Equal(t, 1, reservations[0].VNI)
+
+		require.NoError(t, r.ReleaseVNIReservation(ctx, 1))
+		network, err := r.Create(ctx, params.NetworkCreate{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, network.VxLANVNI)
+	})
+}
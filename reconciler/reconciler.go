@@ -0,0 +1,236 @@
+// Package reconciler periodically compares the kernel state of the networks
+// and endpoints of the node with the store and repairs the drifts
+package reconciler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/endpoint"
+	"github.com/Scalingo/sand/network"
+	"github.com/Scalingo/sand/network/netmanager"
+)
+
+type Reconciler struct {
+	config    *config.Config
+	networks  network.Repository
+	endpoints endpoint.Repository
+	managers  netmanager.ManagerMap
+
+	metricsM sync.Mutex
+	metrics  Metrics
+}
+
+// Metrics are the statistics of the reconciliation passes since the agent
+// started
+type Metrics struct {
+	Runs           int64                          `json:"runs"`
+	LastRunAt      time.Time                      `json:"last_run_at"`
+	LastRunErrors  int64                          `json:"last_run_errors"`
+	Drifts         map[netmanager.DriftKind]int64 `json:"drifts"`
+	Repairs        int64                          `json:"repairs"`
+	RepairFailures int64                          `json:"repair_failures"`
+}
+
+func New(c *config.Config, networks network.Repository, endpoints endpoint.Repository, managers netmanager.ManagerMap) *Reconciler {
+	return &Reconciler{
+		config:    c,
+		networks:  networks,
+		endpoints: endpoints,
+		managers:  managers,
+		metrics:   Metrics{Drifts: map[netmanager.DriftKind]int64{}},
+	}
+}
+
+// Run reconciles the node every RECONCILE_INTERVAL until ctx is canceled
+func (r *Reconciler) Run(ctx context.Context) {
+	log := logger.Get(ctx).WithField("service", "reconciler")
+	ctx = logger.ToCtx(ctx, log)
+	if r.config.ReconcileInterval <= 0 {
+		log.Info("reconciler disabled")
+		return
+	}
+
+	ticker := time.NewTicker(r.config.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.Reconcile(ctx)
+			if err != nil {
+				log.WithError(err).Error("fail to reconcile node")
+			}
+		}
+	}
+}
+
+// Reconcile checks every network having an active endpoint on the node and
+// repairs it, a network which can't be checked or repaired doesn't stop the
+// pass
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	log := logger.Get(ctx)
+
+	localEndpoints, err := r.endpoints.List(ctx, map[string]string{"hostname": r.config.GetPeerHostname()})
+	if err != nil {
+		return errors.Wrapf(err, "fail to list endpoints of %v", r.config.GetPeerHostname())
+	}
+	var networkIDs []string
+	active := map[string]bool{}
+	for _, endpoint := range localEndpoints {
+		if !endpoint.Active || active[endpoint.NetworkID] {
+			continue
+		}
+		active[endpoint.NetworkID] = true
+		networkIDs = append(networkIDs, endpoint.NetworkID)
+	}
+
+	var failures int64
+	for _, id := range networkIDs {
+		log := log.WithField("network_id", id)
+		err := r.reconcileNetwork(logger.ToCtx(ctx, log), id)
+		if err != nil {
+			failures++
+			log.WithError(err).Error("fail to reconcile network")
+		}
+	}
+
+	r.metricsM.Lock()
+	r.metrics.Runs++
+	r.metrics.LastRunAt = time.Now()
+	r.metrics.LastRunErrors = failures
+	r.metricsM.Unlock()
+	return nil
+}
+
+func (r *Reconciler) reconcileNetwork(ctx context.Context, id string) error {
+	log := logger.Get(ctx)
+
+	network, ok, err := r.networks.Exists(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get network")
+	}
+	if !ok {
+		// The network is being deleted
+		return nil
+	}
+	log = log.WithField("network_name", network.Name)
+	ctx = logger.ToCtx(ctx, log)
+	m := r.managers.Get(network.Type)
+	if m == nil {
+		return errors.Errorf("no manager for network type %v", network.Type)
+	}
+
+	endpoints, err := r.endpoints.List(ctx, map[string]string{"network_id": network.ID})
+	if err != nil {
+		return errors.Wrapf(err, "fail to list endpoints")
+	}
+
+	drifts, err := m.CheckNetwork(ctx, network, endpoints)
+	if err != nil {
+		return errors.Wrapf(err, "fail to check network")
+	}
+	r.report(log, drifts)
+
+	// The endpoints are checked again once the network is repaired, their
+	// interfaces may have been removed with the ones of the network
+	if hasNetworkDrift(drifts) {
+		err = r.repair(ctx, "network", func() error { return m.Ensure(ctx, network) })
+		if err != nil {
+			return err
+		}
+		drifts, err = m.CheckNetwork(ctx, network, endpoints)
+		if err != nil {
+			return errors.Wrapf(err, "fail to check repaired network")
+		}
+		r.report(log, drifts)
+	}
+
+	repaired := map[string]bool{}
+	for _, drift := range drifts {
+		if drift.EndpointID == "" || repaired[drift.EndpointID] {
+			continue
+		}
+		repaired[drift.EndpointID] = true
+		for _, e := range endpoints {
+			if e.ID != drift.EndpointID {
+				continue
+			}
+			ctx := logger.ToCtx(ctx, log.WithField("endpoint_id", e.ID))
+			err := r.repair(ctx, "endpoint", func() error { return r.repairEndpoint(ctx, network, e) })
+			if err != nil {
+				log.WithError(err).WithField("endpoint_id", e.ID).Error("fail to repair endpoint")
+			}
+		}
+	}
+
+	for _, drift := range drifts {
+		if drift.Kind == netmanager.DriftNeighbor {
+			return r.repair(ctx, "neighbors", func() error { return m.EnsureEndpointsNeigh(ctx, network, endpoints) })
+		}
+	}
+	return nil
+}
+
+// repairEndpoint recreates the interfaces of the endpoint, the repository
+// checks again that it is active under its lock since it may have been
+// deactivated or deleted through the API since the network has been checked
+func (r *Reconciler) repairEndpoint(ctx context.Context, network types.Network, e types.Endpoint) error {
+	return r.endpoints.Repair(ctx, network, e.ID)
+}
+
+func (r *Reconciler) repair(ctx context.Context, target string, fn func() error) error {
+	log := logger.Get(ctx).WithField("repaired", target)
+	err := fn()
+
+	r.metricsM.Lock()
+	defer r.metricsM.Unlock()
+	if err != nil {
+		r.metrics.RepairFailures++
+		return errors.Wrapf(err, "fail to repair %s", target)
+	}
+	r.metrics.Repairs++
+	log.Info("drift repaired")
+	return nil
+}
+
+func (r *Reconciler) report(log logrus.FieldLogger, drifts []netmanager.Drift) {
+	r.metricsM.Lock()
+	defer r.metricsM.Unlock()
+	for _, drift := range drifts {
+		r.metrics.Drifts[drift.Kind]++
+		log.WithFields(logrus.Fields{
+			"drift_kind":  drift.Kind,
+			"endpoint_id": drift.EndpointID,
+		}).Warn(drift.Description)
+	}
+}
+
+// Metrics returns a copy of the statistics of the reconciler
+func (r *Reconciler) Metrics() Metrics {
+	r.metricsM.Lock()
+	defer r.metricsM.Unlock()
+	metrics := r.metrics
+	metrics.Drifts = make(map[netmanager.DriftKind]int64, len(r.metrics.Drifts))
+	for kind, count := range r.metrics.Drifts {
+		metrics.Drifts[kind] = count
+	}
+	return metrics
+}
+
+func hasNetworkDrift(drifts []netmanager.Drift) bool {
+	for _, drift := range drifts {
+		if drift.EndpointID == "" && drift.Kind != netmanager.DriftNeighbor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/network/netmanager"
+	"github.com/Scalingo/sand/test/mocks/endpointmock"
+	"github.com/Scalingo/sand/test/mocks/network/netmanagermock"
+	"github.com/Scalingo/sand/test/mocks/networkmock"
+)
+
+func TestReconciler_Reconcile(t *testing.T) {
+	c := &config.Config{PeerHostname: "node-1"}
+	network := types.Network{ID: "net-1", Type: types.OverlayNetworkType}
+	local := types.Endpoint{ID: "ep-1", NetworkID: "net-1", Hostname: "node-1", Active: true, TargetNetnsPath: "/var/run/netns/ep-1"}
+	remote := types.Endpoint{ID: "ep-2", NetworkID: "net-1", Hostname: "node-2", Active: true}
+
+	cases := []struct {
+		Name             string
+		ExpectNetManager func(m *netmanagermock.MockNetManager)
+		ExpectEndpoints  func(r *endpointmock.MockRepository)
+		Drifts           map[netmanager.DriftKind]int64
+		Repairs          int64
+		RepairFailures   int64
+	}{
+		{
+			Name: "it should not repair anything without drift",
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().CheckNetwork(gomock.Any(), network, []types.Endpoint{local, remote}).Return(nil, nil)
+			},
+			Drifts: map[netmanager.DriftKind]int64{},
+		}, {
+			Name: "it should ensure the network and then repair the endpoints whose interfaces are missing",
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				gomock.InOrder(
+					m.EXPECT().CheckNetwork(gomock.Any(), network, gomock.Any()).Return([]netmanager.Drift{
+						{Kind: netmanager.DriftLink, Description: "bridge br0 is missing"},
+					}, nil),
+					m.EXPECT().Ensure(gomock.Any(), network).Return(nil),
+					m.EXPECT().CheckNetwork(gomock.Any(), network, gomock.Any()).Return([]netmanager.Drift{
+						{Kind: netmanager.DriftLink, EndpointID: "ep-1", Description: "overlay veth sand0001 is missing"},
+						{Kind: netmanager.DriftAddress, EndpointID: "ep-1", Description: "address 10.0.0.2/24 is missing"},
+					}, nil),
+				)
+			},
+			ExpectEndpoints: func(r *endpointmock.MockRepository) {
+				r.EXPECT().Repair(gomock.Any(), network, "ep-1").Return(nil)
+			},
+			Drifts:  map[netmanager.DriftKind]int64{netmanager.DriftLink: 2, netmanager.DriftAddress: 1},
+			Repairs: 2,
+		}, {
+			Name: "it should ensure the neighbors of the network when they drifted",
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().CheckNetwork(gomock.Any(), network, gomock.Any()).Return([]netmanager.Drift{
+					{Kind: netmanager.DriftNeighbor, Description: "neighbor 10.0.0.3 is missing"},
+					{Kind: netmanager.DriftNeighbor, Description: "neighbor 10.0.0.4 is stale"},
+				}, nil)
+				m.EXPECT().EnsureEndpointsNeigh(gomock.Any(), network, []types.Endpoint{local, remote}).Return(nil)
+			},
+			Drifts:  map[netmanager.DriftKind]int64{netmanager.DriftNeighbor: 2},
+			Repairs: 1,
+		}, {
+			Name: "it should count the failed endpoint repairs",
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().CheckNetwork(gomock.Any(), network, gomock.Any()).Return([]netmanager.Drift{
+					{Kind: netmanager.DriftLink, EndpointID: "ep-1", Description: "overlay veth sand0001 is missing"},
+				}, nil)
+			},
+			ExpectEndpoints: func(r *endpointmock.MockRepository) {
+				r.EXPECT().Repair(gomock.Any(), network, "ep-1").Return(errors.New("netlink error"))
+			},
+			Drifts:         map[netmanager.DriftKind]int64{netmanager.DriftLink: 1},
+			RepairFailures: 1,
+		}, {
+			Name: "it should count the failed repairs",
+			ExpectNetManager: func(m *netmanagermock.MockNetManager) {
+				m.EXPECT().CheckNetwork(gomock.Any(), network, gomock.Any()).Return([]netmanager.Drift{
+					{Kind: netmanager.DriftLink, Description: "VxLAN interface vxlan0 is missing"},
+				}, nil)
+				m.EXPECT().Ensure(gomock.Any(), network).Return(errors.New("netlink error"))
+			},
+			Drifts:         map[netmanager.DriftKind]int64{netmanager.DriftLink: 1},
+			RepairFailures: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			nm := netmanagermock.NewMockNetManager(ctrl)
+			networks := networkmock.NewMockRepository(ctrl)
+			endpoints := endpointmock.NewMockRepository(ctrl)
+			managers := netmanager.NewManagerMap()
+			managers.Set(types.OverlayNetworkType, nm)
+
+			endpoints.EXPECT().List(gomock.Any(), map[string]string{"hostname": "node-1"}).Return([]types.Endpoint{local}, nil)
+			endpoints.EXPECT().List(gomock.Any(), map[string]string{"network_id": "net-1"}).Return([]types.Endpoint{local, remote}, nil)
+			networks.EXPECT().Exists(gomock.Any(), "net-1").Return(network, true, nil)
+			tc.ExpectNetManager(nm)
+			if tc.ExpectEndpoints != nil {
+				tc.ExpectEndpoints(endpoints)
+			}
+
+			r := New(c, networks, endpoints, managers)
+			err := r.Reconcile(context.Background())
+			require.NoError(t, err)
+
+			metrics := r.Metrics()
+			assert.Equal(t, int64(1), metrics.Runs)
+			assert.Equal(t, tc.Drifts, metrics.Drifts)
+			assert.Equal(t, tc.Repairs, metrics.Repairs)
+			assert.Equal(t, tc.RepairFailures, metrics.RepairFailures)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/integrations/docker"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/migrations"
+	"github.com/Scalingo/sand/store"
+)
+
+// The storage key of an item without ID is the prefix of its collection
+var (
+	networksPrefix        = types.Network{}.StorageKey()
+	dockerNetworksPrefix  = docker.DockerPluginNetwork{}.StorageKey()
+	dockerEndpointsPrefix = docker.DockerPluginEndpoint{}.StorageKey()
+)
+
+func (r *repository) Export(ctx context.Context) (types.State, error) {
+	schemaVersion, err := migrations.CurrentVersion(ctx, r.store)
+	if err != nil {
+		return types.State{}, errors.Wrapf(err, "fail to get schema version")
+	}
+	state := types.State{
+		FormatVersion: types.StateFormatVersion,
+		SchemaVersion: schemaVersion,
+		ExportedAt:    time.Now(),
+	}
+
+	collections := []struct {
+		prefix string
+		data   interface{}
+	}{
+		{networksPrefix, &state.Networks},
+		{types.EndpointStoragePrefix + "/", &state.Endpoints},
+		{ipallocator.IPAllocatorPrefix + "/", &state.IPAllocations},
+		{dockerNetworksPrefix, &state.DockerNetworks},
+		{dockerEndpointsPrefix, &state.DockerEndpoints},
+	}
+	for _, collection := range collections {
+		err := r.store.Get(ctx, collection.prefix, true, collection.data)
+		if err != nil && err != store.ErrNotFound {
+			return types.State{}, errors.Wrapf(err, "fail to list %v", collection.prefix)
+		}
+	}
+
+	// Keys are returned sorted by the store but the document should not depend
+	// on how they are built
+	sort.Slice(state.Networks, func(i, j int) bool { return state.Networks[i].ID < state.Networks[j].ID })
+	sort.Slice(state.Endpoints, func(i, j int) bool { return state.Endpoints[i].ID < state.Endpoints[j].ID })
+	sort.Slice(state.IPAllocations, func(i, j int) bool { return state.IPAllocations[i].ID < state.IPAllocations[j].ID })
+	sort.Slice(state.DockerNetworks, func(i, j int) bool {
+		return state.DockerNetworks[i].DockerNetworkID < state.DockerNetworks[j].DockerNetworkID
+	})
+	sort.Slice(state.DockerEndpoints, func(i, j int) bool {
+		return state.DockerEndpoints[i].DockerEndpointID < state.DockerEndpoints[j].DockerEndpointID
+	})
+	return state, nil
+}
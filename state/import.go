@@ -0,0 +1,321 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bits-and-blooms/bitset"
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/idmanager"
+	"github.com/Scalingo/sand/integrations/docker"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/migrations"
+	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
+)
+
+// importChunkSize is the number of keys created by each transaction of an
+// import, the --max-txn-ops limit of etcd is 128 by default and a transaction
+// may also allocate VNIs
+const importChunkSize = 100
+
+// item is a piece of the state written in one or several keys of the store
+type item struct {
+	keys  []string
+	value interface{}
+}
+
+func (r *repository) Import(ctx context.Context, state types.State, dryRun bool) (types.StateImportReport, error) {
+	log := logger.Get(ctx)
+	report := types.StateImportReport{
+		DryRun: dryRun, Created: []string{}, Unchanged: []string{}, Conflicts: []types.StateConflict{},
+	}
+
+	if state.FormatVersion != types.StateFormatVersion {
+		return report, errors.Errorf("unsupported state format version %d, expected %d", state.FormatVersion, types.StateFormatVersion)
+	}
+	schemaVersion, err := migrations.CurrentVersion(ctx, r.store)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to get schema version")
+	}
+	if state.SchemaVersion != schemaVersion {
+		return report, errors.Errorf("state schema version %d is different from the store one %d", state.SchemaVersion, schemaVersion)
+	}
+
+	report.Conflicts, err = r.validate(ctx, state)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to validate state")
+	}
+
+	items := stateItems(state)
+	// Keys which don't exist yet, by item
+	created := make([][]string, len(items))
+	for i, item := range items {
+		for _, key := range item.keys {
+			// Decoded as interface{}, a json.RawMessage would be taken for a
+			// recursive read by the store
+			var stored interface{}
+			_, err := r.store.GetModRevision(ctx, key, &stored)
+			if err == store.ErrNotFound {
+				created[i] = append(created[i], key)
+				report.Created = append(report.Created, key)
+				continue
+			}
+			if err != nil {
+				return report, errors.Wrapf(err, "fail to get %v", key)
+			}
+
+			equal, err := jsonEqual(stored, item.value)
+			if err != nil {
+				return report, errors.Wrapf(err, "fail to compare %v", key)
+			}
+			if equal {
+				report.Unchanged = append(report.Unchanged, key)
+			} else {
+				report.Conflicts = append(report.Conflicts, types.StateConflict{
+					Key: key, Reason: "a different value is already stored",
+				})
+			}
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if len(report.Conflicts) > 0 {
+		return report, ErrConflict
+	}
+
+	// The keys are created in chunks which fit in the --max-txn-ops limit of
+	// etcd, each of them with the allocation of the VNIs of its networks.
+	// Nothing is written by a chunk if one of its keys has been created or if
+	// the allocated VNIs have been modified during the import.
+	writes := createdWrites(state, items, created)
+	for start := 0; start < len(writes); start += importChunkSize {
+		end := start + importChunkSize
+		if end > len(writes) {
+			end = len(writes)
+		}
+		err := r.writeChunk(ctx, writes[start:end])
+		if err != nil {
+			report.Created = report.Created[:start]
+			if err == store.ErrTxnConflict {
+				err = errors.New("keys have been written during the import")
+			}
+			return report, errors.Wrapf(err, "fail to import keys, %d of %d keys imported, importing the state again creates the remaining ones", start, len(writes))
+		}
+	}
+	log.WithField("keys_count", len(report.Created)).Info("state imported")
+	return report, nil
+}
+
+// write is a key created by the import, vni is the VNI to allocate with a
+// network key
+type write struct {
+	key   string
+	value interface{}
+	vni   int
+}
+
+// createdWrites lists the keys which are created in the order of the items,
+// the networks are the first items of the state
+func createdWrites(state types.State, items []item, created [][]string) []write {
+	var writes []write
+	for i, item := range items {
+		for _, key := range created[i] {
+			w := write{key: key, value: item.value}
+			if i < len(state.Networks) {
+				w.vni = state.Networks[i].VxLANVNI
+			}
+			writes = append(writes, w)
+		}
+	}
+	return writes
+}
+
+// writeChunk creates the keys in a single transaction with the allocation of
+// the VNIs of the networks among them
+func (r *repository) writeChunk(ctx context.Context, writes []write) error {
+	cmps := make([]store.Compare, 0, len(writes)+1)
+	ops := make([]store.Op, 0, len(writes)+1)
+	var vnis []int
+	for _, w := range writes {
+		cmps = append(cmps, store.CompareModRevision(w.key, 0))
+		ops = append(ops, store.OpSet(w.key, w.value))
+		if w.vni != 0 {
+			vnis = append(vnis, w.vni)
+		}
+	}
+	if len(vnis) > 0 {
+		cmp, op, err := overlay.NewVNIGenerator(r.config, r.store).ReserveTxn(ctx, vnis...)
+		if err != nil {
+			return errors.Wrapf(err, "fail to allocate VNIs %v", vnis)
+		}
+		cmps = append(cmps, cmp)
+		ops = append(ops, op)
+	}
+	return r.store.Txn(ctx, cmps, ops...)
+}
+
+// stateItems lists the keys written for each part of the state, endpoints
+// are indexed by node and by network
+func stateItems(state types.State) []item {
+	var items []item
+	for _, network := range state.Networks {
+		items = append(items, item{keys: []string{network.StorageKey()}, value: network})
+	}
+	for _, endpoint := range state.Endpoints {
+		items = append(items, item{keys: []string{endpoint.StorageKey(), endpoint.NetworkStorageKey()}, value: endpoint})
+	}
+	for _, allocation := range state.IPAllocations {
+		key := fmt.Sprintf("%s/%s", ipallocator.IPAllocatorPrefix, allocation.ID)
+		items = append(items, item{keys: []string{key}, value: allocation})
+	}
+	for _, binding := range state.DockerNetworks {
+		n := docker.DockerPluginNetwork{DockerNetworkID: binding.DockerNetworkID, SandNetworkID: binding.SandNetworkID}
+		items = append(items, item{keys: []string{n.StorageKey()}, value: n})
+	}
+	for _, binding := range state.DockerEndpoints {
+		e := docker.DockerPluginEndpoint{
+			DockerPluginNetwork: docker.DockerPluginNetwork{
+				DockerNetworkID: binding.DockerNetworkID, SandNetworkID: binding.SandNetworkID,
+			},
+			DockerEndpointID: binding.DockerEndpointID,
+			SandEndpointID:   binding.SandEndpointID,
+		}
+		items = append(items, item{keys: []string{e.StorageKey()}, value: e})
+	}
+	return items
+}
+
+// validate checks the consistency of the state and with the networks of the
+// store, problems are reported as conflicts
+func (r *repository) validate(ctx context.Context, state types.State) ([]types.StateConflict, error) {
+	conflicts := []types.StateConflict{}
+	conflict := func(key string, format string, args ...interface{}) {
+		conflicts = append(conflicts, types.StateConflict{Key: key, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	var storedNetworks []types.Network
+	err := r.store.Get(ctx, networksPrefix, true, &storedNetworks)
+	if err != nil && err != store.ErrNotFound {
+		return nil, errors.Wrapf(err, "fail to list networks")
+	}
+	vnis := map[int]string{}
+	stored := map[string]bool{}
+	for _, network := range storedNetworks {
+		vnis[network.VxLANVNI] = network.ID
+		stored[network.ID] = true
+	}
+	// The VNIs of the networks created are allocated, they must be free
+	var allocatedVNIs idmanager.IDs
+	err = r.store.Get(ctx, idmanager.StorageKey(overlay.IDManagerName), false, &allocatedVNIs)
+	if err != nil && err != store.ErrNotFound {
+		return nil, errors.Wrapf(err, "fail to get allocated VNIs")
+	}
+	var reservations []types.VNIReservation
+	err = r.store.Get(ctx, types.VNIReservationStoragePrefix+"/", true, &reservations)
+	if err != nil && err != store.ErrNotFound {
+		return nil, errors.Wrapf(err, "fail to list VNI reservations")
+	}
+	reservedVNIs := map[int]bool{}
+	for _, reservation := range reservations {
+		reservedVNIs[reservation.VNI] = true
+	}
+
+	networks := map[string]types.Network{}
+	for _, network := range state.Networks {
+		if _, ok := networks[network.ID]; ok {
+			conflict(network.StorageKey(), "duplicated network")
+		}
+		networks[network.ID] = network
+		if network.VxLANVNI == 0 {
+			continue
+		}
+		if network.VxLANVNI > r.config.MaxVNI {
+			conflict(network.StorageKey(), "VNI %d is greater than MAX_VNI %d", network.VxLANVNI, r.config.MaxVNI)
+		}
+		id, used := vnis[network.VxLANVNI]
+		switch {
+		case used && id != network.ID:
+			conflict(network.StorageKey(), "VNI %d is already used by network %s", network.VxLANVNI, id)
+		case stored[network.ID]:
+		case reservedVNIs[network.VxLANVNI]:
+			conflict(network.StorageKey(), "VNI %d is reserved", network.VxLANVNI)
+		case allocatedVNIs.BitSet != nil && allocatedVNIs.BitSet.Test(uint(network.VxLANVNI)):
+			conflict(network.StorageKey(), "VNI %d is already allocated", network.VxLANVNI)
+		}
+		vnis[network.VxLANVNI] = network.ID
+	}
+
+	endpoints := map[string]bool{}
+	ips := map[string]string{}
+	for _, endpoint := range state.Endpoints {
+		key := endpoint.StorageKey()
+		if endpoints[endpoint.ID] {
+			conflict(key, "duplicated endpoint")
+		}
+		endpoints[endpoint.ID] = true
+		if _, ok := networks[endpoint.NetworkID]; !ok {
+			conflict(key, "unknown network %s", endpoint.NetworkID)
+		}
+		for _, targetIP := range endpoint.TargetVethIPs() {
+			ip := endpoint.NetworkID + "/" + targetIP
+			if id, ok := ips[ip]; ok && targetIP != "" {
+				conflict(key, "IP %s is already used by endpoint %s", targetIP, id)
+			}
+			ips[ip] = endpoint.ID
+		}
+	}
+
+	for _, allocation := range state.IPAllocations {
+		key := fmt.Sprintf("%s/%s", ipallocator.IPAllocatorPrefix, allocation.ID)
+		networkID := strings.TrimSuffix(allocation.ID, types.IPv6PoolSuffix)
+		if _, ok := networks[networkID]; !ok {
+			conflict(key, "unknown network %s", networkID)
+		}
+		for _, subnet := range allocation.Subnets {
+			if len(subnet.BitSet) == 0 {
+				continue
+			}
+			var bits bitset.BitSet
+			err := json.Unmarshal(subnet.BitSet, &bits)
+			if err != nil {
+				conflict(key, "invalid bit set of %s: %v", subnet.AddressRange, err)
+			}
+		}
+	}
+
+	for _, binding := range state.DockerNetworks {
+		if _, ok := networks[binding.SandNetworkID]; !ok {
+			conflict(docker.DockerPluginNetwork{DockerNetworkID: binding.DockerNetworkID}.StorageKey(), "unknown network %s", binding.SandNetworkID)
+		}
+	}
+	for _, binding := range state.DockerEndpoints {
+		if !endpoints[binding.SandEndpointID] {
+			conflict(docker.DockerPluginEndpoint{DockerEndpointID: binding.DockerEndpointID}.StorageKey(), "unknown endpoint %s", binding.SandEndpointID)
+		}
+	}
+	return conflicts, nil
+}
+
+// jsonEqual compares a decoded value of the store with the JSON serialization
+// of value
+func jsonEqual(stored interface{}, value interface{}) (bool, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to encode value")
+	}
+	var decoded interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to decode value")
+	}
+	return reflect.DeepEqual(stored, decoded), nil
+}
@@ -0,0 +1,32 @@
+package state
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/store"
+)
+
+// ErrConflict is returned by Import when the document conflicts with the
+// content of the store, nothing has been written
+var ErrConflict = errors.New("state conflicts with the store")
+
+type Repository interface {
+	// Export reads the state of SAND from the store
+	Export(ctx context.Context) (types.State, error)
+	// Import writes the state in the store. The keys which already exist must
+	// have the same value. In dry run, nothing is written.
+	Import(ctx context.Context, state types.State, dryRun bool) (types.StateImportReport, error)
+}
+
+type repository struct {
+	config *config.Config
+	store  store.Store
+}
+
+func NewRepository(c *config.Config, s store.Store) Repository {
+	return &repository{config: c, store: s}
+}
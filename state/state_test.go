@@ -0,0 +1,209 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/idmanager"
+	"github.com/Scalingo/sand/integrations/docker"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/network/overlay"
+	"github.com/Scalingo/sand/store"
+)
+
+func TestRepository_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	network := types.Network{ID: "net-1", Name: "net", Type: types.OverlayNetworkType, VxLANVNI: 1, IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"}
+	endpoint := types.Endpoint{ID: "ep-1", NetworkID: "net-1", Hostname: "node-1", TargetVethIP: "10.0.0.2/24"}
+	dockerEndpoint := docker.DockerPluginEndpoint{
+		DockerPluginNetwork: docker.DockerPluginNetwork{DockerNetworkID: "docker-net", SandNetworkID: "net-1"},
+		DockerEndpointID:    "docker-ep", SandEndpointID: "ep-1",
+	}
+
+	// populated builds a store as filled by the agent
+	populated := func(t *testing.T) store.Store {
+		s := store.NewMemory(config)
+		require.NoError(t, s.Set(ctx, network.StorageKey(), network))
+		require.NoError(t, s.Set(ctx, endpoint.StorageKey(), endpoint))
+		require.NoError(t, s.Set(ctx, endpoint.NetworkStorageKey(), endpoint))
+		a := ipallocator.New(config, s)
+		_, err := a.AllocateIP(ctx, network.ID, ipallocator.AllocateIPOpts{AddressRange: network.IPRange, Address: "10.0.0.2"})
+		require.NoError(t, err)
+		require.NoError(t, s.Set(ctx, dockerEndpoint.DockerPluginNetwork.StorageKey(), dockerEndpoint.DockerPluginNetwork))
+		require.NoError(t, s.Set(ctx, dockerEndpoint.StorageKey(), dockerEndpoint))
+		return s
+	}
+
+	t.Run("it should export all the collections of the store", func(t *testing.T) {
+		state, err := NewRepository(config, populated(t)).Export(ctx)
+		require.NoError(t, err)
+
+		assert.Equal(t, types.StateFormatVersion, state.FormatVersion)
+		assert.Equal(t, []types.Network{network}, state.Networks)
+		assert.Equal(t, []types.Endpoint{endpoint}, state.Endpoints)
+		require.Len(t, state.IPAllocations, 1)
+		assert.Equal(t, "net-1", state.IPAllocations[0].ID)
+		assert.Equal(t, []types.DockerNetworkBinding{{DockerNetworkID: "docker-net", SandNetworkID: "net-1"}}, state.DockerNetworks)
+		require.Len(t, state.DockerEndpoints, 1)
+		assert.Equal(t, "ep-1", state.DockerEndpoints[0].SandEndpointID)
+	})
+
+	t.Run("it should restore the exported state in an empty store", func(t *testing.T) {
+		src := populated(t)
+		state, err := NewRepository(config, src).Export(ctx)
+		require.NoError(t, err)
+
+		dst := store.NewMemory(config)
+		report, err := NewRepository(config, dst).Import(ctx, state, false)
+		require.NoError(t, err)
+		assert.Len(t, report.Created, 6)
+		assert.Empty(t, report.Conflicts)
+
+		restored, err := NewRepository(config, dst).Export(ctx)
+		require.NoError(t, err)
+		restored.ExportedAt = state.ExportedAt
+		assert.Equal(t, state, restored)
+		err = overlay.NewVNIGenerator(config, dst).Reserve(ctx, network.VxLANVNI)
+		assert.Equal(t, idmanager.ErrIDUnavailable, errors.Cause(err), "the VNI of the network should be allocated")
+
+		// Importing it again changes nothing
+		report, err = NewRepository(config, dst).Import(ctx, state, false)
+		require.NoError(t, err, "%v", report.Conflicts)
+		assert.Empty(t, report.Created)
+		assert.Len(t, report.Unchanged, 6)
+	})
+
+	t.Run("it should only report the keys to create in dry run", func(t *testing.T) {
+		state, err := NewRepository(config, populated(t)).Export(ctx)
+		require.NoError(t, err)
+
+		dst := store.NewMemory(config)
+		report, err := NewRepository(config, dst).Import(ctx, state, true)
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Contains(t, report.Created, network.StorageKey())
+		assert.Equal(t, store.ErrNotFound, dst.Get(ctx, network.StorageKey(), false, &types.Network{}))
+	})
+
+	t.Run("it should not write anything if there are conflicts", func(t *testing.T) {
+		state, err := NewRepository(config, populated(t)).Export(ctx)
+		require.NoError(t, err)
+
+		dst := store.NewMemory(config)
+		other := types.Network{ID: "net-2", VxLANVNI: 1}
+		require.NoError(t, dst.Set(ctx, other.StorageKey(), other))
+		changed := endpoint
+		changed.Hostname = "node-2"
+		require.NoError(t, dst.Set(ctx, endpoint.NetworkStorageKey(), changed))
+		state.DockerEndpoints[0].SandEndpointID = "unknown"
+
+		report, err := NewRepository(config, dst).Import(ctx, state, false)
+		assert.Equal(t, ErrConflict, err)
+		assert.ElementsMatch(t, []types.StateConflict{
+			{Key: network.StorageKey(), Reason: "VNI 1 is already used by network net-2"},
+			{Key: dockerEndpoint.StorageKey(), Reason: "unknown endpoint unknown"},
+			{Key: endpoint.NetworkStorageKey(), Reason: "a different value is already stored"},
+		}, report.Conflicts)
+		assert.Equal(t, store.ErrNotFound, dst.Get(ctx, network.StorageKey(), false, &types.Network{}))
+	})
+
+	t.Run("it should report the VNIs already allocated or reserved", func(t *testing.T) {
+		state, err := NewRepository(config, populated(t)).Export(ctx)
+		require.NoError(t, err)
+		reserved := types.Network{ID: "net-2", Type: types.OverlayNetworkType, VxLANVNI: 2}
+		state.Networks = append(state.Networks, reserved)
+
+		dst := store.NewMemory(config)
+		vniGen := overlay.NewVNIGenerator(config, dst)
+		require.NoError(t, vniGen.Reserve(ctx, 1))
+		reservation := types.VNIReservation{VNI: 2}
+		require.NoError(t, vniGen.Reserve(ctx, 2, store.OpSet(reservation.StorageKey(), &reservation)))
+
+		report, err := NewRepository(config, dst).Import(ctx, state, false)
+		assert.Equal(t, ErrConflict, err)
+		assert.ElementsMatch(t, []types.StateConflict{
+			{Key: network.StorageKey(), Reason: "VNI 1 is already allocated"},
+			{Key: reserved.StorageKey(), Reason: "VNI 2 is reserved"},
+		}, report.Conflicts)
+	})
+
+	// largeState is an exported state of 203 keys, 100 endpoints are indexed
+	// by node and by network
+	largeState := func(t *testing.T) types.State {
+		state, err := NewRepository(config, populated(t)).Export(ctx)
+		require.NoError(t, err)
+		state.Endpoints = nil
+		state.DockerEndpoints = nil
+		for i := 0; i < 100; i++ {
+			e := types.Endpoint{ID: fmt.Sprintf("ep-%d", i), NetworkID: network.ID, Hostname: "node-1"}
+			state.Endpoints = append(state.Endpoints, e)
+		}
+		return state
+	}
+
+	t.Run("it should import more keys than the etcd transaction limit in several transactions", func(t *testing.T) {
+		state := largeState(t)
+
+		dst := &limitedStore{Store: store.NewMemory(config)}
+		report, err := NewRepository(config, dst).Import(ctx, state, false)
+		require.NoError(t, err)
+		assert.Len(t, report.Created, 203)
+		assert.Equal(t, 3, dst.txns)
+		err = overlay.NewVNIGenerator(config, dst).Reserve(ctx, network.VxLANVNI)
+		assert.Equal(t, idmanager.ErrIDUnavailable, errors.Cause(err), "the VNI of the network should be allocated")
+	})
+
+	t.Run("it should report the keys imported before a failure and import the others again", func(t *testing.T) {
+		state := largeState(t)
+
+		dst := &limitedStore{Store: store.NewMemory(config), failAt: 2}
+		report, err := NewRepository(config, dst).Import(ctx, state, false)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "100 of 203 keys imported")
+		assert.Len(t, report.Created, 100)
+		assert.Contains(t, report.Created, network.StorageKey())
+
+		report, err = NewRepository(config, dst.Store).Import(ctx, state, false)
+		require.NoError(t, err, "%v", report.Conflicts)
+		assert.Len(t, report.Created, 103)
+		assert.Len(t, report.Unchanged, 100)
+	})
+
+	t.Run("it should refuse a state of another schema version", func(t *testing.T) {
+		state, err := NewRepository(config, populated(t)).Export(ctx)
+		require.NoError(t, err)
+		state.SchemaVersion++
+
+		_, err = NewRepository(config, store.NewMemory(config)).Import(ctx, state, true)
+		require.Error(t, err)
+	})
+}
+
+// limitedStore rejects the transactions above the default --max-txn-ops
+// limit of etcd and fails the failAt-th transaction if set
+type limitedStore struct {
+	store.Store
+	txns   int
+	failAt int
+}
+
+func (s *limitedStore) Txn(ctx context.Context, cmps []store.Compare, ops ...store.Op) error {
+	if len(cmps) > 128 || len(ops) > 128 {
+		return errors.New("etcdserver: too many operations in txn request")
+	}
+	s.txns++
+	if s.txns == s.failAt {
+		return errors.New("etcd unavailable")
+	}
+	return s.Store.Txn(ctx, cmps, ops...)
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	EtcdBackend   = "etcd"
+	MemoryBackend = "memory"
+	FileBackend   = "file"
+)
+
+// NewBackend returns the Store implementation selected in the configuration,
+// the etcd client is only used by the etcd backend.
+func NewBackend(c *config.Config, client *clientv3.Client) (Store, error) {
+	switch c.StoreBackend {
+	case "", EtcdBackend:
+		if client == nil {
+			return nil, errors.New("etcd client is required by the etcd backend")
+		}
+		return New(c, client), nil
+	case MemoryBackend:
+		return NewMemory(c), nil
+	case FileBackend:
+		s, err := NewFile(c, c.StoreFilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to open file store")
+		}
+		return s, nil
+	default:
+		return nil, errors.Errorf("unknown store backend '%v'", c.StoreBackend)
+	}
+}
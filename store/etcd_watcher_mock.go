@@ -12,7 +12,7 @@ package store
 import (
 	reflect "reflect"
 
-	v3 "go.etcd.io/etcd/client/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -54,16 +54,16 @@ func (mr *MockEtcdWatcherMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockEtcdWatcher)(nil).Close))
 }
 
-// WatchChan mocks base method.
-func (m *MockEtcdWatcher) WatchChan() v3.WatchChan {
+// Watch mocks base method.
+func (m *MockEtcdWatcher) Watch(rev int64) clientv3.WatchChan {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "WatchChan")
-	ret0, _ := ret[0].(v3.WatchChan)
+	ret := m.ctrl.Call(m, "Watch", rev)
+	ret0, _ := ret[0].(clientv3.WatchChan)
 	return ret0
 }
 
-// WatchChan indicates an expected call of WatchChan.
-func (mr *MockEtcdWatcherMockRecorder) WatchChan() *gomock.Call {
+// Watch indicates an expected call of Watch.
+func (mr *MockEtcdWatcherMockRecorder) Watch(rev any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchChan", reflect.TypeOf((*MockEtcdWatcher)(nil).WatchChan))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Watch", reflect.TypeOf((*MockEtcdWatcher)(nil).Watch), rev)
 }
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"golang.org/x/sys/unix"
+
+	"github.com/Scalingo/sand/config"
+	"github.com/pkg/errors"
+)
+
+// fileStore is a memory store whose content is written in a single file after
+// each modification. It is designed for single-node deployments where running
+// an etcd cluster is not worth it.
+type fileStore struct {
+	*memoryStore
+	path string
+	lock *os.File
+}
+
+type fileSnapshot struct {
+	Revision int64    `json:"revision"`
+	KVs      []fileKV `json:"kvs"`
+}
+
+type fileKV struct {
+	Key            string          `json:"key"`
+	Value          json.RawMessage `json:"value"`
+	CreateRevision int64           `json:"create_revision"`
+	ModRevision    int64           `json:"mod_revision"`
+	Version        int64           `json:"version"`
+}
+
+func NewFile(c *config.Config, path string) (*fileStore, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create directory of %v", path)
+	}
+
+	// The file is only meant to be used by a single agent at a time
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open lock file of %v", path)
+	}
+	err = unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err != nil {
+		lock.Close()
+		return nil, errors.Wrapf(err, "store file %v is already used by another process", path)
+	}
+
+	s := &fileStore{memoryStore: NewMemory(c), path: path, lock: lock}
+	err = s.load()
+	if err != nil {
+		s.Close()
+		return nil, errors.Wrapf(err, "fail to load store from %v", path)
+	}
+	s.memoryStore.persist = s.save
+	return s, nil
+}
+
+func (s *fileStore) load() error {
+	fd, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to open store file")
+	}
+	defer fd.Close()
+
+	var snapshot fileSnapshot
+	err = json.NewDecoder(fd).Decode(&snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "fail to decode store file")
+	}
+
+	s.revision = snapshot.Revision
+	// History is not persisted, previous revisions are not available anymore
+	s.compactRevision = snapshot.Revision
+	for _, kv := range snapshot.KVs {
+		s.kvs[kv.Key] = &mvccpb.KeyValue{
+			Key:            []byte(kv.Key),
+			Value:          kv.Value,
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+		}
+	}
+	return nil
+}
+
+// save writes the whole content of the store in a temporary file which
+// replaces the previous one, so the file is never partially written. It is
+// called with the lock of the memory store held.
+func (s *fileStore) save() error {
+	snapshot := fileSnapshot{Revision: s.revision, KVs: make([]fileKV, 0, len(s.kvs))}
+	for _, kv := range s.kvs {
+		snapshot.KVs = append(snapshot.KVs, fileKV{
+			Key:            string(kv.Key),
+			Value:          kv.Value,
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+		})
+	}
+
+	tmpPath := s.path + ".tmp"
+	fd, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "fail to open %v", tmpPath)
+	}
+	err = json.NewEncoder(fd).Encode(&snapshot)
+	if err != nil {
+		fd.Close()
+		return errors.Wrapf(err, "fail to encode store snapshot")
+	}
+	err = fd.Sync()
+	if err != nil {
+		fd.Close()
+		return errors.Wrapf(err, "fail to sync %v", tmpPath)
+	}
+	err = fd.Close()
+	if err != nil {
+		return errors.Wrapf(err, "fail to close %v", tmpPath)
+	}
+
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return errors.Wrapf(err, "fail to replace %v", s.path)
+	}
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	err := s.lock.Close()
+	if err != nil {
+		return errors.Wrapf(err, "fail to release lock of %v", s.path)
+	}
+	return nil
+}
@@ -0,0 +1,468 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// memoryHistoryLimit is the number of events kept to answer requests on
+	// past revisions. Older events are compacted.
+	memoryHistoryLimit = 10000
+)
+
+// memoryStore is a Store keeping all its keys in memory. As etcd, it
+// maintains a global revision incremented at each modification and keeps the
+// history of the recent modifications to be able to read a key at a previous
+// revision and to stream the modifications to watchers.
+type memoryStore struct {
+	config *config.Config
+	m      *sync.Mutex
+
+	revision        int64
+	compactRevision int64
+	kvs             map[string]*mvccpb.KeyValue
+	// history contains the events since compactRevision, ordered by revision.
+	// Each event carries the previous version of the key in PrevKv.
+	history  []*clientv3.Event
+	watchers map[*memoryWatcher]struct{}
+
+	// persist is called after each modification with the lock held, if it
+	// returns an error, the modification is reverted.
+	persist func() error
+}
+
+func NewMemory(c *config.Config) *memoryStore {
+	return &memoryStore{
+		config:   c,
+		m:        &sync.Mutex{},
+		kvs:      make(map[string]*mvccpb.KeyValue),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string, recursive bool, data interface{}) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.get(ctx, key, s.revision, recursive, data)
+}
+
+func (s *memoryStore) GetWithRevision(ctx context.Context, key string, rev int64, recursive bool, data interface{}) error {
+	ctx = logger.ToCtx(ctx, logger.Get(ctx).WithField("rev", rev))
+	s.m.Lock()
+	defer s.m.Unlock()
+	if rev > s.revision {
+		return errors.Wrapf(rpctypes.ErrFutureRev, "fail to read key %v", key)
+	}
+	if rev < s.compactRevision {
+		return errors.Wrapf(rpctypes.ErrCompacted, "fail to read key %v", key)
+	}
+	return s.get(ctx, key, rev, recursive, data)
+}
+
+func (s *memoryStore) get(ctx context.Context, key string, rev int64, recursive bool, data interface{}) error {
+	log := logger.Get(ctx).WithField("scope", "store")
+	key = prefixedKey(s.config, key)
+
+	var keys []string
+	if recursive {
+		keys = s.keysWithPrefixAt(key, rev)
+	} else {
+		keys = []string{key}
+	}
+
+	values := [][]byte{}
+	for _, k := range keys {
+		kv := s.valueAt(k, rev)
+		if kv != nil {
+			values = append(values, kv.Value)
+		}
+	}
+	log.WithFields(logrus.Fields{"key": key, "nodes": len(values)}).Debug("get key")
+
+	if len(values) == 0 {
+		return ErrNotFound
+	}
+	return decodeValues(values, data)
+}
+
+// keysWithPrefixAt returns the sorted list of the keys starting with prefix
+// which may have existed at revision rev
+func (s *memoryStore) keysWithPrefixAt(prefix string, rev int64) []string {
+	keys := map[string]bool{}
+	for k := range s.kvs {
+		if strings.HasPrefix(k, prefix) {
+			keys[k] = true
+		}
+	}
+	for _, event := range s.history {
+		if event.Kv.ModRevision > rev && strings.HasPrefix(string(event.Kv.Key), prefix) {
+			keys[string(event.Kv.Key)] = true
+		}
+	}
+
+	res := make([]string, 0, len(keys))
+	for k := range keys {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// valueAt returns the version of key at revision rev, nil if the key was not
+// existing. The first modification of the key after rev contains the value
+// we're looking for, if there is none, the current value is the right one.
+func (s *memoryStore) valueAt(key string, rev int64) *mvccpb.KeyValue {
+	for _, event := range s.history {
+		if event.Kv.ModRevision > rev && string(event.Kv.Key) == key {
+			return event.PrevKv
+		}
+	}
+	return s.kvs[key]
+}
+
+func (s *memoryStore) GetModRevision(ctx context.Context, key string, data interface{}) (int64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	err := s.get(ctx, key, s.revision, false, data)
+	if err != nil {
+		return 0, err
+	}
+	return s.kvs[prefixedKey(s.config, key)].ModRevision, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, data interface{}) error {
+	log := logger.Get(ctx).WithField("scope", "store")
+	key = prefixedKey(s.config, key)
+
+	out, err := json.Marshal(&data)
+	if err != nil {
+		return errors.Wrapf(err, "fail to encode to JSON")
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.revision++
+	s.put(key, out)
+	err = s.commit()
+	if err != nil {
+		return errors.Wrapf(err, "fail to put key %v", key)
+	}
+
+	log.WithFields(logrus.Fields{"key": key}).Debug("put key")
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	log := logger.Get(ctx).WithField("scope", "store")
+	key = prefixedKey(s.config, key)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.kvs[key]; !ok {
+		return nil
+	}
+
+	s.revision++
+	s.delete(key)
+	err := s.commit()
+	if err != nil {
+		return errors.Wrapf(err, "fail to delete key %v", key)
+	}
+
+	log.WithFields(logrus.Fields{"key": key}).Debug("delete key")
+	return nil
+}
+
+func (s *memoryStore) Txn(ctx context.Context, cmps []Compare, ops ...Op) error {
+	log := logger.Get(ctx).WithField("scope", "store")
+
+	values := make([][]byte, len(ops))
+	keys := make([]string, 0, len(ops))
+	for i, op := range ops {
+		key := prefixedKey(s.config, op.Key)
+		keys = append(keys, key)
+		switch op.Type {
+		case OpTypeSet:
+			out, err := json.Marshal(&op.Data)
+			if err != nil {
+				return errors.Wrapf(err, "fail to encode %v to JSON", key)
+			}
+			values[i] = out
+		case OpTypeDelete:
+		default:
+			return errors.Errorf("unknown operation type %v on %v", op.Type, key)
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, cmp := range cmps {
+		var modRevision int64
+		if kv, ok := s.kvs[prefixedKey(s.config, cmp.Key)]; ok {
+			modRevision = kv.ModRevision
+		}
+		if modRevision != cmp.ModRevision {
+			return ErrTxnConflict
+		}
+	}
+
+	s.revision++
+	written := false
+	for i, op := range ops {
+		switch op.Type {
+		case OpTypeSet:
+			s.put(keys[i], values[i])
+			written = true
+		case OpTypeDelete:
+			if _, ok := s.kvs[keys[i]]; ok {
+				s.delete(keys[i])
+				written = true
+			}
+		}
+	}
+	// As etcd, a transaction without any modification doesn't create a revision
+	if !written {
+		s.revision--
+		return nil
+	}
+
+	err := s.commit()
+	if err != nil {
+		return errors.Wrapf(err, "fail to commit transaction on %v", keys)
+	}
+
+	log.WithFields(logrus.Fields{"keys": keys}).Debug("commit transaction")
+	return nil
+}
+
+// put writes key at the current revision, the lock should be held
+func (s *memoryStore) put(key string, value []byte) {
+	prev := s.kvs[key]
+	kv := &mvccpb.KeyValue{
+		Key:            []byte(key),
+		Value:          value,
+		CreateRevision: s.revision,
+		ModRevision:    s.revision,
+		Version:        1,
+	}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+	}
+	s.kvs[key] = kv
+	s.history = append(s.history, &clientv3.Event{Type: mvccpb.PUT, Kv: kv, PrevKv: prev})
+}
+
+// delete removes key at the current revision, the lock should be held
+func (s *memoryStore) delete(key string) {
+	prev := s.kvs[key]
+	delete(s.kvs, key)
+	s.history = append(s.history, &clientv3.Event{
+		Type:   mvccpb.DELETE,
+		Kv:     &mvccpb.KeyValue{Key: []byte(key), ModRevision: s.revision},
+		PrevKv: prev,
+	})
+}
+
+// commit persists the modifications done at the current revision and
+// notifies the watchers. If the persistence fails, modifications are reverted.
+// The lock should be held.
+func (s *memoryStore) commit() error {
+	events := s.eventsSince(s.revision - 1)
+	if s.persist != nil {
+		err := s.persist()
+		if err != nil {
+			s.revert(events)
+			return errors.Wrap(err, "fail to persist store")
+		}
+	}
+
+	for w := range s.watchers {
+		w.notify(s.revision, events)
+	}
+
+	if len(s.history) > memoryHistoryLimit {
+		compacted := s.history[:len(s.history)-memoryHistoryLimit/2]
+		s.compactRevision = compacted[len(compacted)-1].Kv.ModRevision
+		s.history = append([]*clientv3.Event{}, s.history[len(compacted):]...)
+	}
+	return nil
+}
+
+// revert cancels the modifications from events which are the last ones of
+// the history
+func (s *memoryStore) revert(events []*clientv3.Event) {
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if event.PrevKv == nil {
+			delete(s.kvs, string(event.Kv.Key))
+		} else {
+			s.kvs[string(event.Kv.Key)] = event.PrevKv
+		}
+	}
+	s.history = s.history[:len(s.history)-len(events)]
+	s.revision--
+}
+
+// eventsSince returns the events which happened after revision rev
+func (s *memoryStore) eventsSince(rev int64) []*clientv3.Event {
+	i := sort.Search(len(s.history), func(i int) bool {
+		return s.history[i].Kv.ModRevision > rev
+	})
+	return s.history[i:]
+}
+
+// NewEtcdWatcher streams the modifications of the keys starting with prefix,
+// it lets Watcher work on top of a memory store without etcd cluster.
+func (s *memoryStore) NewEtcdWatcher(prefix string) (EtcdWatcher, error) {
+	return newMemoryWatcher(s, prefix), nil
+}
+
+func (s *memoryStore) removeWatcher(w *memoryWatcher) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.watchers, w)
+}
+
+type memoryWatcher struct {
+	store  *memoryStore
+	prefix string
+
+	m       *sync.Mutex
+	pending []clientv3.WatchResponse
+	wakeup  chan struct{}
+	done    chan struct{}
+	out     chan clientv3.WatchResponse
+}
+
+func newMemoryWatcher(s *memoryStore, prefix string) *memoryWatcher {
+	w := &memoryWatcher{
+		store:  s,
+		prefix: prefix,
+		m:      &sync.Mutex{},
+		wakeup: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan clientv3.WatchResponse),
+	}
+	go w.forward()
+	return w
+}
+
+// Watch starts streaming the modifications from revision rev, the events
+// which already happened are replayed from the history of the store. The
+// channel is the same for all calls, events queued by a previous call are
+// replaced.
+func (w *memoryWatcher) Watch(rev int64) clientv3.WatchChan {
+	w.store.m.Lock()
+	defer w.store.m.Unlock()
+
+	select {
+	case <-w.done:
+		return w.out
+	default:
+	}
+
+	w.m.Lock()
+	w.pending = nil
+	w.m.Unlock()
+
+	if rev == 0 {
+		w.queue(clientv3.WatchResponse{
+			Header:  etcdserverpb.ResponseHeader{Revision: w.store.revision},
+			Created: true,
+		})
+	} else if rev <= w.store.compactRevision {
+		w.queue(clientv3.WatchResponse{
+			Header:          etcdserverpb.ResponseHeader{Revision: w.store.revision},
+			CompactRevision: w.store.compactRevision + 1,
+			Canceled:        true,
+		})
+	} else {
+		events := w.store.eventsSince(rev - 1)
+		for len(events) > 0 {
+			n := 1
+			for n < len(events) && events[n].Kv.ModRevision == events[0].Kv.ModRevision {
+				n++
+			}
+			w.notify(events[0].Kv.ModRevision, events[:n])
+			events = events[n:]
+		}
+	}
+
+	w.store.watchers[w] = struct{}{}
+	return w.out
+}
+
+// notify is called by the store with its lock held, it must not block, the
+// events are queued and sent by the forward goroutine
+func (w *memoryWatcher) notify(rev int64, events []*clientv3.Event) {
+	res := clientv3.WatchResponse{Header: etcdserverpb.ResponseHeader{Revision: rev}}
+	for _, event := range events {
+		if !strings.HasPrefix(string(event.Kv.Key), w.prefix) {
+			continue
+		}
+		// As etcd, the previous value is only sent when explicitly requested
+		res.Events = append(res.Events, &clientv3.Event{Type: event.Type, Kv: event.Kv})
+	}
+	if len(res.Events) == 0 {
+		return
+	}
+	w.queue(res)
+}
+
+func (w *memoryWatcher) queue(res clientv3.WatchResponse) {
+	w.m.Lock()
+	w.pending = append(w.pending, res)
+	w.m.Unlock()
+	select {
+	case w.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) forward() {
+	defer close(w.out)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wakeup:
+		}
+
+		w.m.Lock()
+		pending := w.pending
+		w.pending = nil
+		w.m.Unlock()
+
+		for _, res := range pending {
+			select {
+			case <-w.done:
+				return
+			case w.out <- res:
+			}
+		}
+	}
+}
+
+func (w *memoryWatcher) Close() error {
+	close(w.done)
+	w.store.removeWatcher(w)
+	return nil
+}
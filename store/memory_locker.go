@@ -0,0 +1,84 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Scalingo/go-etcd-lock/v5/lock"
+)
+
+const (
+	memoryLockerCooldown   = 100 * time.Millisecond
+	memoryLockerMaxTimeout = 2 * time.Minute
+)
+
+// memoryLocker is a lock.Locker local to the process, it is used with the
+// memory and file backends, where a single agent is accessing the store.
+type memoryLocker struct {
+	m     *sync.Mutex
+	locks map[string]*memoryLock
+}
+
+type memoryLock struct {
+	locker *memoryLocker
+	key    string
+	timer  *time.Timer
+	once   *sync.Once
+}
+
+func NewMemoryLocker() lock.Locker {
+	return &memoryLocker{m: &sync.Mutex{}, locks: make(map[string]*memoryLock)}
+}
+
+func (l *memoryLocker) Acquire(key string, ttl int) (lock.Lock, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if _, ok := l.locks[key]; ok {
+		return nil, &lock.ErrAlreadyLocked{}
+	}
+
+	ml := &memoryLock{locker: l, key: key, once: &sync.Once{}}
+	// As with etcd, the lock is released automatically after its TTL
+	ml.timer = time.AfterFunc(time.Duration(ttl)*time.Second, func() {
+		ml.Release()
+	})
+	l.locks[key] = ml
+	return ml, nil
+}
+
+func (l *memoryLocker) WaitAcquire(key string, ttl int) (lock.Lock, error) {
+	timeout := time.Now().Add(memoryLockerMaxTimeout)
+	for {
+		ml, err := l.Acquire(key, ttl)
+		if _, ok := err.(*lock.ErrAlreadyLocked); ok && time.Now().Before(timeout) {
+			time.Sleep(memoryLockerCooldown)
+			continue
+		}
+		return ml, err
+	}
+}
+
+func (l *memoryLocker) Wait(key string) error {
+	for {
+		l.m.Lock()
+		_, ok := l.locks[key]
+		l.m.Unlock()
+		if !ok {
+			return nil
+		}
+		time.Sleep(memoryLockerCooldown)
+	}
+}
+
+func (ml *memoryLock) Release() error {
+	ml.once.Do(func() {
+		if ml.timer != nil {
+			ml.timer.Stop()
+		}
+		ml.locker.m.Lock()
+		defer ml.locker.m.Unlock()
+		delete(ml.locker.locks, ml.key)
+	})
+	return nil
+}
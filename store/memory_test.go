@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/Scalingo/sand/config"
+)
+
+type memoryTestItem struct {
+	ID string `json:"id"`
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	t.Run("it should get what has been set", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+
+		var item memoryTestItem
+		require.NoError(t, s.Get(ctx, "/items/1", false, &item))
+		assert.Equal(t, "1", item.ID)
+	})
+
+	t.Run("it should get all the keys with the prefix if recursive", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/2", memoryTestItem{ID: "2"}))
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+		require.NoError(t, s.Set(ctx, "/other/3", memoryTestItem{ID: "3"}))
+
+		var items []memoryTestItem
+		require.NoError(t, s.Get(ctx, "/items/", true, &items))
+		assert.Equal(t, []memoryTestItem{{ID: "1"}, {ID: "2"}}, items)
+	})
+
+	t.Run("it should return ErrNotFound for deleted keys", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+		require.NoError(t, s.Delete(ctx, "/items/1"))
+
+		var item memoryTestItem
+		assert.Equal(t, ErrNotFound, s.Get(ctx, "/items/1", false, &item))
+	})
+
+	t.Run("it should get deleted keys at a previous revision", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1bis"}))
+		require.NoError(t, s.Delete(ctx, "/items/1"))
+
+		var item memoryTestItem
+		require.NoError(t, s.GetWithRevision(ctx, "/items/1", 2, false, &item))
+		assert.Equal(t, "1bis", item.ID)
+		require.NoError(t, s.GetWithRevision(ctx, "/items/1", 1, false, &item))
+		assert.Equal(t, "1", item.ID)
+		assert.Error(t, s.GetWithRevision(ctx, "/items/1", 4, false, &item))
+	})
+
+	t.Run("it should apply all the operations of a transaction", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+
+		err := s.Txn(ctx, nil, OpSet("/items/2", memoryTestItem{ID: "2"}), OpDelete("/items/1"))
+		require.NoError(t, err)
+
+		var items []memoryTestItem
+		require.NoError(t, s.Get(ctx, "/items/", true, &items))
+		assert.Equal(t, []memoryTestItem{{ID: "2"}}, items)
+		assert.Equal(t, int64(2), s.revision)
+	})
+
+	t.Run("it should not apply a transaction if a comparison fails", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+
+		var item memoryTestItem
+		rev, err := s.GetModRevision(ctx, "/items/1", &item)
+		require.NoError(t, err)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1bis"}))
+
+		err = s.Txn(ctx, []Compare{CompareModRevision("/items/1", rev)}, OpSet("/items/1", memoryTestItem{ID: "1ter"}))
+		assert.Equal(t, ErrTxnConflict, err)
+		err = s.Txn(ctx, []Compare{CompareModRevision("/items/1", 0)}, OpSet("/items/1", memoryTestItem{ID: "1ter"}))
+		assert.Equal(t, ErrTxnConflict, err)
+
+		require.NoError(t, s.Get(ctx, "/items/1", false, &item))
+		assert.Equal(t, "1bis", item.ID)
+	})
+
+	t.Run("it should feed registrations of the watcher", func(t *testing.T) {
+		s := NewMemory(config)
+		w, err := NewWatcher(ctx, config, WithPrefix("/items"), WithEtcdWatcherBuilder(s))
+		require.NoError(t, err)
+		defer w.Close()
+
+		r, err := w.Register("/items/1")
+		require.NoError(t, err)
+
+		require.NoError(t, s.Set(ctx, "/items/1/a", memoryTestItem{ID: "a"}))
+		require.NoError(t, s.Set(ctx, "/items/2/b", memoryTestItem{ID: "b"}))
+		require.NoError(t, s.Delete(ctx, "/items/1/a"))
+
+		for _, expected := range []mvccpb.Event_EventType{mvccpb.PUT, mvccpb.DELETE} {
+			select {
+			case event := <-r.EventChan():
+				assert.Equal(t, expected, event.Type)
+				assert.Equal(t, "/sc-net/items/1/a", string(event.Kv.Key))
+			case <-time.After(time.Second):
+				require.Fail(t, "should receive an event")
+			}
+		}
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s, err := NewFile(config, path)
+	require.NoError(t, err)
+	require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+	require.NoError(t, s.Set(ctx, "/items/2", memoryTestItem{ID: "2"}))
+	require.NoError(t, s.Delete(ctx, "/items/2"))
+
+	_, err = NewFile(config, path)
+	assert.Error(t, err, "the file should be locked by the first store")
+	require.NoError(t, s.Close())
+
+	s, err = NewFile(config, path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	var items []memoryTestItem
+	require.NoError(t, s.Get(ctx, "/items/", true, &items))
+	assert.Equal(t, []memoryTestItem{{ID: "1"}}, items)
+
+	require.NoError(t, s.Set(ctx, "/items/3", memoryTestItem{ID: "3"}))
+	assert.Equal(t, int64(4), s.revision)
+}
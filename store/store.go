@@ -19,27 +19,31 @@ var ErrNotFound = errors.New("not found")
 type Store interface {
 	Get(ctx context.Context, key string, recursive bool, data interface{}) error
 	GetWithRevision(ctx context.Context, key string, rev int64, recursive bool, data interface{}) error
+	// GetModRevision gets a single key and returns the revision of its last
+	// modification, to be used in a Txn comparison
+	GetModRevision(ctx context.Context, key string, data interface{}) (int64, error)
 	Set(ctx context.Context, key string, data interface{}) error
 	Delete(ctx context.Context, key string) error
+	// Txn applies all the operations atomically if all the comparisons succeed,
+	// ErrTxnConflict is returned otherwise
+	Txn(ctx context.Context, cmps []Compare, ops ...Op) error
 }
 
 type store struct {
 	config *config.Config
+	client *clientv3.Client
 }
 
-func New(c *config.Config) Store {
-	return &store{config: c}
+// New returns a Store backed by etcd. The client is shared with the other
+// components of the agent and is not closed by the store.
+func New(c *config.Config, client *clientv3.Client) Store {
+	return &store{config: c, client: client}
 }
 
 func (s *store) get(ctx context.Context, key string, data interface{}, opts []clientv3.OpOption) error {
 	log := logger.Get(ctx).WithField("scope", "store")
 	key = prefixedKey(s.config, key)
-	c, closer, err := s.newEtcdClient()
-	if err != nil {
-		return errors.Wrap(err, "fail to build etcd client")
-	}
-	defer closer.Close()
-	res, err := c.Get(ctx, key, opts...)
+	res, err := s.client.Get(ctx, key, opts...)
 	if err != nil {
 		return errors.Wrapf(err, "fail to read key %v", key)
 	}
@@ -49,13 +53,23 @@ func (s *store) get(ctx context.Context, key string, data interface{}, opts []cl
 		return ErrNotFound
 	}
 
+	values := make([][]byte, 0, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		values = append(values, kv.Value)
+	}
+	return decodeValues(values, data)
+}
+
+// decodeValues unserializes the values read from the store in data. If data
+// is a pointer to a slice, values are gathered in a JSON array before decoding.
+func decodeValues(values [][]byte, data interface{}) error {
 	// If call is recursive, we get an array of data and build the corresponding JSON
-	content := res.Kvs[0].Value
+	content := values[0]
 	if reflect.TypeOf(data).Elem().Kind() == reflect.Slice {
 		content = []byte{'['}
-		for i, kv := range res.Kvs {
-			content = append(content, kv.Value...)
-			if i < len(res.Kvs)-1 {
+		for i, value := range values {
+			content = append(content, value...)
+			if i < len(values)-1 {
 				content = append(content, ',')
 			}
 		}
@@ -84,21 +98,31 @@ func (s *store) Get(ctx context.Context, key string, recursive bool, data interf
 	return s.get(ctx, key, data, opts)
 }
 
-func (s *store) Set(ctx context.Context, key string, data interface{}) error {
+func (s *store) GetModRevision(ctx context.Context, key string, data interface{}) (int64, error) {
 	log := logger.Get(ctx).WithField("scope", "store")
 	key = prefixedKey(s.config, key)
-	c, closer, err := s.newEtcdClient()
+	res, err := s.client.Get(ctx, key)
 	if err != nil {
-		return errors.Wrap(err, "fail to build etcd client")
+		return 0, errors.Wrapf(err, "fail to read key %v", key)
+	}
+	log.WithFields(logrus.Fields{"key": key, "nodes": len(res.Kvs)}).Debug("get key")
+
+	if len(res.Kvs) == 0 {
+		return 0, ErrNotFound
 	}
-	defer closer.Close()
+	return res.Kvs[0].ModRevision, decodeValues([][]byte{res.Kvs[0].Value}, data)
+}
+
+func (s *store) Set(ctx context.Context, key string, data interface{}) error {
+	log := logger.Get(ctx).WithField("scope", "store")
+	key = prefixedKey(s.config, key)
 
 	out, err := json.Marshal(&data)
 	if err != nil {
 		return errors.Wrapf(err, "fail to encode to JSON")
 	}
 
-	_, err = c.Put(ctx, key, string(out))
+	_, err = s.client.Put(ctx, key, string(out))
 	if err != nil {
 		return errors.Wrapf(err, "fail to read key %v", key)
 	}
@@ -110,16 +134,51 @@ func (s *store) Set(ctx context.Context, key string, data interface{}) error {
 func (s *store) Delete(ctx context.Context, key string) error {
 	log := logger.Get(ctx).WithField("scope", "store")
 	key = prefixedKey(s.config, key)
-	c, closer, err := s.newEtcdClient()
-	if err != nil {
-		return errors.Wrap(err, "fail to build etcd client")
-	}
-	defer closer.Close()
 
-	_, err = c.Delete(ctx, key)
+	_, err := s.client.Delete(ctx, key)
 	if err != nil {
 		return errors.Wrapf(err, "fail to delete key %v", key)
 	}
 	log.WithFields(logrus.Fields{"key": key}).Debug("delete key")
 	return nil
 }
+
+func (s *store) Txn(ctx context.Context, cmps []Compare, ops ...Op) error {
+	log := logger.Get(ctx).WithField("scope", "store")
+
+	etcdCmps := make([]clientv3.Cmp, 0, len(cmps))
+	for _, cmp := range cmps {
+		key := prefixedKey(s.config, cmp.Key)
+		etcdCmps = append(etcdCmps, clientv3.Compare(clientv3.ModRevision(key), "=", cmp.ModRevision))
+	}
+
+	etcdOps := make([]clientv3.Op, 0, len(ops))
+	keys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		key := prefixedKey(s.config, op.Key)
+		keys = append(keys, key)
+		switch op.Type {
+		case OpTypeSet:
+			out, err := json.Marshal(&op.Data)
+			if err != nil {
+				return errors.Wrapf(err, "fail to encode %v to JSON", key)
+			}
+			etcdOps = append(etcdOps, clientv3.OpPut(key, string(out)))
+		case OpTypeDelete:
+			etcdOps = append(etcdOps, clientv3.OpDelete(key))
+		default:
+			return errors.Errorf("unknown operation type %v on %v", op.Type, key)
+		}
+	}
+
+	res, err := s.client.Txn(ctx).If(etcdCmps...).Then(etcdOps...).Commit()
+	if err != nil {
+		return errors.Wrapf(err, "fail to commit transaction on %v", keys)
+	}
+	if !res.Succeeded {
+		return ErrTxnConflict
+	}
+
+	log.WithFields(logrus.Fields{"keys": keys}).Debug("commit transaction")
+	return nil
+}
@@ -12,7 +12,7 @@ package storemock
 import (
 	reflect "reflect"
 
-	v3 "go.etcd.io/etcd/client/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -41,10 +41,10 @@ func (m *MockRegistration) EXPECT() *MockRegistrationMockRecorder {
 }
 
 // EventChan mocks base method.
-func (m *MockRegistration) EventChan() <-chan *v3.Event {
+func (m *MockRegistration) EventChan() <-chan *clientv3.Event {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "EventChan")
-	ret0, _ := ret[0].(<-chan *v3.Event)
+	ret0, _ := ret[0].(<-chan *clientv3.Event)
 	return ret0
 }
 
@@ -54,6 +54,20 @@ func (mr *MockRegistrationMockRecorder) EventChan() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventChan", reflect.TypeOf((*MockRegistration)(nil).EventChan))
 }
 
+// ResyncChan mocks base method.
+func (m *MockRegistration) ResyncChan() <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResyncChan")
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// ResyncChan indicates an expected call of ResyncChan.
+func (mr *MockRegistrationMockRecorder) ResyncChan() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResyncChan", reflect.TypeOf((*MockRegistration)(nil).ResyncChan))
+}
+
 // Unregister mocks base method.
 func (m *MockRegistration) Unregister() {
 	m.ctrl.T.Helper()
@@ -13,6 +13,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	store "github.com/Scalingo/sand/store"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -68,6 +69,21 @@ func (mr *MockStoreMockRecorder) Get(ctx, key, recursive, data any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), ctx, key, recursive, data)
 }
 
+// GetModRevision mocks base method.
+func (m *MockStore) GetModRevision(ctx context.Context, key string, data any) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetModRevision", ctx, key, data)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetModRevision indicates an expected call of GetModRevision.
+func (mr *MockStoreMockRecorder) GetModRevision(ctx, key, data any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetModRevision", reflect.TypeOf((*MockStore)(nil).GetModRevision), ctx, key, data)
+}
+
 // GetWithRevision mocks base method.
 func (m *MockStore) GetWithRevision(ctx context.Context, key string, rev int64, recursive bool, data any) error {
 	m.ctrl.T.Helper()
@@ -95,3 +111,22 @@ func (mr *MockStoreMockRecorder) Set(ctx, key, data any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockStore)(nil).Set), ctx, key, data)
 }
+
+// Txn mocks base method.
+func (m *MockStore) Txn(ctx context.Context, cmps []store.Compare, ops ...store.Op) error {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, cmps}
+	for _, a := range ops {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Txn", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Txn indicates an expected call of Txn.
+func (mr *MockStoreMockRecorder) Txn(ctx, cmps any, ops ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, cmps}, ops...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Txn", reflect.TypeOf((*MockStore)(nil).Txn), varargs...)
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrTxnConflict is returned by Txn when one of the comparisons failed, none
+// of the operations has been applied.
+var ErrTxnConflict = errors.New("transaction conflict")
+
+type OpType int
+
+const (
+	OpTypeSet OpType = iota
+	OpTypeDelete
+)
+
+// Op is an operation applied as part of a transaction
+type Op struct {
+	Type OpType
+	Key  string
+	Data interface{}
+}
+
+func OpSet(key string, data interface{}) Op {
+	return Op{Type: OpTypeSet, Key: key, Data: data}
+}
+
+func OpDelete(key string) Op {
+	return Op{Type: OpTypeDelete, Key: key}
+}
+
+// Compare is a condition which should be true for a transaction to be applied
+type Compare struct {
+	Key         string
+	ModRevision int64
+}
+
+// CompareModRevision succeeds if the last modification of key happened at
+// revision rev. A revision of 0 means the key must not exist.
+func CompareModRevision(key string, rev int64) Compare {
+	return Compare{Key: key, ModRevision: rev}
+}
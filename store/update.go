@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxUpdateAttempts is the number of times a key modified concurrently is
+	// read again before giving up
+	maxUpdateAttempts = 50
+	// updateRetryDelay is the base of the random delay before reading again a
+	// key modified concurrently, it grows with the attempts
+	updateRetryDelay = 2 * time.Millisecond
+)
+
+var (
+	ErrTooManyConflicts = errors.New("key modified concurrently too many times")
+	// ErrNotModified is returned by an update function when there is nothing
+	// to save
+	ErrNotModified = errors.New("key not modified")
+)
+
+// Update reads key in data, calls fn and applies the operations it returns if
+// key has not been modified in the meantime, in which case data is read again
+// and fn is called on its new version. found is false if key does not exist,
+// data is then left to its zero value.
+//
+// Concurrent updates of a key don't wait for each other, only the ones which
+// conflict are retried.
+func Update(ctx context.Context, s Store, key string, data interface{}, fn func(found bool) ([]Op, error)) error {
+	value := reflect.ValueOf(data).Elem()
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		value.Set(reflect.Zero(value.Type()))
+		found := true
+		rev, err := s.GetModRevision(ctx, key, data)
+		if err == ErrNotFound {
+			found, rev = false, 0
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to get %v", key)
+		}
+
+		ops, err := fn(found)
+		if err == ErrNotModified {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.Txn(ctx, []Compare{CompareModRevision(key, rev)}, ops...)
+		if err == ErrTxnConflict {
+			// The random delay spreads the retries of the concurrent updates
+			delay := time.Duration(rand.Int63n(int64(updateRetryDelay) * int64(attempt)))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to save %v", key)
+		}
+		return nil
+	}
+	return errors.Wrapf(ErrTooManyConflicts, "fail to update %v", key)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/sand/config"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	t.Run("it should create the key if it does not exist", func(t *testing.T) {
+		s := NewMemory(config)
+
+		var item memoryTestItem
+		err := Update(ctx, s, "/items/1", &item, func(found bool) ([]Op, error) {
+			assert.False(t, found)
+			item.ID = "1"
+			return []Op{OpSet("/items/1", item)}, nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Get(ctx, "/items/1", false, &item))
+		assert.Equal(t, "1", item.ID)
+	})
+
+	t.Run("it should apply the function again on a key modified concurrently", func(t *testing.T) {
+		s := NewMemory(config)
+		require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1"}))
+
+		var item memoryTestItem
+		var seen []string
+		err := Update(ctx, s, "/items/1", &item, func(found bool) ([]Op, error) {
+			assert.True(t, found)
+			seen = append(seen, item.ID)
+			if len(seen) == 1 {
+				require.NoError(t, s.Set(ctx, "/items/1", memoryTestItem{ID: "1bis"}))
+			}
+			return []Op{OpSet("/items/1", memoryTestItem{ID: item.ID + "+"})}, nil
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"1", "1bis"}, seen)
+		require.NoError(t, s.Get(ctx, "/items/1", false, &item))
+		assert.Equal(t, "1bis+", item.ID)
+	})
+
+	t.Run("it should not save anything if the key is not modified", func(t *testing.T) {
+		s := NewMemory(config)
+
+		var item memoryTestItem
+		err := Update(ctx, s, "/items/1", &item, func(bool) ([]Op, error) {
+			return nil, ErrNotModified
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ErrNotFound, s.Get(ctx, "/items/1", false, &item))
+	})
+}
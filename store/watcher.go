@@ -2,8 +2,9 @@ package store
 
 import (
 	"context"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -11,41 +12,123 @@ import (
 
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/config"
-	"github.com/Scalingo/sand/etcd"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// watchRetryDelay is the time waited before resuming a watch which has been
+// stopped by etcd
+const watchRetryDelay = time.Second
+
+// defaultQueueSize is the size of the event queue of a registration if it is
+// not configured
+const defaultQueueSize = 1000
+
 type EtcdWatcher interface {
-	WatchChan() clientv3.WatchChan
+	// Watch streams the modifications from revision rev, or from the current
+	// revision if rev is 0. It is called again to resume the watch when the
+	// channel is closed.
+	Watch(rev int64) clientv3.WatchChan
 	Close() error
 }
 
+// EtcdWatcherBuilder is implemented by the store backends which are able to
+// stream their modifications, it is the etcd store itself or the memory and
+// file stores
+type EtcdWatcherBuilder interface {
+	NewEtcdWatcher(prefix string) (EtcdWatcher, error)
+}
+
 type Registration interface {
 	EventChan() <-chan *clientv3.Event
+	// ResyncChan receives a value when events may have been lost, the state of
+	// the registered key should then be read again from the store.
+	ResyncChan() <-chan struct{}
 	Unregister()
 }
 
 type registration struct {
-	eventChan chan *clientv3.Event
-	Watcher   Watcher
-	key       string
+	eventChan  chan *clientv3.Event
+	resyncChan chan struct{}
+	Watcher    Watcher
+	key        string
+	stats      *registrationStats
+}
+
+type registrationStats struct {
+	overflows     int64
+	droppedEvents int64
+}
+
+// WatcherMetrics are the statistics of the event queues of the registrations
+type WatcherMetrics struct {
+	QueueSize     int                            `json:"queue_size"`
+	Registrations map[string]RegistrationMetrics `json:"registrations"`
+}
+
+type RegistrationMetrics struct {
+	QueueDepth    int   `json:"queue_depth"`
+	Overflows     int64 `json:"overflows"`
+	DroppedEvents int64 `json:"dropped_events"`
 }
 
 func (r registration) EventChan() <-chan *clientv3.Event {
 	return r.eventChan
 }
 
+func (r registration) ResyncChan() <-chan struct{} {
+	return r.resyncChan
+}
+
 func (r registration) Unregister() {
 	r.Watcher.unregister(r.key)
 }
 
+// push queues the event without blocking. If the queue is full, the
+// registration is marked dirty: the queued events are dropped and a resync is
+// requested, the consumer reads the state from the store instead of catching
+// up. The registrations lock should be held.
+func (r registration) push(event *clientv3.Event) {
+	select {
+	case r.eventChan <- event:
+		return
+	default:
+	}
+
+	dropped := int64(1)
+drain:
+	for {
+		select {
+		case <-r.eventChan:
+			dropped++
+		default:
+			break drain
+		}
+	}
+	atomic.AddInt64(&r.stats.overflows, 1)
+	atomic.AddInt64(&r.stats.droppedEvents, dropped)
+	r.requestResync()
+}
+
+func (r registration) requestResync() {
+	// A pending resync covers the new one
+	select {
+	case r.resyncChan <- struct{}{}:
+	default:
+	}
+}
+
 type Watcher struct {
-	config         *config.Config
-	prefix         string
-	etcdWatcher    EtcdWatcher
-	registrations  map[string]registration
-	registrationsM *sync.RWMutex
+	config             *config.Config
+	prefix             string
+	etcdWatcher        EtcdWatcher
+	etcdWatcherBuilder EtcdWatcherBuilder
+	registrations      map[string]registration
+	registrationsIndex *registrationIndex
+	registrationsM     *sync.RWMutex
+	queueSize          int
+	done               chan struct{}
+	closeOnce          *sync.Once
 }
 
 type WatcherOpt func(w *Watcher)
@@ -63,12 +146,22 @@ func WithEtcdWatcher(etcdWatcher EtcdWatcher) WatcherOpt {
 	}
 }
 
+func WithEtcdWatcherBuilder(builder EtcdWatcherBuilder) WatcherOpt {
+	return func(w *Watcher) {
+		w.etcdWatcherBuilder = builder
+	}
+}
+
 func NewWatcher(ctx context.Context, config *config.Config, opts ...WatcherOpt) (Watcher, error) {
 	log := logger.Get(ctx)
 	w := Watcher{
-		config:         config,
-		registrations:  make(map[string]registration),
-		registrationsM: &sync.RWMutex{},
+		config:             config,
+		registrations:      make(map[string]registration),
+		registrationsIndex: newRegistrationIndex(),
+		registrationsM:     &sync.RWMutex{},
+		queueSize:          config.WatcherQueueSize,
+		done:               make(chan struct{}),
+		closeOnce:          &sync.Once{},
 	}
 
 	for _, opt := range opts {
@@ -78,27 +171,81 @@ func NewWatcher(ctx context.Context, config *config.Config, opts ...WatcherOpt)
 	if w.prefix == "" {
 		w.prefix = prefixedKey(w.config, "/")
 	}
+	if w.queueSize <= 0 {
+		w.queueSize = defaultQueueSize
+	}
 
 	log.Infof("create endpoints Watcher on prefix %v", w.prefix)
 
 	if w.etcdWatcher == nil {
-		etcdWatcher, err := etcd.NewWatcher(w.prefix)
+		if w.etcdWatcherBuilder == nil {
+			return Watcher{}, errors.New("an etcd watcher or an etcd watcher builder is required")
+		}
+		etcdWatcher, err := w.etcdWatcherBuilder.NewEtcdWatcher(w.prefix)
 		if err != nil {
 			return Watcher{}, errors.Wrapf(err, "fail to create etcd Watcher on %v", w.prefix)
 		}
 		w.etcdWatcher = etcdWatcher
 	}
 
+	// The first watch is started synchronously, modifications done once the
+	// watcher is created are not missed
+	wchan := w.etcdWatcher.Watch(0)
 	go func() {
-		w.watchModifications(ctx)
+		w.watchModifications(ctx, wchan)
 	}()
 
 	return w, nil
 }
 
-func (w Watcher) watchModifications(ctx context.Context) {
+// watchModifications dispatches the events to the registrations. The watch is
+// resumed from the revision following the last received event when it stops,
+// if this revision has been compacted or if it is unknown because the watch
+// stopped before being created, the registrations are resynchronized.
+func (w Watcher) watchModifications(ctx context.Context, wchan clientv3.WatchChan) {
 	log := logger.Get(ctx)
-	for res := range w.etcdWatcher.WatchChan() {
+	var rev int64
+	for {
+		compacted := w.dispatch(ctx, wchan, &rev)
+		if !compacted {
+			select {
+			case <-w.done:
+				return
+			case <-time.After(watchRetryDelay):
+			}
+			log.WithField("rev", rev).Info("etcd watch stopped, resume it")
+		}
+		// Watching from revision 0 starts at the current revision, the
+		// modifications done since the previous watch stopped are missed
+		resync := compacted || rev == 0
+		wchan = w.etcdWatcher.Watch(rev)
+		if resync {
+			w.resync()
+		}
+	}
+}
+
+// dispatch sends the events of wchan to the registrations until the watch
+// stops, rev is updated with the next revision to watch. It returns true if
+// the watch stopped because the watched revision has been compacted.
+func (w Watcher) dispatch(ctx context.Context, wchan clientv3.WatchChan, rev *int64) bool {
+	log := logger.Get(ctx)
+	for res := range wchan {
+		if res.CompactRevision != 0 {
+			log.WithFields(logrus.Fields{
+				"rev": *rev, "compact_rev": res.CompactRevision,
+			}).Warn("watched revision has been compacted, resync registrations")
+			*rev = res.CompactRevision
+			return true
+		}
+		if res.Created && *rev == 0 {
+			*rev = res.Header.Revision + 1
+			continue
+		}
+		if res.IsProgressNotify() {
+			*rev = res.Header.Revision + 1
+			continue
+		}
 		if err := res.Err(); err != nil {
 			// If the connection is canceled because grpc (HTTP/2) connection is
 			// closed as etcd restart We don't want to throw an error but just keep
@@ -112,19 +259,53 @@ func (w Watcher) watchModifications(ctx context.Context) {
 		}
 		log.WithField("events_count", len(res.Events)).Debug("received events from etcd")
 		for _, event := range res.Events {
+			*rev = event.Kv.ModRevision + 1
 			log.WithFields(logrus.Fields{
 				"event_key": string(event.Kv.Key), "event_type": event.Type,
 			}).Info("received event from etcd")
 
-			w.registrationsM.RLock()
-			for key, registration := range w.registrations {
-				if strings.HasPrefix(string(event.Kv.Key), key) {
-					registration.eventChan <- event
-				}
-			}
-			w.registrationsM.RUnlock()
+			w.dispatchEvent(event)
 		}
 	}
+	return false
+}
+
+// dispatchEvent queues the event to the registrations of its key or of one
+// of its parents
+func (w Watcher) dispatchEvent(event *clientv3.Event) {
+	w.registrationsM.RLock()
+	defer w.registrationsM.RUnlock()
+	w.registrationsIndex.match(string(event.Kv.Key), func(r registration) {
+		r.push(event)
+	})
+}
+
+func (w Watcher) resync() {
+	w.registrationsM.RLock()
+	defer w.registrationsM.RUnlock()
+	for _, r := range w.registrations {
+		r.requestResync()
+	}
+}
+
+// Metrics returns the current depth of the event queue of each registration
+// and how many times they overflowed
+func (w Watcher) Metrics() WatcherMetrics {
+	w.registrationsM.RLock()
+	defer w.registrationsM.RUnlock()
+
+	metrics := WatcherMetrics{
+		QueueSize:     w.queueSize,
+		Registrations: make(map[string]RegistrationMetrics, len(w.registrations)),
+	}
+	for key, r := range w.registrations {
+		metrics.Registrations[key] = RegistrationMetrics{
+			QueueDepth:    len(r.eventChan),
+			Overflows:     atomic.LoadInt64(&r.stats.overflows),
+			DroppedEvents: atomic.LoadInt64(&r.stats.droppedEvents),
+		}
+	}
+	return metrics
 }
 
 func (w Watcher) Register(key string) (Registration, error) {
@@ -137,13 +318,15 @@ func (w Watcher) Register(key string) (Registration, error) {
 		return registration{}, errors.Errorf("etcd Watcher registration already exists: %v", key)
 	}
 
-	c := make(chan *clientv3.Event, 10)
 	r := registration{
-		key:       key,
-		eventChan: c,
-		Watcher:   w,
+		key:        key,
+		eventChan:  make(chan *clientv3.Event, w.queueSize),
+		resyncChan: make(chan struct{}, 1),
+		Watcher:    w,
+		stats:      &registrationStats{},
 	}
 	w.registrations[key] = r
+	w.registrationsIndex.add(key, r)
 
 	return r, nil
 }
@@ -158,14 +341,20 @@ func (w Watcher) unregister(key string) {
 	}
 	close(r.eventChan)
 	delete(w.registrations, key)
+	w.registrationsIndex.remove(key)
 }
 
 func (w Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+
 	w.registrationsM.Lock()
 	for key, r := range w.registrations {
 		close(r.eventChan)
 		delete(w.registrations, key)
 	}
+	w.registrationsIndex.root = &registrationIndexNode{}
 	w.registrationsM.Unlock()
 
 	return w.etcdWatcher.Close()
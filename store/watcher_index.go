@@ -0,0 +1,108 @@
+package store
+
+import (
+	"strings"
+)
+
+// registrationIndex is a trie of the registrations keyed by the segments of
+// their key. The registrations concerned by an event are found by walking the
+// segments of the event key, whatever the number of registrations is.
+//
+// A registration on /network-endpoints/1 matches /network-endpoints/1 and the
+// keys under /network-endpoints/1/ but not /network-endpoints/10.
+type registrationIndex struct {
+	root *registrationIndexNode
+}
+
+type registrationIndexNode struct {
+	children     map[string]*registrationIndexNode
+	registration *registration
+}
+
+func newRegistrationIndex() *registrationIndex {
+	return &registrationIndex{root: &registrationIndexNode{}}
+}
+
+func (i *registrationIndex) add(key string, r registration) {
+	node := i.root
+	eachSegment(key, func(segment string) bool {
+		child, ok := node.children[segment]
+		if !ok {
+			child = &registrationIndexNode{}
+			if node.children == nil {
+				node.children = make(map[string]*registrationIndexNode)
+			}
+			node.children[segment] = child
+		}
+		node = child
+		return true
+	})
+	node.registration = &r
+}
+
+func (i *registrationIndex) remove(key string) {
+	// Nodes from the root to the registration, to prune the empty ones
+	path := []*registrationIndexNode{i.root}
+	segments := []string{}
+	found := true
+	eachSegment(key, func(segment string) bool {
+		child, ok := path[len(path)-1].children[segment]
+		if !ok {
+			found = false
+			return false
+		}
+		path = append(path, child)
+		segments = append(segments, segment)
+		return true
+	})
+	if !found {
+		return
+	}
+
+	path[len(path)-1].registration = nil
+	for j := len(path) - 1; j > 0; j-- {
+		node := path[j]
+		if node.registration != nil || len(node.children) > 0 {
+			return
+		}
+		delete(path[j-1].children, segments[j-1])
+	}
+}
+
+// match calls f with each registration whose key is a parent of key or key
+// itself
+func (i *registrationIndex) match(key string, f func(registration)) {
+	node := i.root
+	if node.registration != nil {
+		f(*node.registration)
+	}
+	eachSegment(key, func(segment string) bool {
+		child, ok := node.children[segment]
+		if !ok {
+			return false
+		}
+		node = child
+		if node.registration != nil {
+			f(*node.registration)
+		}
+		return true
+	})
+}
+
+// eachSegment calls f with the non-empty segments of a slash-separated key
+// until it returns false, without allocating them.
+func eachSegment(key string, f func(string) bool) {
+	for len(key) > 0 {
+		end := strings.IndexByte(key, '/')
+		if end == -1 {
+			end = len(key)
+		}
+		if end > 0 && !f(key[:end]) {
+			return
+		}
+		if end == len(key) {
+			return
+		}
+		key = key[end+1:]
+	}
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrationIndex(t *testing.T) {
+	matches := func(i *registrationIndex, key string) []string {
+		keys := []string{}
+		i.match(key, func(r registration) {
+			keys = append(keys, r.key)
+		})
+		return keys
+	}
+
+	t.Run("it should match the registrations of the key and of its parents", func(t *testing.T) {
+		i := newRegistrationIndex()
+		for _, key := range []string{"/sc-net/network-endpoints", "/sc-net/network-endpoints/1", "/sc-net/network-endpoints/10"} {
+			i.add(key, registration{key: key})
+		}
+
+		assert.Equal(t, []string{"/sc-net/network-endpoints", "/sc-net/network-endpoints/1"}, matches(i, "/sc-net/network-endpoints/1/host/ep"))
+		assert.Equal(t, []string{"/sc-net/network-endpoints", "/sc-net/network-endpoints/1"}, matches(i, "/sc-net/network-endpoints/1"))
+		assert.Equal(t, []string{"/sc-net/network-endpoints"}, matches(i, "/sc-net/network-endpoints/100/host/ep"))
+		assert.Equal(t, []string{}, matches(i, "/sc-net/networks/1"))
+	})
+
+	t.Run("it should not match a removed registration and prune its nodes", func(t *testing.T) {
+		i := newRegistrationIndex()
+		i.add("/sc-net/network-endpoints/1", registration{key: "/sc-net/network-endpoints/1"})
+		i.add("/sc-net/network-endpoints/2", registration{key: "/sc-net/network-endpoints/2"})
+
+		i.remove("/sc-net/network-endpoints/1")
+		i.remove("/sc-net/network-endpoints/3")
+		assert.Equal(t, []string{}, matches(i, "/sc-net/network-endpoints/1/host/ep"))
+		assert.Equal(t, []string{"/sc-net/network-endpoints/2"}, matches(i, "/sc-net/network-endpoints/2/host/ep"))
+
+		i.remove("/sc-net/network-endpoints/2")
+		assert.Empty(t, i.root.children)
+	})
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -72,7 +74,7 @@ func TestWatcher_Register(t *testing.T) {
 			etcdWatcher := NewMockEtcdWatcher(ctrl)
 			incomingEvents := make(chan clientv3.WatchResponse, 1)
 
-			etcdWatcher.EXPECT().WatchChan().Return(clientv3.WatchChan(incomingEvents))
+			etcdWatcher.EXPECT().Watch(int64(0)).Return(clientv3.WatchChan(incomingEvents))
 			etcdWatcher.EXPECT().Close().Return(nil)
 
 			config, err := config.Build()
@@ -96,3 +98,188 @@ func TestWatcher_Register(t *testing.T) {
 		})
 	}
 }
+
+func TestWatcher_Resume(t *testing.T) {
+	ctx := context.Background()
+	config, err := config.Build()
+	require.NoError(t, err)
+
+	t.Run("it should resume the watch after the last received event", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		first := make(chan clientv3.WatchResponse, 1)
+		second := make(chan clientv3.WatchResponse, 1)
+		etcdWatcher := NewMockEtcdWatcher(ctrl)
+		gomock.InOrder(
+			etcdWatcher.EXPECT().Watch(int64(0)).Return(clientv3.WatchChan(first)),
+			etcdWatcher.EXPECT().Watch(int64(43)).Return(clientv3.WatchChan(second)),
+		)
+		etcdWatcher.EXPECT().Close().Return(nil)
+
+		w, err := NewWatcher(ctx, config, WithEtcdWatcher(etcdWatcher), WithPrefix("/prefix"))
+		require.NoError(t, err)
+		defer w.Close()
+		r, err := w.Register("/prefix/key")
+		require.NoError(t, err)
+
+		first <- clientv3.WatchResponse{Events: []*clientv3.Event{{
+			Kv: &mvccpb.KeyValue{Key: []byte("/sc-net/prefix/key/1"), ModRevision: 42},
+		}}}
+		<-r.EventChan()
+		close(first)
+
+		second <- clientv3.WatchResponse{Events: []*clientv3.Event{{
+			Kv: &mvccpb.KeyValue{Key: []byte("/sc-net/prefix/key/2"), ModRevision: 44},
+		}}}
+		select {
+		case event := <-r.EventChan():
+			assert.Equal(t, "/sc-net/prefix/key/2", string(event.Kv.Key))
+		case <-time.After(2 * watchRetryDelay):
+			require.Fail(t, "watch should have been resumed")
+		}
+	})
+
+	t.Run("it should resync the registrations if the revision has been compacted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		first := make(chan clientv3.WatchResponse, 1)
+		second := make(chan clientv3.WatchResponse)
+		etcdWatcher := NewMockEtcdWatcher(ctrl)
+		gomock.InOrder(
+			etcdWatcher.EXPECT().Watch(int64(0)).Return(clientv3.WatchChan(first)),
+			etcdWatcher.EXPECT().Watch(int64(100)).Return(clientv3.WatchChan(second)),
+		)
+		etcdWatcher.EXPECT().Close().Return(nil)
+
+		w, err := NewWatcher(ctx, config, WithEtcdWatcher(etcdWatcher), WithPrefix("/prefix"))
+		require.NoError(t, err)
+		defer w.Close()
+		r, err := w.Register("/prefix/key")
+		require.NoError(t, err)
+
+		first <- clientv3.WatchResponse{CompactRevision: 100, Canceled: true}
+		select {
+		case <-r.ResyncChan():
+		case <-time.After(time.Second):
+			require.Fail(t, "registration should be resynced")
+		}
+	})
+
+	t.Run("it should resync the registrations if the first watch stops before being created", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		first := make(chan clientv3.WatchResponse)
+		second := make(chan clientv3.WatchResponse)
+		etcdWatcher := NewMockEtcdWatcher(ctrl)
+		gomock.InOrder(
+			etcdWatcher.EXPECT().Watch(int64(0)).Return(clientv3.WatchChan(first)),
+			etcdWatcher.EXPECT().Watch(int64(0)).Return(clientv3.WatchChan(second)),
+		)
+		etcdWatcher.EXPECT().Close().Return(nil)
+
+		w, err := NewWatcher(ctx, config, WithEtcdWatcher(etcdWatcher), WithPrefix("/prefix"))
+		require.NoError(t, err)
+		defer w.Close()
+		r, err := w.Register("/prefix/key")
+		require.NoError(t, err)
+
+		close(first)
+		select {
+		case <-r.ResyncChan():
+		case <-time.After(2 * watchRetryDelay):
+			require.Fail(t, "registration should be resynced")
+		}
+	})
+}
+
+func TestWatcher_Overflow(t *testing.T) {
+	t.Run("it should drop the queued events and request a resync when the queue is full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		incomingEvents := make(chan clientv3.WatchResponse)
+		etcdWatcher := NewMockEtcdWatcher(ctrl)
+		etcdWatcher.EXPECT().Watch(int64(0)).Return(clientv3.WatchChan(incomingEvents))
+		etcdWatcher.EXPECT().Close().Return(nil)
+
+		config, err := config.Build()
+		require.NoError(t, err)
+		config.WatcherQueueSize = 2
+
+		w, err := NewWatcher(context.Background(), config, WithEtcdWatcher(etcdWatcher), WithPrefix("/prefix"))
+		require.NoError(t, err)
+		defer w.Close()
+		slow, err := w.Register("/prefix/slow")
+		require.NoError(t, err)
+		fast, err := w.Register("/prefix/fast")
+		require.NoError(t, err)
+
+		for i := int64(1); i <= 3; i++ {
+			incomingEvents <- clientv3.WatchResponse{Events: []*clientv3.Event{
+				{Kv: &mvccpb.KeyValue{Key: []byte("/sc-net/prefix/slow/key"), ModRevision: i}},
+				{Kv: &mvccpb.KeyValue{Key: []byte("/sc-net/prefix/fast/key"), ModRevision: i}},
+			}}
+			event := <-fast.EventChan()
+			assert.Equal(t, i, event.Kv.ModRevision)
+		}
+
+		select {
+		case <-slow.ResyncChan():
+		case <-time.After(time.Second):
+			require.Fail(t, "slow registration should be resynced")
+		}
+		assert.Len(t, slow.EventChan(), 0)
+
+		metrics := w.Metrics()
+		assert.Equal(t, 2, metrics.QueueSize)
+		assert.Equal(t, RegistrationMetrics{Overflows: 1, DroppedEvents: 3}, metrics.Registrations["/sc-net/prefix/slow"])
+		assert.Equal(t, RegistrationMetrics{}, metrics.Registrations["/sc-net/prefix/fast"])
+	})
+}
+
+func BenchmarkWatcher_Dispatch(b *testing.B) {
+	config, err := config.Build()
+	require.NoError(b, err)
+
+	for _, count := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("%d registrations", count), func(b *testing.B) {
+			w := Watcher{
+				config:             config,
+				registrations:      make(map[string]registration),
+				registrationsIndex: newRegistrationIndex(),
+				registrationsM:     &sync.RWMutex{},
+				queueSize:          defaultQueueSize,
+			}
+			for i := 0; i < count; i++ {
+				if i == count/2 {
+					continue
+				}
+				_, err := w.Register(fmt.Sprintf("/network-endpoints/%d", i))
+				require.NoError(b, err)
+			}
+			// The queue of the registration receiving the events holds all of
+			// them, the benchmark does not measure the overflow path
+			w.queueSize = b.N
+			_, err := w.Register(fmt.Sprintf("/network-endpoints/%d", count/2))
+			require.NoError(b, err)
+			event := &clientv3.Event{
+				Kv: &mvccpb.KeyValue{Key: []byte(fmt.Sprintf("/sc-net/network-endpoints/%d/host/endpoint", count/2))},
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.dispatchEvent(event)
+			}
+			b.StopTimer()
+
+			for key, metrics := range w.Metrics().Registrations {
+				if metrics.Overflows != 0 {
+					b.Errorf("registration %v overflowed %d times", key, metrics.Overflows)
+				}
+			}
+		})
+	}
+}
@@ -90,6 +90,21 @@ func (mr *MockClientMockRecorder) EndpointsList(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndpointsList", reflect.TypeOf((*MockClient)(nil).EndpointsList), arg0, arg1)
 }
 
+// NetworkAllocations mocks base method.
+func (m *MockClient) NetworkAllocations(arg0 context.Context, arg1 string, arg2 bool) (types.IPAllocationsReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkAllocations", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.IPAllocationsReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworkAllocations indicates an expected call of NetworkAllocations.
+func (mr *MockClientMockRecorder) NetworkAllocations(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkAllocations", reflect.TypeOf((*MockClient)(nil).NetworkAllocations), arg0, arg1, arg2)
+}
+
 // NetworkConnect mocks base method.
 func (m *MockClient) NetworkConnect(arg0 context.Context, arg1 string, arg2 params.NetworkConnect) (net.Conn, error) {
 	m.ctrl.T.Helper()
@@ -134,6 +149,35 @@ func (mr *MockClientMockRecorder) NetworkDelete(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkDelete", reflect.TypeOf((*MockClient)(nil).NetworkDelete), arg0, arg1)
 }
 
+// NetworkIPAM mocks base method.
+func (m *MockClient) NetworkIPAM(arg0 context.Context, arg1 string) (types.NetworkIPAM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkIPAM", arg0, arg1)
+	ret0, _ := ret[0].(types.NetworkIPAM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworkIPAM indicates an expected call of NetworkIPAM.
+func (mr *MockClientMockRecorder) NetworkIPAM(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkIPAM", reflect.TypeOf((*MockClient)(nil).NetworkIPAM), arg0, arg1)
+}
+
+// NetworkReservationRelease mocks base method.
+func (m *MockClient) NetworkReservationRelease(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkReservationRelease", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NetworkReservationRelease indicates an expected call of NetworkReservationRelease.
+func (mr *MockClientMockRecorder) NetworkReservationRelease(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkReservationRelease", reflect.TypeOf((*MockClient)(nil).NetworkReservationRelease), arg0, arg1, arg2)
+}
+
 // NetworkShow mocks base method.
 func (m *MockClient) NetworkShow(arg0 context.Context, arg1 string) (types.Network, error) {
 	m.ctrl.T.Helper()
@@ -149,6 +193,51 @@ func (mr *MockClientMockRecorder) NetworkShow(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkShow", reflect.TypeOf((*MockClient)(nil).NetworkShow), arg0, arg1)
 }
 
+// NetworkSubnetAdd mocks base method.
+func (m *MockClient) NetworkSubnetAdd(arg0 context.Context, arg1 string, arg2 params.NetworkSubnetAdd) (types.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkSubnetAdd", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworkSubnetAdd indicates an expected call of NetworkSubnetAdd.
+func (mr *MockClientMockRecorder) NetworkSubnetAdd(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkSubnetAdd", reflect.TypeOf((*MockClient)(nil).NetworkSubnetAdd), arg0, arg1, arg2)
+}
+
+// NetworkSubnetWiden mocks base method.
+func (m *MockClient) NetworkSubnetWiden(arg0 context.Context, arg1 string, arg2 params.NetworkSubnetWiden) (types.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkSubnetWiden", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworkSubnetWiden indicates an expected call of NetworkSubnetWiden.
+func (mr *MockClientMockRecorder) NetworkSubnetWiden(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkSubnetWiden", reflect.TypeOf((*MockClient)(nil).NetworkSubnetWiden), arg0, arg1, arg2)
+}
+
+// NetworkUpdate mocks base method.
+func (m *MockClient) NetworkUpdate(arg0 context.Context, arg1 string, arg2 params.NetworkUpdate) (types.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworkUpdate", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworkUpdate indicates an expected call of NetworkUpdate.
+func (mr *MockClientMockRecorder) NetworkUpdate(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworkUpdate", reflect.TypeOf((*MockClient)(nil).NetworkUpdate), arg0, arg1, arg2)
+}
+
 // NetworksList mocks base method.
 func (m *MockClient) NetworksList(arg0 context.Context) ([]types.Network, error) {
 	m.ctrl.T.Helper()
@@ -164,6 +253,21 @@ func (mr *MockClientMockRecorder) NetworksList(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworksList", reflect.TypeOf((*MockClient)(nil).NetworksList), arg0)
 }
 
+// NetworksUsage mocks base method.
+func (m *MockClient) NetworksUsage(arg0 context.Context) (map[string]types.NetworkIPAM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NetworksUsage", arg0)
+	ret0, _ := ret[0].(map[string]types.NetworkIPAM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NetworksUsage indicates an expected call of NetworksUsage.
+func (mr *MockClientMockRecorder) NetworksUsage(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NetworksUsage", reflect.TypeOf((*MockClient)(nil).NetworksUsage), arg0)
+}
+
 // NewHTTPRoundTripper mocks base method.
 func (m *MockClient) NewHTTPRoundTripper(ctx context.Context, id string, opts sand.HTTPRoundTripperOpts) http.RoundTripper {
 	m.ctrl.T.Helper()
@@ -178,6 +282,80 @@ func (mr *MockClientMockRecorder) NewHTTPRoundTripper(ctx, id, opts any) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewHTTPRoundTripper", reflect.TypeOf((*MockClient)(nil).NewHTTPRoundTripper), ctx, id, opts)
 }
 
+// StateExport mocks base method.
+func (m *MockClient) StateExport(arg0 context.Context) (types.State, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StateExport", arg0)
+	ret0, _ := ret[0].(types.State)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StateExport indicates an expected call of StateExport.
+func (mr *MockClientMockRecorder) StateExport(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StateExport", reflect.TypeOf((*MockClient)(nil).StateExport), arg0)
+}
+
+// StateImport mocks base method.
+func (m *MockClient) StateImport(arg0 context.Context, arg1 types.State, arg2 params.StateImport) (types.StateImportReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StateImport", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.StateImportReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StateImport indicates an expected call of StateImport.
+func (mr *MockClientMockRecorder) StateImport(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StateImport", reflect.TypeOf((*MockClient)(nil).StateImport), arg0, arg1, arg2)
+}
+
+// VNIReservationCreate mocks base method.
+func (m *MockClient) VNIReservationCreate(arg0 context.Context, arg1 params.VNIReservationCreate) (types.VNIReservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VNIReservationCreate", arg0, arg1)
+	ret0, _ := ret[0].(types.VNIReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VNIReservationCreate indicates an expected call of VNIReservationCreate.
+func (mr *MockClientMockRecorder) VNIReservationCreate(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VNIReservationCreate", reflect.TypeOf((*MockClient)(nil).VNIReservationCreate), arg0, arg1)
+}
+
+// VNIReservationDelete mocks base method.
+func (m *MockClient) VNIReservationDelete(arg0 context.Context, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VNIReservationDelete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VNIReservationDelete indicates an expected call of VNIReservationDelete.
+func (mr *MockClientMockRecorder) VNIReservationDelete(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VNIReservationDelete", reflect.TypeOf((*MockClient)(nil).VNIReservationDelete), arg0, arg1)
+}
+
+// VNIReservationsList mocks base method.
+func (m *MockClient) VNIReservationsList(arg0 context.Context) ([]types.VNIReservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VNIReservationsList", arg0)
+	ret0, _ := ret[0].([]types.VNIReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VNIReservationsList indicates an expected call of VNIReservationsList.
+func (mr *MockClientMockRecorder) VNIReservationsList(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VNIReservationsList", reflect.TypeOf((*MockClient)(nil).VNIReservationsList), arg0)
+}
+
 // Version mocks base method.
 func (m *MockClient) Version(arg0 context.Context) (string, error) {
 	m.ctrl.T.Helper()
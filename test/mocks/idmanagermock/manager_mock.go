@@ -16,6 +16,7 @@ import (
 	gomock "go.uber.org/mock/gomock"
 
 	idmanager "github.com/Scalingo/sand/idmanager"
+	store "github.com/Scalingo/sand/store"
 )
 
 // MockManager is a mock of Manager interface.
@@ -43,31 +44,89 @@ func (m *MockManager) EXPECT() *MockManagerMockRecorder {
 }
 
 // Generate mocks base method.
-func (m *MockManager) Generate(arg0 context.Context) (int, error) {
+func (m *MockManager) Generate(ctx context.Context, ranges []idmanager.Range, ops func(int) []store.Op) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Generate", arg0)
+	ret := m.ctrl.Call(m, "Generate", ctx, ranges, ops)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Generate indicates an expected call of Generate.
-func (mr *MockManagerMockRecorder) Generate(arg0 any) *gomock.Call {
+func (mr *MockManagerMockRecorder) Generate(ctx, ranges, ops any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Generate", reflect.TypeOf((*MockManager)(nil).Generate), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Generate", reflect.TypeOf((*MockManager)(nil).Generate), ctx, ranges, ops)
 }
 
-// Lock mocks base method.
-func (m *MockManager) Lock(arg0 context.Context) (idmanager.Unlocker, error) {
+// Release mocks base method.
+func (m *MockManager) Release(ctx context.Context, id int, ops ...store.Op) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Lock", arg0)
-	ret0, _ := ret[0].(idmanager.Unlocker)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	varargs := []any{ctx, id}
+	for _, a := range ops {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Release", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockManagerMockRecorder) Release(ctx, id any, ops ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, id}, ops...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockManager)(nil).Release), varargs...)
+}
+
+// Reserve mocks base method.
+func (m *MockManager) Reserve(ctx context.Context, id int, ops ...store.Op) error {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, id}
+	for _, a := range ops {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Reserve", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reserve indicates an expected call of Reserve.
+func (mr *MockManagerMockRecorder) Reserve(ctx, id any, ops ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, id}, ops...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockManager)(nil).Reserve), varargs...)
+}
+
+// ReserveTxn mocks base method.
+func (m *MockManager) ReserveTxn(ctx context.Context, ids ...int) (store.Compare, store.Op, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx}
+	for _, a := range ids {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReserveTxn", varargs...)
+	ret0, _ := ret[0].(store.Compare)
+	ret1, _ := ret[1].(store.Op)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReserveTxn indicates an expected call of ReserveTxn.
+func (mr *MockManagerMockRecorder) ReserveTxn(ctx any, ids ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx}, ids...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveTxn", reflect.TypeOf((*MockManager)(nil).ReserveTxn), varargs...)
+}
+
+// Update mocks base method.
+func (m *MockManager) Update(ctx context.Context, id int, fn func(bool) (bool, []store.Op, error)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, id, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// Lock indicates an expected call of Lock.
-func (mr *MockManagerMockRecorder) Lock(arg0 any) *gomock.Call {
+// Update indicates an expected call of Update.
+func (mr *MockManagerMockRecorder) Update(ctx, id, fn any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockManager)(nil).Lock), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockManager)(nil).Update), ctx, id, fn)
 }
@@ -42,6 +42,20 @@ func (m *MockIPAllocator) EXPECT() *MockIPAllocatorMockRecorder {
 	return m.recorder
 }
 
+// AddRange mocks base method.
+func (m *MockIPAllocator) AddRange(ctx context.Context, id, addressRange string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRange", ctx, id, addressRange)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRange indicates an expected call of AddRange.
+func (mr *MockIPAllocatorMockRecorder) AddRange(ctx, id, addressRange any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRange", reflect.TypeOf((*MockIPAllocator)(nil).AddRange), ctx, id, addressRange)
+}
+
 // AllocateIP mocks base method.
 func (m *MockIPAllocator) AllocateIP(ctx context.Context, id string, opts ipallocator.AllocateIPOpts) (string, error) {
 	m.ctrl.T.Helper()
@@ -57,6 +71,21 @@ func (mr *MockIPAllocatorMockRecorder) AllocateIP(ctx, id, opts any) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllocateIP", reflect.TypeOf((*MockIPAllocator)(nil).AllocateIP), ctx, id, opts)
 }
 
+// Reconcile mocks base method.
+func (m *MockIPAllocator) Reconcile(ctx context.Context, id string, addresses []string, repair bool) (ipallocator.Reconciliation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reconcile", ctx, id, addresses, repair)
+	ret0, _ := ret[0].(ipallocator.Reconciliation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reconcile indicates an expected call of Reconcile.
+func (mr *MockIPAllocatorMockRecorder) Reconcile(ctx, id, addresses, repair any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reconcile", reflect.TypeOf((*MockIPAllocator)(nil).Reconcile), ctx, id, addresses, repair)
+}
+
 // ReleaseIP mocks base method.
 func (m *MockIPAllocator) ReleaseIP(ctx context.Context, id, address string) error {
 	m.ctrl.T.Helper()
@@ -84,3 +113,46 @@ func (mr *MockIPAllocatorMockRecorder) ReleasePool(ctx, id any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleasePool", reflect.TypeOf((*MockIPAllocator)(nil).ReleasePool), ctx, id)
 }
+
+// ReleaseReservation mocks base method.
+func (m *MockIPAllocator) ReleaseReservation(ctx context.Context, id, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseReservation", ctx, id, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseReservation indicates an expected call of ReleaseReservation.
+func (mr *MockIPAllocatorMockRecorder) ReleaseReservation(ctx, id, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseReservation", reflect.TypeOf((*MockIPAllocator)(nil).ReleaseReservation), ctx, id, key)
+}
+
+// Usage mocks base method.
+func (m *MockIPAllocator) Usage(ctx context.Context, id string) (ipallocator.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Usage", ctx, id)
+	ret0, _ := ret[0].(ipallocator.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Usage indicates an expected call of Usage.
+func (mr *MockIPAllocatorMockRecorder) Usage(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Usage", reflect.TypeOf((*MockIPAllocator)(nil).Usage), ctx, id)
+}
+
+// WidenRange mocks base method.
+func (m *MockIPAllocator) WidenRange(ctx context.Context, id, addressRange, newAddressRange string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WidenRange", ctx, id, addressRange, newAddressRange)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WidenRange indicates an expected call of WidenRange.
+func (mr *MockIPAllocatorMockRecorder) WidenRange(ctx, id, addressRange, newAddressRange any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WidenRange", reflect.TypeOf((*MockIPAllocator)(nil).WidenRange), ctx, id, addressRange, newAddressRange)
+}
@@ -17,6 +17,7 @@ import (
 
 	params "github.com/Scalingo/sand/api/params"
 	types "github.com/Scalingo/sand/api/types"
+	netmanager "github.com/Scalingo/sand/network/netmanager"
 )
 
 // MockNetManager is a mock of NetManager interface.
@@ -57,6 +58,21 @@ func (mr *MockNetManagerMockRecorder) AddEndpointNeigh(arg0, arg1, arg2 any) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddEndpointNeigh", reflect.TypeOf((*MockNetManager)(nil).AddEndpointNeigh), arg0, arg1, arg2)
 }
 
+// CheckNetwork mocks base method.
+func (m *MockNetManager) CheckNetwork(arg0 context.Context, arg1 types.Network, arg2 []types.Endpoint) ([]netmanager.Drift, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckNetwork", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]netmanager.Drift)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckNetwork indicates an expected call of CheckNetwork.
+func (mr *MockNetManagerMockRecorder) CheckNetwork(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckNetwork", reflect.TypeOf((*MockNetManager)(nil).CheckNetwork), arg0, arg1, arg2)
+}
+
 // Deactivate mocks base method.
 func (m *MockNetManager) Deactivate(arg0 context.Context, arg1 types.Network) error {
 	m.ctrl.T.Helper()
@@ -114,6 +130,20 @@ func (mr *MockNetManagerMockRecorder) EnsureEndpoint(arg0, arg1, arg2, arg3 any)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureEndpoint", reflect.TypeOf((*MockNetManager)(nil).EnsureEndpoint), arg0, arg1, arg2, arg3)
 }
 
+// EnsureEndpointRoutes mocks base method.
+func (m *MockNetManager) EnsureEndpointRoutes(arg0 context.Context, arg1 types.Network, arg2 types.Endpoint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureEndpointRoutes", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsureEndpointRoutes indicates an expected call of EnsureEndpointRoutes.
+func (mr *MockNetManagerMockRecorder) EnsureEndpointRoutes(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureEndpointRoutes", reflect.TypeOf((*MockNetManager)(nil).EnsureEndpointRoutes), arg0, arg1, arg2)
+}
+
 // EnsureEndpointsNeigh mocks base method.
 func (m *MockNetManager) EnsureEndpointsNeigh(arg0 context.Context, arg1 types.Network, arg2 []types.Endpoint) error {
 	m.ctrl.T.Helper()
@@ -169,3 +199,18 @@ func (mr *MockNetManagerMockRecorder) StopListenNetworkChange(arg0, arg1 any) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopListenNetworkChange", reflect.TypeOf((*MockNetManager)(nil).StopListenNetworkChange), arg0, arg1)
 }
+
+// SubscribeNeighMisses mocks base method.
+func (m *MockNetManager) SubscribeNeighMisses(arg0 context.Context, arg1 types.Network, arg2 <-chan struct{}) (<-chan netmanager.NeighMiss, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeNeighMisses", arg0, arg1, arg2)
+	ret0, _ := ret[0].(<-chan netmanager.NeighMiss)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeNeighMisses indicates an expected call of SubscribeNeighMisses.
+func (mr *MockNetManagerMockRecorder) SubscribeNeighMisses(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeNeighMisses", reflect.TypeOf((*MockNetManager)(nil).SubscribeNeighMisses), arg0, arg1, arg2)
+}
@@ -71,3 +71,15 @@ func (mr *MockNetworkEndpointListenerMockRecorder) Remove(arg0, arg1 any) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockNetworkEndpointListener)(nil).Remove), arg0, arg1)
 }
+
+// ResubscribeNeighMisses mocks base method.
+func (m *MockNetworkEndpointListener) ResubscribeNeighMisses(arg0 context.Context, arg1 types.Network) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ResubscribeNeighMisses", arg0, arg1)
+}
+
+// ResubscribeNeighMisses indicates an expected call of ResubscribeNeighMisses.
+func (mr *MockNetworkEndpointListenerMockRecorder) ResubscribeNeighMisses(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResubscribeNeighMisses", reflect.TypeOf((*MockNetworkEndpointListener)(nil).ResubscribeNeighMisses), arg0, arg1)
+}
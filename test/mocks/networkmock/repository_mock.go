@@ -131,3 +131,77 @@ func (mr *MockRepositoryMockRecorder) List(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRepository)(nil).List), ctx)
 }
+
+// ReleaseVNIReservation mocks base method.
+func (m *MockRepository) ReleaseVNIReservation(ctx context.Context, vni int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseVNIReservation", ctx, vni)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseVNIReservation indicates an expected call of ReleaseVNIReservation.
+func (mr *MockRepositoryMockRecorder) ReleaseVNIReservation(ctx, vni any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseVNIReservation", reflect.TypeOf((*MockRepository)(nil).ReleaseVNIReservation), ctx, vni)
+}
+
+// ReserveVNI mocks base method.
+func (m *MockRepository) ReserveVNI(ctx context.Context, arg1 params.VNIReservationCreate) (types.VNIReservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveVNI", ctx, arg1)
+	ret0, _ := ret[0].(types.VNIReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveVNI indicates an expected call of ReserveVNI.
+func (mr *MockRepositoryMockRecorder) ReserveVNI(ctx, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveVNI", reflect.TypeOf((*MockRepository)(nil).ReserveVNI), ctx, arg1)
+}
+
+// UpdateMTU mocks base method.
+func (m *MockRepository) UpdateMTU(ctx context.Context, network types.Network, mtu int) (types.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMTU", ctx, network, mtu)
+	ret0, _ := ret[0].(types.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateMTU indicates an expected call of UpdateMTU.
+func (mr *MockRepositoryMockRecorder) UpdateMTU(ctx, network, mtu any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMTU", reflect.TypeOf((*MockRepository)(nil).UpdateMTU), ctx, network, mtu)
+}
+
+// UpdateSubnets mocks base method.
+func (m *MockRepository) UpdateSubnets(ctx context.Context, network types.Network, subnets []types.Subnet) (types.Network, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSubnets", ctx, network, subnets)
+	ret0, _ := ret[0].(types.Network)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSubnets indicates an expected call of UpdateSubnets.
+func (mr *MockRepositoryMockRecorder) UpdateSubnets(ctx, network, subnets any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSubnets", reflect.TypeOf((*MockRepository)(nil).UpdateSubnets), ctx, network, subnets)
+}
+
+// VNIReservations mocks base method.
+func (m *MockRepository) VNIReservations(ctx context.Context) ([]types.VNIReservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VNIReservations", ctx)
+	ret0, _ := ret[0].([]types.VNIReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VNIReservations indicates an expected call of VNIReservations.
+func (mr *MockRepositoryMockRecorder) VNIReservations(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VNIReservations", reflect.TypeOf((*MockRepository)(nil).VNIReservations), ctx)
+}
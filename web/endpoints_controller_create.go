@@ -8,7 +8,10 @@ import (
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/Scalingo/sand/api/httpresp"
 	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/endpoint"
 	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/network/overlay"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -53,13 +56,44 @@ func (c EndpointsController) Create(w http.ResponseWriter, r *http.Request, p ma
 		return errors.New("not found")
 	}
 
+	// The node can't join a network whose VTEPs are of another family
+	_, err = overlay.VTEPIP(network, c.Config.GetPeerIP())
+	if err != nil {
+		w.WriteHeader(400)
+		return errors.Wrapf(err, "node can't join network %s", network)
+	}
+
+	// The allocated addresses are released if the endpoint is not stored
+	var allocated types.Endpoint
+	created := false
+	defer func() {
+		if !created {
+			endpoint.ReleaseIPs(ctx, c.IPAllocator, network, allocated)
+		}
+	}()
+
 	allocatedIP, err := c.IPAllocator.AllocateIP(ctx, params.NetworkID, ipallocator.AllocateIPOpts{
-		Address: params.IPv4Address,
+		Address:        params.IPv4Address,
+		ReservationKey: params.ReservationKey,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "fail to allocate IP in pool ip=%v network=%v", params.IPv4Address, network)
 	}
 	params.IPv4Address = allocatedIP
+	allocated.TargetVethIP = allocatedIP
+
+	if network.IPv6Range != "" {
+		allocatedIP, err := c.IPAllocator.AllocateIP(ctx, network.IPv6PoolID(), ipallocator.AllocateIPOpts{
+			Address:        params.IPv6Address,
+			AddressRange:   network.IPv6Range,
+			ReservationKey: params.ReservationKey,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "fail to allocate IPv6 in pool ip=%v network=%v", params.IPv6Address, network)
+		}
+		params.IPv6Address = allocatedIP
+		allocated.TargetVethIPv6 = allocatedIP
+	}
 
 	err = c.NetworkRepository.Ensure(ctx, network)
 	if err != nil {
@@ -73,15 +107,21 @@ func (c EndpointsController) Create(w http.ResponseWriter, r *http.Request, p ma
 	params.ActivateParams.SetAddr = true
 	params.ActivateParams.MoveVeth = true
 
-	endpoint, err := c.EndpointRepository.Create(ctx, network, params)
+	e, err := c.EndpointRepository.Create(ctx, network, params)
+	if errors.Cause(err) == endpoint.ErrNotActivated {
+		// The endpoint is still stored with its addresses, they must not be
+		// allocated to another endpoint
+		created = true
+	}
 	if err != nil {
 		return errors.Wrapf(err, "fail to create endpoint")
 	}
+	created = true
 
 	log.Info("endpoint created")
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(&httpresp.EndpointCreate{
-		Endpoint: endpoint,
+		Endpoint: e,
 	})
 	if err != nil {
 		log.WithError(err).Error("fail to encode JSON")
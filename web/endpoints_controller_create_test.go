@@ -12,6 +12,8 @@ import (
 
 	"github.com/Scalingo/sand/api/params"
 	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/endpoint"
 	"github.com/Scalingo/sand/ipallocator"
 	"github.com/Scalingo/sand/test/mocks/endpointmock"
 	"github.com/Scalingo/sand/test/mocks/ipallocatormock"
@@ -57,7 +59,18 @@ func TestEndpointsController_Create(t *testing.T) {
 				r.EXPECT().Exists(gomock.Any(), "1").Return(types.Network{}, false, errors.New("network repo error"))
 			},
 		}, {
-			Name:   "error if network ensure fails",
+			Name:   "node with an IPv4 peer IP can't join a network with IPv6 VTEPs",
+			Path:   "/endpoints",
+			Method: "POST",
+			Body:   `{"network_id": "1"}`,
+			Status: 400,
+			Error:  "networks mixing VTEP families are not supported",
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				network := types.Network{ID: "1", VTEPFamily: types.VTEPFamilyIPv6}
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+			},
+		}, {
+			Name:   "error if network ensure fails, the allocated IP is released",
 			Path:   "/endpoints",
 			Method: "POST",
 			Body:   `{"network_id": "1"}`,
@@ -65,7 +78,8 @@ func TestEndpointsController_Create(t *testing.T) {
 			ExpectIPAllocator: func(m *ipallocatormock.MockIPAllocator) {
 				m.EXPECT().AllocateIP(gomock.Any(), "1", ipallocator.AllocateIPOpts{
 					Address: "",
-				})
+				}).Return("10.0.0.2/24", nil)
+				m.EXPECT().ReleaseIP(gomock.Any(), "1", "10.0.0.2/24").Return(nil)
 			},
 			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
 				network := types.Network{ID: "1"}
@@ -73,7 +87,7 @@ func TestEndpointsController_Create(t *testing.T) {
 				r.EXPECT().Ensure(gomock.Any(), network).Return(errors.New("fail to ensure network"))
 			},
 		}, {
-			Name:   "error if endpoint creation fails",
+			Name:   "error if endpoint creation fails, the allocated IP is released",
 			Path:   "/endpoints",
 			Method: "POST",
 			Body:   `{"network_id": "1", "activate": true, "activate_params": { "ns_handle_path": "/proc/self/ns/net"}}`,
@@ -81,7 +95,8 @@ func TestEndpointsController_Create(t *testing.T) {
 			ExpectIPAllocator: func(m *ipallocatormock.MockIPAllocator) {
 				m.EXPECT().AllocateIP(gomock.Any(), "1", ipallocator.AllocateIPOpts{
 					Address: "",
-				})
+				}).Return("10.0.0.2/24", nil)
+				m.EXPECT().ReleaseIP(gomock.Any(), "1", "10.0.0.2/24").Return(nil)
 			},
 			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
 				network := types.Network{ID: "1"}
@@ -91,8 +106,9 @@ func TestEndpointsController_Create(t *testing.T) {
 			ExpectEndpointRepository: func(r *endpointmock.MockRepository) {
 				network := types.Network{ID: "1"}
 				params := params.EndpointCreate{
-					NetworkID: network.ID,
-					Activate:  true,
+					NetworkID:   network.ID,
+					IPv4Address: "10.0.0.2/24",
+					Activate:    true,
 					ActivateParams: params.EndpointActivate{
 						NSHandlePath: "/proc/self/ns/net",
 						MoveVeth:     true,
@@ -101,6 +117,36 @@ func TestEndpointsController_Create(t *testing.T) {
 				}
 				r.EXPECT().Create(gomock.Any(), network, params).Return(types.Endpoint{}, errors.New("fail to create endpoint"))
 			},
+		}, {
+			Name:   "error if endpoint activation fails after it is stored, the allocated IP is kept",
+			Path:   "/endpoints",
+			Method: "POST",
+			Body:   `{"network_id": "1", "activate": true, "activate_params": { "ns_handle_path": "/proc/self/ns/net"}}`,
+			Error:  "endpoint stored but not activated",
+			ExpectIPAllocator: func(m *ipallocatormock.MockIPAllocator) {
+				m.EXPECT().AllocateIP(gomock.Any(), "1", ipallocator.AllocateIPOpts{
+					Address: "",
+				}).Return("10.0.0.2/24", nil)
+			},
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				network := types.Network{ID: "1"}
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+				r.EXPECT().Ensure(gomock.Any(), network).Return(nil)
+			},
+			ExpectEndpointRepository: func(r *endpointmock.MockRepository) {
+				network := types.Network{ID: "1"}
+				params := params.EndpointCreate{
+					NetworkID:   network.ID,
+					IPv4Address: "10.0.0.2/24",
+					Activate:    true,
+					ActivateParams: params.EndpointActivate{
+						NSHandlePath: "/proc/self/ns/net",
+						MoveVeth:     true,
+						SetAddr:      true,
+					},
+				}
+				r.EXPECT().Create(gomock.Any(), network, params).Return(types.Endpoint{}, endpoint.ErrNotActivated)
+			},
 		},
 	}
 
@@ -114,6 +160,7 @@ func TestEndpointsController_Create(t *testing.T) {
 			ipallocator := ipallocatormock.NewMockIPAllocator(ctrl)
 
 			controller := EndpointsController{
+				Config:             &config.Config{PeerIP: "192.168.1.1"},
 				EndpointRepository: endpointRepo,
 				NetworkRepository:  networkRepo,
 				IPAllocator:        ipallocator,
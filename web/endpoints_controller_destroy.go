@@ -38,6 +38,7 @@ func (c EndpointsController) Destroy(w http.ResponseWriter, r *http.Request, p m
 
 	err = c.EndpointRepository.Delete(ctx, network, e, endpoint.DeleteOpts{
 		ForceDeactivation: true,
+		IPAllocator:       c.IPAllocator,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "fail to destroy endpoint")
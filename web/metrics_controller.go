@@ -0,0 +1,18 @@
+package web
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// MetricsController exposes the variables published with the expvar package
+type MetricsController struct{}
+
+func NewMetricsController() MetricsController {
+	return MetricsController{}
+}
+
+func (c MetricsController) Show(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	expvar.Handler().ServeHTTP(w, r)
+	return nil
+}
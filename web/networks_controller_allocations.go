@@ -0,0 +1,109 @@
+package web
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/types"
+)
+
+// Allocations reports the addresses leaked or double-assigned in the IP pools
+// of the network
+func (c NetworksController) Allocations(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	return c.reconcileAllocations(w, r, p, false)
+}
+
+// RepairAllocations releases the orphaned addresses and allocates the
+// addresses used by endpoints which are free in the IP pools of the network
+func (c NetworksController) RepairAllocations(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	return c.reconcileAllocations(w, r, p, true)
+}
+
+func (c NetworksController) reconcileAllocations(w http.ResponseWriter, r *http.Request, p map[string]string, repair bool) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	network, ok, err := c.NetworkRepository.Exists(ctx, p["id"])
+	if err != nil {
+		return errors.Wrapf(err, "fail to query store")
+	} else if !ok {
+		w.WriteHeader(404)
+		return errors.New("network not found")
+	}
+	log := logger.Get(ctx).WithField("network_id", network.ID).WithField("repair", repair)
+	ctx = logger.ToCtx(ctx, log)
+
+	endpoints, err := c.EndpointRepository.List(ctx, map[string]string{"network_id": network.ID})
+	if err != nil {
+		return errors.Wrapf(err, "fail to list endpoints of network %v", network.ID)
+	}
+
+	report := types.IPAllocationsReport{
+		NetworkID: network.ID, Repaired: repair,
+		Orphaned: []string{}, Unallocated: []string{}, Conflicts: []types.IPAddressConflict{},
+	}
+	var addresses, ipv6Addresses []string
+	owners := map[string][]string{}
+	for _, endpoint := range endpoints {
+		for _, address := range endpoint.TargetVethIPs() {
+			ip, _, err := net.ParseCIDR(address)
+			if err != nil {
+				log.WithError(err).Errorf("invalid address of endpoint %v", endpoint.ID)
+				continue
+			}
+			if len(owners[ip.String()]) == 0 {
+				if ip.To4() != nil {
+					addresses = append(addresses, address)
+				} else {
+					ipv6Addresses = append(ipv6Addresses, address)
+				}
+			}
+			owners[ip.String()] = append(owners[ip.String()], endpoint.ID)
+		}
+	}
+	for _, address := range append(addresses, ipv6Addresses...) {
+		ip, _, _ := net.ParseCIDR(address)
+		if len(owners[ip.String()]) > 1 {
+			report.Conflicts = append(report.Conflicts, types.IPAddressConflict{
+				Address: address, EndpointIDs: owners[ip.String()],
+			})
+		}
+	}
+
+	pools := map[string][]string{network.ID: addresses}
+	if network.IPv6Range != "" {
+		pools[network.IPv6PoolID()] = ipv6Addresses
+	}
+	for id, poolAddresses := range pools {
+		reconciliation, err := c.IPAllocator.Reconcile(ctx, id, poolAddresses, repair)
+		if err != nil {
+			return errors.Wrapf(err, "fail to reconcile IP pool %v", id)
+		}
+		report.Orphaned = append(report.Orphaned, reconciliation.Orphaned...)
+		report.Unallocated = append(report.Unallocated, reconciliation.Unallocated...)
+	}
+	sort.Strings(report.Orphaned)
+	sort.Strings(report.Unallocated)
+
+	if !report.Consistent() {
+		log.WithField("orphaned", len(report.Orphaned)).
+			WithField("unallocated", len(report.Unallocated)).
+			WithField("conflicts", len(report.Conflicts)).
+			Warn("IP allocations do not match the endpoints")
+	}
+
+	w.WriteHeader(200)
+	err = json.NewEncoder(w).Encode(&httpresp.NetworkAllocations{
+		Report: report,
+	})
+	if err != nil {
+		log.WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 
 	"github.com/Scalingo/go-utils/logger"
@@ -10,6 +11,7 @@ import (
 	"github.com/Scalingo/sand/api/types"
 	"github.com/Scalingo/sand/ipallocator"
 	"github.com/Scalingo/sand/netutils"
+	"github.com/Scalingo/sand/network/overlay"
 
 	"github.com/pkg/errors"
 )
@@ -35,7 +37,53 @@ func (c NetworksController) Create(w http.ResponseWriter, r *http.Request, p map
 		cnp.Gateway = types.DefaultGateway
 	}
 
+	if cnp.IPv6Range != "" {
+		ip, _, err := net.ParseCIDR(cnp.IPv6Range)
+		if err != nil || ip.To4() != nil {
+			w.WriteHeader(400)
+			return errors.Errorf("invalid IPv6 range '%v'", cnp.IPv6Range)
+		}
+		if cnp.IPv6Gateway == "" {
+			cnp.IPv6Gateway, err = netutils.DefaultGateway(cnp.IPv6Range)
+			if err != nil {
+				return errors.Wrapf(err, "fail to get default gateway for ipv6range=%v", cnp.IPv6Range)
+			}
+		}
+	}
+
+	err = checkMTU(cnp.MTU, cnp.IPv6Range)
+	if err != nil {
+		w.WriteHeader(400)
+		return err
+	}
+
+	err = overlay.CheckVxLANPorts(cnp.VxLANPort, cnp.VxLANSourcePortRange)
+	if err != nil {
+		w.WriteHeader(400)
+		return err
+	}
+
+	if cnp.VTEPFamily != "" && cnp.VTEPFamily != types.VTEPFamilyIPv4 && cnp.VTEPFamily != types.VTEPFamilyIPv6 {
+		w.WriteHeader(400)
+		return errors.Errorf("invalid VTEP family '%v', must be %s or %s", cnp.VTEPFamily, types.VTEPFamilyIPv4, types.VTEPFamilyIPv6)
+	}
+
+	if cnp.Infrastructure && c.Config.VNIInfrastructureRanges == "" {
+		w.WriteHeader(400)
+		return errors.New("no VNI range for infrastructure networks, VNI_INFRASTRUCTURE_RANGES is not set")
+	}
+
+	exclusions, ipv6Exclusions, err := splitReservations(cnp)
+	if err != nil {
+		w.WriteHeader(400)
+		return err
+	}
+
 	network, err := c.NetworkRepository.Create(ctx, cnp)
+	if status, ok := vniErrorStatus(err); ok {
+		w.WriteHeader(status)
+		return errors.Wrapf(err, "invalid VNI %d", cnp.VxLANVNI)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "fail to create network '%v'", cnp.Name)
 	}
@@ -43,11 +91,25 @@ func (c NetworksController) Create(w http.ResponseWriter, r *http.Request, p map
 	_, err = c.IPAllocator.AllocateIP(ctx, network.ID, ipallocator.AllocateIPOpts{
 		Address:      cnp.Gateway,
 		AddressRange: network.IPRange,
+		Reserve:      true,
+		Exclusions:   exclusions,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "fail to initialize IP pool for network '%v'", network.ID)
 	}
 
+	if network.IPv6Range != "" {
+		_, err = c.IPAllocator.AllocateIP(ctx, network.IPv6PoolID(), ipallocator.AllocateIPOpts{
+			Address:      cnp.IPv6Gateway,
+			AddressRange: network.IPv6Range,
+			Reserve:      true,
+			Exclusions:   ipv6Exclusions,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "fail to initialize IPv6 pool for network '%v'", network.ID)
+		}
+	}
+
 	w.WriteHeader(201)
 	err = json.NewEncoder(w).Encode(&httpresp.NetworkCreate{
 		Network: network,
@@ -57,3 +119,68 @@ func (c NetworksController) Create(w http.ResponseWriter, r *http.Request, p map
 	}
 	return nil
 }
+
+// splitReservations returns the reserved addresses and ranges of the IPv4 pool
+// and of the IPv6 pool of the network to create
+func splitReservations(cnp params.NetworkCreate) ([]string, []string, error) {
+	if len(cnp.ReservedAddresses) == 0 && len(cnp.ReservedRanges) == 0 {
+		return nil, nil, nil
+	}
+
+	_, ipnet, err := net.ParseCIDR(cnp.IPRange)
+	if err != nil {
+		return nil, nil, errors.Errorf("invalid IP range '%v'", cnp.IPRange)
+	}
+	var ipv6net *net.IPNet
+	if cnp.IPv6Range != "" {
+		_, ipv6net, err = net.ParseCIDR(cnp.IPv6Range)
+		if err != nil {
+			return nil, nil, errors.Errorf("invalid IPv6 range '%v'", cnp.IPv6Range)
+		}
+	}
+
+	var exclusions, ipv6Exclusions []string
+	add := func(reservation string, reservationNet *net.IPNet) error {
+		ones, _ := reservationNet.Mask.Size()
+		in := func(rangeNet *net.IPNet) bool {
+			rangeOnes, _ := rangeNet.Mask.Size()
+			return rangeNet.Contains(reservationNet.IP) && rangeOnes <= ones
+		}
+		switch {
+		case in(ipnet):
+			exclusions = append(exclusions, reservation)
+		case ipv6net != nil && in(ipv6net):
+			ipv6Exclusions = append(ipv6Exclusions, reservation)
+		default:
+			return errors.Errorf("reservation %v is not in the ranges of the network", reservation)
+		}
+		return nil
+	}
+
+	for _, address := range cnp.ReservedAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, nil, errors.Errorf("invalid reserved address '%v'", address)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+		err := add(ip.String(), &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, reservedRange := range cnp.ReservedRanges {
+		_, reservedNet, err := net.ParseCIDR(reservedRange)
+		if err != nil {
+			return nil, nil, errors.Errorf("invalid reserved range '%v'", reservedRange)
+		}
+		err = add(reservedNet.String(), reservedNet)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return exclusions, ipv6Exclusions, nil
+}
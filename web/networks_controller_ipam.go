@@ -0,0 +1,115 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/types"
+)
+
+// IPAM reports the usage of the IP pools of the network and the endpoints
+// owning the allocated addresses
+func (c NetworksController) IPAM(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	network, ok, err := c.NetworkRepository.Exists(ctx, p["id"])
+	if err != nil {
+		return errors.Wrapf(err, "fail to query store")
+	} else if !ok {
+		w.WriteHeader(404)
+		return errors.New("network not found")
+	}
+	log := logger.Get(ctx).WithField("network_id", network.ID)
+	ctx = logger.ToCtx(ctx, log)
+
+	endpoints, err := c.EndpointRepository.List(ctx, map[string]string{"network_id": network.ID})
+	if err != nil {
+		return errors.Wrapf(err, "fail to list endpoints of network %v", network.ID)
+	}
+	owners := map[string]string{}
+	for _, endpoint := range endpoints {
+		for _, address := range endpoint.TargetVethIPs() {
+			ip, _, err := net.ParseCIDR(address)
+			if err != nil {
+				log.WithError(err).Errorf("invalid address of endpoint %v", endpoint.ID)
+				continue
+			}
+			owners[ip.String()] = endpoint.ID
+		}
+	}
+
+	ipam, err := c.networkIPAM(ctx, network, owners)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get IPAM of network %v", network.ID)
+	}
+
+	w.WriteHeader(200)
+	err = json.NewEncoder(w).Encode(&httpresp.NetworkIPAM{
+		IPAM: ipam,
+	})
+	if err != nil {
+		log.WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}
+
+// networkIPAM counts the addresses of the IP pools of network. Allocated
+// addresses are only listed if owners, the endpoint IDs indexed by IP, is not
+// nil.
+func (c NetworksController) networkIPAM(ctx context.Context, network types.Network, owners map[string]string) (types.NetworkIPAM, error) {
+	ipam := types.NetworkIPAM{NetworkID: network.ID, Pools: []types.IPPoolUsage{}}
+	if owners != nil {
+		ipam.Addresses = []types.IPAMAddress{}
+	}
+
+	pools := []string{network.ID}
+	if network.IPv6Range != "" {
+		pools = append(pools, network.IPv6PoolID())
+	}
+	for _, id := range pools {
+		usage, err := c.IPAllocator.Usage(ctx, id)
+		if err != nil {
+			return ipam, errors.Wrapf(err, "fail to get usage of IP pool %v", id)
+		}
+		pool := types.IPPoolUsage{
+			Ranges: usage.Ranges,
+			Total:  usage.Total, Used: usage.Used, Reserved: usage.Reserved, Free: usage.Free,
+		}
+		if usage.Total > 0 {
+			taken := float64(usage.Total-usage.Free) / float64(usage.Total) * 100
+			pool.NearExhaustion = taken >= c.Config.IPUsageWarningThreshold
+		}
+		if pool.NearExhaustion {
+			ipam.Warnings = append(ipam.Warnings, fmt.Sprintf(
+				"IP pool %v is nearly exhausted: %d free addresses out of %d", usage.Ranges, usage.Free, usage.Total,
+			))
+			logger.Get(ctx).WithField("pool_id", id).WithField("free", usage.Free).Warn("IP pool nearly exhausted")
+		}
+		ipam.Pools = append(ipam.Pools, pool)
+
+		if owners == nil {
+			continue
+		}
+		for _, allocated := range usage.Allocated {
+			address := types.IPAMAddress{
+				Address:        allocated.Address,
+				Reserved:       allocated.Reserved,
+				ReservationKey: allocated.ReservationKey,
+			}
+			ip, _, err := net.ParseCIDR(allocated.Address)
+			if err == nil {
+				address.EndpointID = owners[ip.String()]
+			}
+			ipam.Addresses = append(ipam.Addresses, address)
+		}
+	}
+	return ipam, nil
+}
@@ -25,6 +25,18 @@ func (c NetworksController) List(w http.ResponseWriter, r *http.Request, params
 	res := httpresp.NetworksList{
 		Networks: networks,
 	}
+	if r.URL.Query().Get("usage") == "true" {
+		res.Usage = map[string]types.NetworkIPAM{}
+		for _, network := range networks {
+			ipam, err := c.networkIPAM(ctx, network, nil)
+			if err != nil {
+				// The pools of a network being created may not exist yet
+				log.WithError(err).WithField("network_id", network.ID).Warn("fail to get IPAM of network")
+				continue
+			}
+			res.Usage[network.ID] = ipam
+		}
+	}
 
 	w.WriteHeader(200)
 	err = json.NewEncoder(w).Encode(&res)
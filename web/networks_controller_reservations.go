@@ -0,0 +1,50 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/ipallocator"
+)
+
+// ReleaseReservation removes a reservation key from the IP pools of the
+// network, the addresses which are not used by an endpoint are released
+func (c NetworksController) ReleaseReservation(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	network, ok, err := c.NetworkRepository.Exists(ctx, p["id"])
+	if err != nil {
+		return errors.Wrapf(err, "fail to query store")
+	} else if !ok {
+		w.WriteHeader(404)
+		return errors.New("network not found")
+	}
+	log := logger.Get(ctx).WithField("network_id", network.ID).WithField("reservation_key", p["key"])
+	ctx = logger.ToCtx(ctx, log)
+
+	pools := []string{network.ID}
+	if network.IPv6Range != "" {
+		pools = append(pools, network.IPv6PoolID())
+	}
+	found := false
+	for _, id := range pools {
+		err := c.IPAllocator.ReleaseReservation(ctx, id, p["key"])
+		if err == ipallocator.ErrReservationNotFound {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to release reservation in IP pool %v", id)
+		}
+		found = true
+	}
+	if !found {
+		w.WriteHeader(404)
+		return errors.New("reservation not found")
+	}
+
+	w.WriteHeader(204)
+	return nil
+}
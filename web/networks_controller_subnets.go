@@ -0,0 +1,227 @@
+package web
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/ipallocator"
+	"github.com/Scalingo/sand/netutils"
+	sandnetwork "github.com/Scalingo/sand/network"
+)
+
+func (c NetworksController) AddSubnet(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	var sap params.NetworkSubnetAdd
+	err := json.NewDecoder(r.Body).Decode(&sap)
+	if err != nil {
+		w.WriteHeader(400)
+		return errors.Wrap(err, "invalid JSON")
+	}
+
+	network, ok, err := c.NetworkRepository.Exists(ctx, p["id"])
+	if err != nil {
+		return errors.Wrapf(err, "fail to query store")
+	} else if !ok {
+		w.WriteHeader(404)
+		return errors.New("network not found")
+	}
+	log := logger.Get(ctx).WithField("network_id", network.ID).WithField("ip_range", sap.IPRange)
+	ctx = logger.ToCtx(ctx, log)
+
+	ipnet, err := parseIPv4Range(sap.IPRange)
+	if err != nil {
+		w.WriteHeader(400)
+		return err
+	}
+	if sap.Gateway == "" {
+		sap.Gateway, err = netutils.DefaultGateway(ipnet.String())
+		if err != nil {
+			return errors.Wrapf(err, "fail to get default gateway for iprange=%v", ipnet)
+		}
+	}
+	gateway, gatewayNet, err := net.ParseCIDR(sap.Gateway)
+	if err != nil || gatewayNet.String() != ipnet.String() {
+		w.WriteHeader(400)
+		return errors.Errorf("gateway '%v' is not an address of %v", sap.Gateway, ipnet)
+	}
+	// The network is updated before the IP pool, nothing has changed if it
+	// fails. The subnet may have been added to the network by a request which
+	// failed to update the pool, the pool operations are idempotent.
+	subnet := types.Subnet{IPRange: ipnet.String(), Gateway: sap.Gateway}
+	subnets := network.IPv4Subnets()
+	if !containsSubnet(subnets, subnet) {
+		err = checkSubnetsOverlap(subnets, ipnet, -1)
+		if err != nil {
+			w.WriteHeader(400)
+			return err
+		}
+		network, err = c.NetworkRepository.UpdateSubnets(ctx, network, append(subnets, subnet))
+		if errors.Cause(err) == sandnetwork.ErrSubnetsModified {
+			w.WriteHeader(409)
+			return err
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to add subnet to network '%v'", network.ID)
+		}
+	}
+
+	err = c.IPAllocator.AddRange(ctx, network.ID, ipnet.String())
+	if err != nil {
+		return errors.Wrapf(err, "fail to add range to the IP pool of network '%v'", network.ID)
+	}
+	_, err = c.IPAllocator.AllocateIP(ctx, network.ID, ipallocator.AllocateIPOpts{
+		Address: gateway.String(),
+		Reserve: true,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to reserve gateway of subnet %v", ipnet)
+	}
+
+	log.Info("subnet added")
+	return c.writeNetwork(w, r, network)
+}
+
+func (c NetworksController) WidenSubnet(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	var swp params.NetworkSubnetWiden
+	err := json.NewDecoder(r.Body).Decode(&swp)
+	if err != nil {
+		w.WriteHeader(400)
+		return errors.Wrap(err, "invalid JSON")
+	}
+
+	network, ok, err := c.NetworkRepository.Exists(ctx, p["id"])
+	if err != nil {
+		return errors.Wrapf(err, "fail to query store")
+	} else if !ok {
+		w.WriteHeader(404)
+		return errors.New("network not found")
+	}
+	log := logger.Get(ctx).WithField("network_id", network.ID).WithField("ip_range", swp.IPRange)
+	ctx = logger.ToCtx(ctx, log)
+
+	oldIPNet, err := parseIPv4Range(swp.IPRange)
+	if err != nil {
+		w.WriteHeader(400)
+		return err
+	}
+	ipnet, err := parseIPv4Range(swp.NewIPRange)
+	if err != nil {
+		w.WriteHeader(400)
+		return err
+	}
+
+	oldOnes, _ := oldIPNet.Mask.Size()
+	newOnes, _ := ipnet.Mask.Size()
+	if !ipnet.Contains(oldIPNet.IP) || newOnes >= oldOnes {
+		w.WriteHeader(400)
+		return errors.Errorf("%v is not larger than %v", ipnet, oldIPNet)
+	}
+
+	// The network is updated before the IP pool, nothing has changed if it
+	// fails. The subnet may have been widened in the network by a request
+	// which failed to update the pool, the pool operations are idempotent.
+	subnets := network.IPv4Subnets()
+	index := findSubnet(subnets, oldIPNet)
+	if index == -1 && findSubnet(subnets, ipnet) == -1 {
+		w.WriteHeader(404)
+		return errors.Errorf("subnet %v not found", oldIPNet)
+	}
+	if index != -1 {
+		err = checkSubnetsOverlap(subnets, ipnet, index)
+		if err != nil {
+			w.WriteHeader(400)
+			return err
+		}
+
+		// The gateway keeps its address with the new prefix length
+		gateway, _, err := net.ParseCIDR(subnets[index].Gateway)
+		if err != nil {
+			return errors.Wrapf(err, "invalid gateway %v", subnets[index].Gateway)
+		}
+		subnets[index] = types.Subnet{IPRange: ipnet.String(), Gateway: netutils.ToCIDR(gateway, ipnet.Mask)}
+		network, err = c.NetworkRepository.UpdateSubnets(ctx, network, subnets)
+		if errors.Cause(err) == sandnetwork.ErrSubnetsModified {
+			w.WriteHeader(409)
+			return err
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to widen subnet of network '%v'", network.ID)
+		}
+	}
+
+	err = c.IPAllocator.WidenRange(ctx, network.ID, oldIPNet.String(), ipnet.String())
+	if err != nil {
+		return errors.Wrapf(err, "fail to widen range of the IP pool of network '%v'", network.ID)
+	}
+
+	log.WithField("new_ip_range", ipnet.String()).Info("subnet widened")
+	return c.writeNetwork(w, r, network)
+}
+
+func (c NetworksController) writeNetwork(w http.ResponseWriter, r *http.Request, network types.Network) error {
+	w.WriteHeader(200)
+	err := json.NewEncoder(w).Encode(&httpresp.NetworkShow{
+		Network: network,
+	})
+	if err != nil {
+		logger.Get(r.Context()).WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}
+
+func parseIPv4Range(ipRange string) (*net.IPNet, error) {
+	ip, ipnet, err := net.ParseCIDR(ipRange)
+	if err != nil || ip.To4() == nil {
+		return nil, errors.Errorf("invalid IPv4 range '%v'", ipRange)
+	}
+	return ipnet, nil
+}
+
+// containsSubnet returns true if subnets contains subnet with the same
+// gateway
+func containsSubnet(subnets []types.Subnet, subnet types.Subnet) bool {
+	for _, s := range subnets {
+		if s == subnet {
+			return true
+		}
+	}
+	return false
+}
+
+// findSubnet returns the index of the subnet of ipnet, -1 if there is none
+func findSubnet(subnets []types.Subnet, ipnet *net.IPNet) int {
+	for i, subnet := range subnets {
+		_, subnetNet, err := net.ParseCIDR(subnet.IPRange)
+		if err == nil && subnetNet.String() == ipnet.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkSubnetsOverlap returns an error if ipnet overlaps one of the subnets,
+// except the one at index skip
+func checkSubnetsOverlap(subnets []types.Subnet, ipnet *net.IPNet, skip int) error {
+	for i, subnet := range subnets {
+		_, subnetNet, err := net.ParseCIDR(subnet.IPRange)
+		if err != nil || i == skip {
+			continue
+		}
+		if subnetNet.Contains(ipnet.IP) || ipnet.Contains(subnetNet.IP) {
+			return errors.Errorf("%v overlaps subnet %v", ipnet, subnetNet)
+		}
+	}
+	return nil
+}
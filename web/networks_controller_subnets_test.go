@@ -0,0 +1,141 @@
+package web
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/ipallocator"
+	sandnetwork "github.com/Scalingo/sand/network"
+	"github.com/Scalingo/sand/test/mocks/ipallocatormock"
+	"github.com/Scalingo/sand/test/mocks/networkmock"
+)
+
+func TestNetworksController_Subnets(t *testing.T) {
+	network := types.Network{ID: "1", IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"}
+	added := []types.Subnet{
+		{IPRange: "10.0.0.0/24", Gateway: "10.0.0.1/24"},
+		{IPRange: "10.0.1.0/24", Gateway: "10.0.1.1/24"},
+	}
+	widened := []types.Subnet{{IPRange: "10.0.0.0/23", Gateway: "10.0.0.1/23"}}
+	gateway := ipallocator.AllocateIPOpts{Address: "10.0.1.1", Reserve: true}
+
+	cases := []struct {
+		Name                    string
+		Action                  string
+		Body                    string
+		Status                  int
+		Error                   string
+		ExpectNetworkRepository func(*networkmock.MockRepository)
+		ExpectIPAllocator       func(*ipallocatormock.MockIPAllocator)
+	}{
+		{
+			Name:   "it should add the subnet to the network and then to the IP pool",
+			Action: "add",
+			Body:   `{"ip_range": "10.0.1.0/24"}`,
+			Status: 200,
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+				r.EXPECT().UpdateSubnets(gomock.Any(), network, added).Return(types.Network{ID: "1", Subnets: added}, nil)
+			},
+			ExpectIPAllocator: func(a *ipallocatormock.MockIPAllocator) {
+				a.EXPECT().AddRange(gomock.Any(), "1", "10.0.1.0/24").Return(nil)
+				a.EXPECT().AllocateIP(gomock.Any(), "1", gateway).Return("10.0.1.1/24", nil)
+			},
+		}, {
+			Name:   "it should not modify the IP pool if the subnets of the network have been modified",
+			Action: "add",
+			Body:   `{"ip_range": "10.0.1.0/24"}`,
+			Status: 409,
+			Error:  "modified concurrently",
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+				r.EXPECT().UpdateSubnets(gomock.Any(), network, added).Return(network, errors.Wrap(sandnetwork.ErrSubnetsModified, "fail to save network"))
+			},
+		}, {
+			Name:   "it should complete the IP pool of a subnet already added to the network",
+			Action: "add",
+			Body:   `{"ip_range": "10.0.1.0/24"}`,
+			Status: 200,
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(types.Network{ID: "1", Subnets: added}, true, nil)
+			},
+			ExpectIPAllocator: func(a *ipallocatormock.MockIPAllocator) {
+				a.EXPECT().AddRange(gomock.Any(), "1", "10.0.1.0/24").Return(nil)
+				a.EXPECT().AllocateIP(gomock.Any(), "1", gateway).Return("10.0.1.1/24", nil)
+			},
+		}, {
+			Name:   "it should widen the subnet of the network and then the IP pool",
+			Action: "widen",
+			Body:   `{"ip_range": "10.0.0.0/24", "new_ip_range": "10.0.0.0/23"}`,
+			Status: 200,
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+				r.EXPECT().UpdateSubnets(gomock.Any(), network, widened).Return(types.Network{ID: "1", Subnets: widened}, nil)
+			},
+			ExpectIPAllocator: func(a *ipallocatormock.MockIPAllocator) {
+				a.EXPECT().WidenRange(gomock.Any(), "1", "10.0.0.0/24", "10.0.0.0/23").Return(nil)
+			},
+		}, {
+			Name:   "it should not widen the IP pool if the subnets of the network have been modified",
+			Action: "widen",
+			Body:   `{"ip_range": "10.0.0.0/24", "new_ip_range": "10.0.0.0/23"}`,
+			Status: 409,
+			Error:  "modified concurrently",
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+				r.EXPECT().UpdateSubnets(gomock.Any(), network, widened).Return(network, errors.Wrap(sandnetwork.ErrSubnetsModified, "fail to save network"))
+			},
+		}, {
+			Name:   "it should complete the IP pool of a subnet already widened in the network",
+			Action: "widen",
+			Body:   `{"ip_range": "10.0.0.0/24", "new_ip_range": "10.0.0.0/23"}`,
+			Status: 200,
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(types.Network{ID: "1", Subnets: widened}, true, nil)
+			},
+			ExpectIPAllocator: func(a *ipallocatormock.MockIPAllocator) {
+				a.EXPECT().WidenRange(gomock.Any(), "1", "10.0.0.0/24", "10.0.0.0/23").Return(nil)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			networkRepo := networkmock.NewMockRepository(ctrl)
+			allocator := ipallocatormock.NewMockIPAllocator(ctrl)
+			controller := NetworksController{NetworkRepository: networkRepo, IPAllocator: allocator}
+			if c.ExpectNetworkRepository != nil {
+				c.ExpectNetworkRepository(networkRepo)
+			}
+			if c.ExpectIPAllocator != nil {
+				c.ExpectIPAllocator(allocator)
+			}
+
+			r := httptest.NewRequest("POST", "/networks/1/subnets", strings.NewReader(c.Body))
+			w := httptest.NewRecorder()
+
+			action := controller.AddSubnet
+			if c.Action == "widen" {
+				action = controller.WidenSubnet
+			}
+			err := action(w, r, map[string]string{"id": "1"})
+			assert.Equal(t, c.Status, w.Code)
+			if c.Error != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), c.Error)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/params"
+)
+
+const (
+	// minIPv4MTU and minIPv6MTU are the smallest MTU of the links of each
+	// IP version, maxMTU leaves room for the VxLAN headers in an IP packet
+	minIPv4MTU = 68
+	minIPv6MTU = 1280
+	maxMTU     = 65535 - 70
+)
+
+// Update modifies the MTU of a network
+func (c NetworksController) Update(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	var nup params.NetworkUpdate
+	err := json.NewDecoder(r.Body).Decode(&nup)
+	if err != nil {
+		w.WriteHeader(400)
+		return errors.Wrap(err, "invalid JSON")
+	}
+
+	network, ok, err := c.NetworkRepository.Exists(ctx, p["id"])
+	if err != nil {
+		return errors.Wrapf(err, "fail to query store")
+	} else if !ok {
+		w.WriteHeader(404)
+		return errors.New("network not found")
+	}
+	log := logger.Get(ctx).WithField("network_id", network.ID)
+	ctx = logger.ToCtx(ctx, log)
+
+	if nup.MTU != nil && *nup.MTU != network.MTU {
+		err := checkMTU(*nup.MTU, network.IPv6Range)
+		if err != nil {
+			w.WriteHeader(400)
+			return err
+		}
+		network, err = c.NetworkRepository.UpdateMTU(ctx, network, *nup.MTU)
+		if err != nil {
+			return errors.Wrapf(err, "fail to update MTU of network '%v'", network.ID)
+		}
+	}
+	return c.writeNetwork(w, r, network)
+}
+
+// checkMTU returns an error if mtu can't be used by a network, 0 is the MTU
+// derived from the underlay interface of each node
+func checkMTU(mtu int, ipv6Range string) error {
+	if mtu == 0 {
+		return nil
+	}
+	min := minIPv4MTU
+	if ipv6Range != "" {
+		min = minIPv6MTU
+	}
+	if mtu < min || mtu > maxMTU {
+		return errors.Errorf("invalid MTU %d, it must be between %d and %d", mtu, min, maxMTU)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/test/mocks/networkmock"
+)
+
+func TestNetworksController_Update(t *testing.T) {
+	cases := []struct {
+		Name                    string
+		Body                    string
+		Status                  int
+		Error                   string
+		ExpectNetworkRepository func(*networkmock.MockRepository)
+	}{
+		{
+			Name:   "invalid JSON should return 400",
+			Body:   `{`,
+			Status: 400,
+			Error:  "invalid JSON",
+		}, {
+			Name:   "unexisting network id should return 404",
+			Body:   `{"mtu": 1400}`,
+			Status: 404,
+			Error:  "not found",
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(types.Network{}, false, nil)
+			},
+		}, {
+			Name:   "an IPv6 network should refuse an MTU smaller than 1280",
+			Body:   `{"mtu": 1200}`,
+			Status: 400,
+			Error:  "invalid MTU",
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(types.Network{ID: "1", IPv6Range: "fd00::/64"}, true, nil)
+			},
+		}, {
+			Name:   "it should update the MTU",
+			Body:   `{"mtu": 8950}`,
+			Status: 200,
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				network := types.Network{ID: "1"}
+				r.EXPECT().Exists(gomock.Any(), "1").Return(network, true, nil)
+				r.EXPECT().UpdateMTU(gomock.Any(), network, 8950).Return(types.Network{ID: "1", MTU: 8950}, nil)
+			},
+		}, {
+			Name:   "it should not save an unchanged MTU",
+			Body:   `{"mtu": 1400}`,
+			Status: 200,
+			ExpectNetworkRepository: func(r *networkmock.MockRepository) {
+				r.EXPECT().Exists(gomock.Any(), "1").Return(types.Network{ID: "1", MTU: 1400}, true, nil)
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			networkRepo := networkmock.NewMockRepository(ctrl)
+			controller := NetworksController{NetworkRepository: networkRepo}
+			if c.ExpectNetworkRepository != nil {
+				c.ExpectNetworkRepository(networkRepo)
+			}
+
+			r := httptest.NewRequest("PATCH", "/networks/1", strings.NewReader(c.Body))
+			w := httptest.NewRecorder()
+
+			err := controller.Update(w, r, map[string]string{"id": "1"})
+			assert.Equal(t, c.Status, w.Code)
+			if c.Error != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.Error)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/httpresp"
+	"github.com/Scalingo/sand/api/params"
+	"github.com/Scalingo/sand/network"
+)
+
+// ReserveVNI keeps a VNI out of the allocation without creating a network
+func (c NetworksController) ReserveVNI(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	log := logger.Get(ctx)
+
+	var rp params.VNIReservationCreate
+	err := json.NewDecoder(r.Body).Decode(&rp)
+	if err != nil {
+		w.WriteHeader(400)
+		return errors.Wrap(err, "invalid JSON")
+	}
+
+	reservation, err := c.NetworkRepository.ReserveVNI(ctx, rp)
+	if status, ok := vniErrorStatus(err); ok {
+		w.WriteHeader(status)
+		return errors.Wrapf(err, "invalid VNI %d", rp.VNI)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to reserve VNI %d", rp.VNI)
+	}
+
+	w.WriteHeader(201)
+	err = json.NewEncoder(w).Encode(&httpresp.VNIReservationCreate{
+		Reservation: reservation,
+	})
+	if err != nil {
+		log.WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}
+
+func (c NetworksController) VNIReservations(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	log := logger.Get(ctx)
+
+	reservations, err := c.NetworkRepository.VNIReservations(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "fail to list VNI reservations")
+	}
+
+	w.WriteHeader(200)
+	err = json.NewEncoder(w).Encode(&httpresp.VNIReservationsList{
+		Reservations: reservations,
+	})
+	if err != nil {
+		log.WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}
+
+// ReleaseVNIReservation deletes a VNI reservation, the VNI can be allocated
+// again
+func (c NetworksController) ReleaseVNIReservation(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	vni, err := strconv.Atoi(p["vni"])
+	if err != nil {
+		w.WriteHeader(400)
+		return errors.Errorf("invalid VNI '%v'", p["vni"])
+	}
+
+	err = c.NetworkRepository.ReleaseVNIReservation(ctx, vni)
+	if err == network.ErrVNIReservationNotFound {
+		w.WriteHeader(404)
+		return err
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to release reservation of VNI %d", vni)
+	}
+
+	w.WriteHeader(204)
+	return nil
+}
+
+// vniErrorStatus returns the HTTP status of the errors due to a VNI requested
+// by the caller
+func vniErrorStatus(err error) (int, bool) {
+	switch errors.Cause(err) {
+	case network.ErrVNIOutOfRange:
+		return 400, true
+	case network.ErrVNIUnavailable:
+		return 409, true
+	}
+	return 0, false
+}
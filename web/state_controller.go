@@ -0,0 +1,68 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/Scalingo/sand/api/types"
+	"github.com/Scalingo/sand/config"
+	"github.com/Scalingo/sand/state"
+)
+
+type StateController struct {
+	Config          *config.Config
+	StateRepository state.Repository
+}
+
+func NewStateController(c *config.Config, s state.Repository) StateController {
+	return StateController{Config: c, StateRepository: s}
+}
+
+func (c StateController) Export(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	log := logger.Get(ctx)
+
+	s, err := c.StateRepository.Export(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "fail to export state")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(&s)
+	if err != nil {
+		log.WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}
+
+func (c StateController) Import(w http.ResponseWriter, r *http.Request, p map[string]string) error {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	log := logger.Get(ctx)
+
+	var s types.State
+	err := json.NewDecoder(r.Body).Decode(&s)
+	if err != nil {
+		return errors.Wrap(err, "invalid JSON")
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	report, err := c.StateRepository.Import(ctx, s, dryRun)
+	if err == state.ErrConflict {
+		w.WriteHeader(http.StatusConflict)
+	} else if err != nil {
+		return errors.Wrapf(err, "fail to import state")
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	err = json.NewEncoder(w).Encode(&report)
+	if err != nil {
+		log.WithError(err).Error("fail to encode JSON")
+	}
+	return nil
+}